@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "github.com/mi4r/gophermart/docs/accrual"
 	"github.com/mi4r/gophermart/internal/config"
 	"github.com/mi4r/gophermart/internal/server"
 	serveraccrual "github.com/mi4r/gophermart/internal/server/accrual"
 	"github.com/mi4r/gophermart/internal/storage"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+	"github.com/mi4r/gophermart/internal/tracing"
 	workeraccrual "github.com/mi4r/gophermart/internal/worker/accrual"
 	"github.com/mi4r/gophermart/lib/logger"
 )
@@ -22,37 +28,188 @@ import (
 // @host localhost:8081
 // @BasePath /
 func main() {
-	config := config.NewAccrualConfig()
-	logger.InitLogger(config.LogLevel)
+	os.Exit(run())
+}
+
+// run возвращает код завершения. Все defer успевают выполниться до os.Exit
+func run() int {
+	// Миграции запускаются отдельной подкомандой, до разбора флагов сервиса
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return migrate(os.Args[2:])
+	}
+
+	config, err := config.NewAccrualConfig()
+	// Конфигурацию выводим и с ошибками проверки, чтобы было видно, что не так
+	if config.Meta.PrintConfig {
+		return printConfig(config, err)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeConfigError
+	}
+	logFile, err := logger.Init(config.LogConfig.Options())
+	if err != nil {
+		slog.Error("logger init error", slog.String("err", err.Error()))
+		return server.ExitCodeServerError
+	}
+	defer logFile.Close()
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: server.AccrualName,
+		Exporter:    config.TraceExporter,
+		FilePath:    config.TraceFile,
+	})
+	if err != nil {
+		slog.Error("tracing init error", slog.String("err", err.Error()))
+		return server.ExitCodeServerError
+	}
+	// Спаны выгружаются в самом конце, чтобы попали и спаны остановки
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("tracing shutdown error", slog.String("err", err.Error()))
+		}
+	}()
+
 	storage := storage.NewStorageAccrual(config.DriverType, config.StoragePath)
+	if err := storage.Open(context.Background()); err != nil {
+		slog.Error("storage open error", slog.String("err", err.Error()))
+		return server.ExitCodeStorageError
+	}
+	// Пул соединений закрывается последним, после остановки сервера и воркеров
+	defer storage.Close()
+	if err := migrations.Prepare(context.Background(), storage, config.AutoMigrate); err != nil {
+		slog.Error("storage schema error", slog.String("err", err.Error()))
+		return server.ExitCodeStorageError
+	}
+
 	core := server.NewServer(
 		server.Config{
 			ServiceName: server.AccrualName,
 			Listen:      config.ListenAddr,
 			RateLimit:   config.RateLimit,
+			RateBurst:   config.RateBurst,
+			AdminToken:  config.AdminToken,
 		},
 	)
 	// Канал для передачи задач
-	taskCh := make(chan workeraccrual.Task)
-	worker := workeraccrual.NewWorker(1, taskCh)
+	taskCh := make(chan workeraccrual.Task, config.QueueSize)
+	pool := workeraccrual.NewPool(taskCh, config.WorkerPoolSize)
 
 	service := serveraccrual.NewAccrualSystem(core, taskCh)
+	dispatcher := workeraccrual.NewWebhookDispatcher(
+		time.NewTicker(config.WebhookInterval), config.WebhookMaxAttempts,
+	)
 
 	// Configure
+	service.SetWebhookHosts(config.WebhookHostList())
 	service.SetRoutes()
 	service.SetStorage(storage)
-	worker.SetStorage(storage)
-	go service.Server.Start()
-	worker.Start()
+	service.SetWorker(pool)
+	pool.SetStorage(storage)
+	dispatcher.SetStorage(storage)
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		serverErrCh <- service.Server.Start()
+	}()
+	pool.Start()
+	dispatcher.Start()
+
+	// Горячая перезагрузка уровня логов, лимитов и размера пула
+	current := config
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		config.Meta.Watch(watchCtx, func(reason string) {
+			next, err := current.Reload()
+			if err != nil {
+				slog.Error("config reload rejected, keep running with previous config",
+					slog.String("reason", reason),
+					slog.String("err", err.Error()),
+				)
+				return
+			}
+			reloaded, restart := current.Diff(next)
+			logger.SetLevel(next.LogLevel)
+			logger.SetModuleLevels(next.LogModules)
+			service.SetRateLimit(next.RateLimit, next.RateBurst)
+			pool.Resize(next.WorkerPoolSize)
+			if len(restart) != 0 {
+				slog.Warn("config changes require restart", slog.Any("fields", restart))
+			}
+			slog.Info("config reloaded", slog.String("reason", reason), slog.Any("fields", reloaded))
+			current = next
+		})
+	}()
+
 	// Канал для перехвата сигналов
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
-	sig := <-sigChan
-	slog.Debug("received signal", slog.String("signal", sig.String()))
+	code := server.ExitCodeOK
+	select {
+	case sig := <-sigChan:
+		slog.Debug("received signal", slog.String("signal", sig.String()))
+	case err := <-serverErrCh:
+		slog.Error("http server error", slog.String("err", err.Error()))
+		code = server.ExitCodeServerError
+	}
+
+	// Перезагрузка не должна менять воркеры во время остановки
+	stopWatch()
+	<-watchDone
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	// Сначала дожидаемся текущих запросов: после этого новых задач не будет
+	if err := service.Server.Shutdown(ctx); err != nil {
+		slog.Error("http server shutdown error", slog.String("err", err.Error()))
+		code = server.ExitCodeShutdownError
+	} else {
+		// Закрываем канал задач - воркеры доделают текущие и выйдут.
+		// Если Shutdown не дождался запросов, их AddTask еще может писать в канал:
+		// канал не закрываем, воркеры прервет истекший ctx в pool.Stop
+		close(taskCh)
+	}
+	if err := pool.Stop(ctx); err != nil {
+		slog.Error("worker shutdown error", slog.String("err", err.Error()))
+		code = server.ExitCodeShutdownError
+	}
+	if err := dispatcher.Stop(ctx); err != nil {
+		slog.Error("webhook dispatcher shutdown error", slog.String("err", err.Error()))
+		code = server.ExitCodeShutdownError
+	}
+	slog.Debug("accrual stopped", slog.Int("code", code))
+	return code
+}
+
+// printConfig выводит итоговую конфигурацию без секретов
+func printConfig(cfg interface{ Redacted() (string, error) }, validateErr error) int {
+	out, err := cfg.Redacted()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeConfigError
+	}
+	fmt.Print(out)
+	if validateErr != nil {
+		fmt.Fprintln(os.Stderr, validateErr)
+		return server.ExitCodeConfigError
+	}
+	return server.ExitCodeOK
+}
 
-	// Закрываем канал задач
-	close(taskCh)
-	worker.Stop()
-	service.Server.Shutdown()
+// migrate выполняет подкоманду migrate для схемы сервиса
+func migrate(args []string) int {
+	err := migrations.Command(migrations.Accrual, args, os.Getenv, os.Stdout)
+	switch {
+	case errors.Is(err, migrations.ErrUsage):
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeConfigError
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeStorageError
+	}
+	return server.ExitCodeOK
 }
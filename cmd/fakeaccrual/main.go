@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mi4r/gophermart/internal/fakeaccrual"
+	"github.com/mi4r/gophermart/lib/logger"
+)
+
+// Заглушка Accrual System для локальной разработки.
+// Сценарии задаются файлом (-f) или на лету через POST /fake/orders/{number}
+func main() {
+	a := flag.String("a", "localhost:8081", "Listen address with port")
+	f := flag.String("f", "", "Path to JSON file with order scripts")
+	l := flag.String("l", "debug", "Logger Level")
+	flag.Parse()
+
+	logger.InitLogger(*l)
+	fake := fakeaccrual.New()
+	if *f != "" {
+		if err := fake.LoadFile(*f); err != nil {
+			slog.Error("load scripts error", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	go func() {
+		if err := fake.Router.Start(*a); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}()
+
+	// Канал для перехвата сигналов
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+
+	sig := <-sigChan
+	slog.Debug("received signal", slog.String("signal", sig.String()))
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -8,12 +11,20 @@ import (
 	"time"
 
 	_ "github.com/mi4r/gophermart/docs/gophermart"
+	clientaccrual "github.com/mi4r/gophermart/internal/client/accrual"
 	"github.com/mi4r/gophermart/internal/config"
+	"github.com/mi4r/gophermart/internal/outbox"
+	"github.com/mi4r/gophermart/internal/rules"
 	"github.com/mi4r/gophermart/internal/server"
 	servermart "github.com/mi4r/gophermart/internal/server/gophermart"
 	"github.com/mi4r/gophermart/internal/storage"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+	"github.com/mi4r/gophermart/internal/tracing"
 	workermart "github.com/mi4r/gophermart/internal/worker/gophermart"
+	"github.com/mi4r/gophermart/lib/breaker"
 	"github.com/mi4r/gophermart/lib/logger"
+	"github.com/mi4r/gophermart/lib/ratelimit"
+	"golang.org/x/time/rate"
 )
 
 // Documentation: https://github.com/swaggo/swag
@@ -23,33 +34,223 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
-	config := config.NewGophermartConfig()
-	logger.InitLogger(config.LogLevel)
+	os.Exit(run())
+}
+
+// run возвращает код завершения. Все defer успевают выполниться до os.Exit
+func run() int {
+	// Миграции запускаются отдельной подкомандой, до разбора флагов сервиса
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return migrate(os.Args[2:])
+	}
+
+	config, err := config.NewGophermartConfig()
+	// Конфигурацию выводим и с ошибками проверки, чтобы было видно, что не так
+	if config.Meta.PrintConfig {
+		return printConfig(config, err)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeConfigError
+	}
+	logFile, err := logger.Init(config.LogConfig.Options())
+	if err != nil {
+		slog.Error("logger init error", slog.String("err", err.Error()))
+		return server.ExitCodeServerError
+	}
+	defer logFile.Close()
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		ServiceName: server.GophermartName,
+		Exporter:    config.TraceExporter,
+		FilePath:    config.TraceFile,
+	})
+	if err != nil {
+		slog.Error("tracing init error", slog.String("err", err.Error()))
+		return server.ExitCodeServerError
+	}
+	// Спаны выгружаются в самом конце, чтобы попали и спаны остановки
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("tracing shutdown error", slog.String("err", err.Error()))
+		}
+	}()
+
 	storage := storage.NewStorageGophermart(config.DriverType, config.StoragePath)
+	if err := storage.Open(context.Background()); err != nil {
+		slog.Error("storage open error", slog.String("err", err.Error()))
+		return server.ExitCodeStorageError
+	}
+	// Пул соединений закрывается последним, после остановки сервера и воркера
+	defer storage.Close()
+	if err := migrations.Prepare(context.Background(), storage, config.AutoMigrate); err != nil {
+		slog.Error("storage schema error", slog.String("err", err.Error()))
+		return server.ExitCodeStorageError
+	}
+	storage.SetPointsTTL(config.PointsTTL)
+	storage.SetTiers(config.Tiers())
+	storage.SetReferralProgram(config.ReferralProgram())
+
 	core := server.NewServer(
 		server.Config{
-			ServiceName: server.GophermartName,
-			Listen:      config.ListenAddr,
-			SecretKey:   config.SecretKey,
+			ServiceName:   server.GophermartName,
+			Listen:        config.ListenAddr,
+			SecretKey:     config.SecretKey,
+			WebhookSecret: config.WebhookSecret,
+			AdminToken:    config.AdminToken,
 		},
 	)
 
 	tickerCh := time.NewTicker(config.TickerTime)
-	worker := workermart.NewWorker(1, tickerCh, config.AccrualSystemAddress)
+	// Общий лимитер запросов к Accrual System
+	limiter := ratelimit.NewBucket(rate.Limit(config.AccrualRateLimit), config.AccrualRateLimit)
+	accrualBreaker := breaker.New(config.BreakerThreshold, config.BreakerCooldown)
+	accrual := clientaccrual.New(config.AccrualSystemAddress,
+		clientaccrual.WithLimiter(limiter),
+		clientaccrual.WithBreaker(accrualBreaker),
+		clientaccrual.WithAdminToken(config.AccrualAdminToken),
+	)
+	worker := workermart.NewWorker(1, tickerCh, accrual)
 	worker.SetStorage(storage)
+	worker.EventsRetention = config.EventsRetention
+	worker.TierBasis = config.TierBasis
+	worker.TierWindow = config.TierWindow
+	worker.TierInterval = config.TierInterval
+	publisher, err := outbox.New(config.OutboxConfig.Options())
+	if err != nil {
+		slog.Error("outbox publisher init error", slog.String("err", err.Error()))
+		return server.ExitCodeServerError
+	}
+	var relay *workermart.OutboxRelay
+	if publisher != nil {
+		relay = workermart.NewOutboxRelay(time.NewTicker(config.OutboxInterval), publisher)
+		relay.SetStorage(storage)
+	} else {
+		// Без publisher доменные события ждут его настройки outbox_retention, потом удаляются
+		worker.OutboxRetention = config.OutboxRetention
+	}
 	service := servermart.NewGophermart(core)
 	// Configure
 	service.SetRoutes()
 	service.SetStorage(storage)
-	go service.Server.Start()
+	service.SetReservationTTL(config.ReservationTTL)
+	service.SetExpiryNotice(config.ExpiryNotice)
+	service.SetTiers(config.Tiers())
+	service.SetWithdrawRules(rules.New(config.Rules()))
+	service.SetTransferRules(rules.New(config.TransferRules(config.WithdrawPasswordCooldown)))
+	service.SetAccrual(accrual, accrualBreaker)
+	service.SetWorker(worker)
+
+	serverErrCh := make(chan error, 1)
+	go func() {
+		serverErrCh <- service.Server.Start()
+	}()
 	go worker.Start()
+	if relay != nil {
+		relay.Start()
+	}
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+	go service.ListenEvents(eventsCtx)
+	if config.WebhookURL != "" && config.WebhookSecret != "" {
+		if err := worker.Subscribe(context.Background(), config.WebhookURL, config.WebhookSecret); err != nil {
+			slog.Warn("accrual webhook subscription error", slog.String("err", err.Error()))
+		}
+	}
+
+	// Горячая перезагрузка уровня логов, лимита запросов к Accrual System и периода опроса
+	current := config
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		config.Meta.Watch(watchCtx, func(reason string) {
+			next, err := current.Reload()
+			if err != nil {
+				slog.Error("config reload rejected, keep running with previous config",
+					slog.String("reason", reason),
+					slog.String("err", err.Error()),
+				)
+				return
+			}
+			reloaded, restart := current.Diff(next)
+			logger.SetLevel(next.LogLevel)
+			logger.SetModuleLevels(next.LogModules)
+			limiter.SetLimit(rate.Limit(next.AccrualRateLimit), next.AccrualRateLimit)
+			worker.SetInterval(next.TickerTime)
+			if len(restart) != 0 {
+				slog.Warn("config changes require restart", slog.Any("fields", restart))
+			}
+			slog.Info("config reloaded", slog.String("reason", reason), slog.Any("fields", reloaded))
+			current = next
+		})
+	}()
 
 	// Канал для перехвата сигналов
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
-	sig := <-sigChan
-	slog.Debug("received signal", slog.String("signal", sig.String()))
-	worker.Stop()
-	service.Server.Shutdown()
+	code := server.ExitCodeOK
+	select {
+	case sig := <-sigChan:
+		slog.Debug("received signal", slog.String("signal", sig.String()))
+	case err := <-serverErrCh:
+		slog.Error("http server error", slog.String("err", err.Error()))
+		code = server.ExitCodeServerError
+	}
+
+	// Перезагрузка не должна менять воркер во время остановки
+	stopWatch()
+	<-watchDone
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	// Сначала перестаем принимать запросы и дожидаемся текущих,
+	// затем даем воркеру закончить проход
+	if err := service.Server.Shutdown(ctx); err != nil {
+		slog.Error("http server shutdown error", slog.String("err", err.Error()))
+		code = server.ExitCodeShutdownError
+	}
+	if err := worker.Stop(ctx); err != nil {
+		slog.Error("worker shutdown error", slog.String("err", err.Error()))
+		code = server.ExitCodeShutdownError
+	}
+	if relay != nil {
+		if err := relay.Stop(ctx); err != nil {
+			slog.Error("outbox relay shutdown error", slog.String("err", err.Error()))
+			code = server.ExitCodeShutdownError
+		}
+	}
+	slog.Debug("gophermart stopped", slog.Int("code", code))
+	return code
+}
+
+// printConfig выводит итоговую конфигурацию без секретов
+func printConfig(cfg interface{ Redacted() (string, error) }, validateErr error) int {
+	out, err := cfg.Redacted()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeConfigError
+	}
+	fmt.Print(out)
+	if validateErr != nil {
+		fmt.Fprintln(os.Stderr, validateErr)
+		return server.ExitCodeConfigError
+	}
+	return server.ExitCodeOK
+}
+
+// migrate выполняет подкоманду migrate для схемы сервиса
+func migrate(args []string) int {
+	err := migrations.Command(migrations.Gophermart, args, os.Getenv, os.Stdout)
+	switch {
+	case errors.Is(err, migrations.ErrUsage):
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeConfigError
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return server.ExitCodeStorageError
+	}
+	return server.ExitCodeOK
 }
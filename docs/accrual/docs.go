@@ -15,6 +15,52 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/accrual/webhook": {
+            "post": {
+                "description": "Подпись проверяется по заголовкам X-Webhook-Signature и X-Webhook-Timestamp\nПовторная доставка того же события не приводит к повторному начислению",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Сервис"
+                ],
+                "summary": "Прием событий о расчете начислений от Accrual System",
+                "parameters": [
+                    {
+                        "description": "Событие о заказе",
+                        "name": "event",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/WebhookEvent"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Событие принято"
+                    },
+                    "400": {
+                        "description": "Неверный формат события",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Неверная подпись",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/api/goods": {
             "post": {
                 "description": "Хендлер используется менеджерами для добавления механик вознаграждения за покупки\nПолученные системой расчёта начислений составы чеков проверяются на совпадение с зарегистрированными в данном хендлере вознаграждениями",
@@ -496,6 +542,130 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/webhooks": {
+            "post": {
+                "description": "Когда заказ переходит в статус PROCESSED или INVALID, на указанный адрес отправляется POST с событием\nТело запроса подписывается HMAC-SHA256 с секретом подписки: заголовок X-Webhook-Signature от \"X-Webhook-Timestamp.тело\"\nПовторная подписка того же адреса обновляет секрет\nСлужебный маршрут, нужен заголовок Authorization: Bearer \u003cadmin_token\u003e.\nХост адреса должен быть в webhook_hosts, без списка запрещены link-local, unspecified и multicast адреса",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Админ"
+                ],
+                "summary": "Подписка на события о расчете начислений",
+                "parameters": [
+                    {
+                        "description": "Адрес и секрет подписки",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/Webhook"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Подписка зарегистрирована",
+                        "schema": {
+                            "$ref": "#/definitions/Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса или запрещенный хост",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Неверный служебный токен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks/{id}": {
+            "delete": {
+                "description": "Служебный маршрут, нужен заголовок Authorization: Bearer \u003cadmin_token\u003e.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Админ"
+                ],
+                "summary": "Удаление подписки на события",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Подписка удалена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный идентификатор",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Неверный служебный токен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Подписка не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Процесс жив и обслуживает http запросы. Зависимости не проверяются",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Разное"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/HealthReport"
+                        }
+                    }
+                }
+            }
+        },
         "/ping": {
             "get": {
                 "description": "Простая проверка состояния сервера",
@@ -508,6 +678,37 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Хранилище недоступно",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Готовность принимать трафик: база данных, миграции, воркеры, очередь\n503 если недоступна критичная зависимость, degraded если некритичная",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Разное"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сервис готов",
+                        "schema": {
+                            "$ref": "#/definitions/HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Критичная зависимость недоступна",
+                        "schema": {
+                            "$ref": "#/definitions/HealthReport"
+                        }
                     }
                 }
             }
@@ -536,34 +737,57 @@ const docTemplate = `{
                 }
             }
         },
-        "Order": {
+        "Good": {
             "type": "object",
             "properties": {
-                "accrual": {
-                    "type": "number"
+                "description": {
+                    "type": "string"
                 },
-                "is_withdrawn": {
-                    "type": "boolean"
+                "price": {
+                    "type": "number"
+                }
+            }
+        },
+        "HealthCheckResult": {
+            "type": "object",
+            "properties": {
+                "details": {},
+                "error": {
+                    "type": "string"
                 },
-                "number": {
-                    "type": "string",
-                    "example": "12345678903"
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "HealthReport": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/HealthCheckResult"
+                    }
                 },
-                "processed_at": {
-                    "type": "string",
-                    "format": "date-time",
-                    "example": "2020-12-10T15:15:45+03:00"
+                "service": {
+                    "type": "string"
                 },
                 "status": {
-                    "$ref": "#/definitions/storagedefault.OrderStatus"
-                },
-                "sum": {
-                    "type": "number"
+                    "type": "string"
+                }
+            }
+        },
+        "Order": {
+            "type": "object",
+            "properties": {
+                "goods": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/Good"
+                    }
                 },
-                "uploaded_at": {
-                    "type": "string",
-                    "format": "date-time",
-                    "example": "2020-12-10T15:15:45+03:00"
+                "order": {
+                    "type": "string"
                 }
             }
         },
@@ -581,6 +805,40 @@ const docTemplate = `{
                 }
             }
         },
+        "Webhook": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "http://gophermart:8080/api/accrual/webhook"
+                }
+            }
+        },
+        "WebhookEvent": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "order-12345678903-processed"
+                },
+                "order": {
+                    "$ref": "#/definitions/storagedefault.Order"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "order.processed"
+                }
+            }
+        },
         "storageaccrual.RewardType": {
             "type": "string",
             "enum": [
@@ -15,45 +15,39 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/goods": {
+        "/api/accrual/webhook": {
             "post": {
-                "description": "Хендлер используется менеджерами для добавления механик вознаграждения за покупки\nПолученные системой расчёта начислений составы чеков проверяются на совпадение с зарегистрированными в данном хендлере вознаграждениями",
+                "description": "Подпись проверяется по заголовкам X-Webhook-Signature и X-Webhook-Timestamp\nПовторная доставка того же события не приводит к повторному начислению",
                 "consumes": [
                     "application/json"
                 ],
-                "produces": [
-                    "text/plain"
-                ],
                 "tags": [
-                    "Админ"
+                    "Сервис"
                 ],
-                "summary": "Регистрация информации о вознаграждении за товар",
+                "summary": "Прием событий о расчете начислений от Accrual System",
                 "parameters": [
                     {
-                        "description": "Механика вознаграждения",
-                        "name": "reward",
+                        "description": "Событие о заказе",
+                        "name": "event",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/Reward"
+                            "$ref": "#/definitions/WebhookEvent"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Вознаграждение успешно зарегистрировано",
-                        "schema": {
-                            "type": "string"
-                        }
+                        "description": "Событие принято"
                     },
                     "400": {
-                        "description": "Неверный формат запроса",
+                        "description": "Неверный формат события",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "409": {
-                        "description": "Ключ поиска уже зарегистрирован",
+                    "401": {
+                        "description": "Неверная подпись",
                         "schema": {
                             "type": "string"
                         }
@@ -67,45 +61,53 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/orders": {
+        "/api/admin/withdrawals/{login}/{order}/cancel": {
             "post": {
-                "description": "Для начисления баллов состав заказа должен быть проверен на совпадения с зарегистрированными записями вознаграждений за товары\nНачисляется сумма совпадений\nПринятый заказ не обязан браться в обработку непосредственно в момент получения запроса",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Служебный маршрут, нужен заголовок Authorization: Bearer \u003cadmin_token\u003e.\nУдержанные баллы возвращаются на доступный баланс: PENDING -\u003e CANCELLED",
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "Админ"
+                    "Служебные"
                 ],
-                "summary": "Регистрация нового совершённого заказа",
+                "summary": "Отмена списания магазином",
                 "parameters": [
                     {
-                        "description": "Регистрация нового совершённого заказа",
-                        "name": "reward",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/Order"
-                        }
+                        "type": "string",
+                        "description": "Логин пользователя",
+                        "name": "login",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Номер заказа списания",
+                        "name": "order",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "202": {
-                        "description": "Заказ успешно принят в обработку",
+                    "200": {
+                        "description": "Резерв снят",
+                        "schema": {
+                            "$ref": "#/definitions/Withdrawal"
+                        }
+                    },
+                    "401": {
+                        "description": "Неверный служебный токен",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "Неверный формат запроса",
+                    "404": {
+                        "description": "Списание не найдено",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "409": {
-                        "description": "Заказ уже принят в обработку",
+                        "description": "Списание не в статусе PENDING",
                         "schema": {
                             "type": "string"
                         }
@@ -119,43 +121,53 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/orders/{number}": {
-            "get": {
-                "description": "Получение информации о расчёте начислений баллов лояльности за совершённый заказ\nНомером заказа является последовательность цифр произвольной длины.\nНомер заказа может быть проверен на корректность ввода с помощью алгоритма Луна.",
-                "consumes": [
-                    "text/plain"
-                ],
+        "/api/admin/withdrawals/{login}/{order}/confirm": {
+            "post": {
+                "description": "Служебный маршрут, нужен заголовок Authorization: Bearer \u003cadmin_token\u003e.\nУдержанные баллы списываются окончательно: PENDING -\u003e PROCESSED",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Сервис"
+                    "Служебные"
                 ],
-                "summary": "Получение информации о расчёте начислений",
+                "summary": "Подтверждение списания магазином",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Номером заказа",
-                        "name": "number",
+                        "description": "Логин пользователя",
+                        "name": "login",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Номер заказа списания",
+                        "name": "order",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Успешная обработка запроса",
+                        "description": "Списание подтверждено",
                         "schema": {
-                            "$ref": "#/definitions/storagedefault.Order"
+                            "$ref": "#/definitions/Withdrawal"
                         }
                     },
-                    "204": {
-                        "description": "Заказ не зарегистрирован в системе расчёта",
+                    "401": {
+                        "description": "Неверный служебный токен",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "429": {
-                        "description": "Превышено количество запросов к сервису",
+                    "404": {
+                        "description": "Списание не найдено",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Списание не в статусе PENDING или резерв истек",
                         "schema": {
                             "type": "string"
                         }
@@ -169,24 +181,53 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/balance": {
-            "get": {
-                "description": "Хендлер доступен только авторизованному пользователю.\nВ ответе должны содержаться данные о текущей сумме баллов лояльности,\nа также сумме использованных за весь период регистрации баллов.",
+        "/api/admin/withdrawals/{login}/{order}/refund": {
+            "post": {
+                "description": "Служебный маршрут, нужен заголовок Authorization: Bearer \u003cadmin_token\u003e.\nПри возврате заказа баллы возвращаются на доступный баланс: PROCESSED -\u003e REFUNDED",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Пользователь"
+                    "Служебные"
+                ],
+                "summary": "Возврат списанных баллов магазином",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Логин пользователя",
+                        "name": "login",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Номер заказа списания",
+                        "name": "order",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Успешная обработка запроса",
+                        "description": "Баллы возвращены",
                         "schema": {
-                            "$ref": "#/definitions/Balance"
+                            "$ref": "#/definitions/Withdrawal"
                         }
                     },
                     "401": {
-                        "description": "Пользователь не авторизован",
+                        "description": "Неверный служебный токен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Списание не найдено",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Списание не в статусе PROCESSED",
                         "schema": {
                             "type": "string"
                         }
@@ -200,9 +241,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/balance/withdraw": {
+        "/api/goods": {
             "post": {
-                "description": "Хендлер доступен только авторизованному пользователю.\nНомер заказа представляет собой гипотетический номер\nнового заказа пользователя, в счёт оплаты которого списываются баллы.",
+                "description": "Хендлер используется менеджерами для добавления механик вознаграждения за покупки\nПолученные системой расчёта начислений составы чеков проверяются на совпадение с зарегистрированными в данном хендлере вознаграждениями",
                 "consumes": [
                     "application/json"
                 ],
@@ -210,29 +251,35 @@ const docTemplate = `{
                     "text/plain"
                 ],
                 "tags": [
-                    "Заказы"
+                    "Админ"
                 ],
-                "responses": {
-                    "200": {
-                        "description": "Успешная обработка запроса",
+                "summary": "Регистрация информации о вознаграждении за товар",
+                "parameters": [
+                    {
+                        "description": "Механика вознаграждения",
+                        "name": "reward",
+                        "in": "body",
+                        "required": true,
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/Reward"
                         }
-                    },
-                    "401": {
-                        "description": "Пользователь не авторизован",
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Вознаграждение успешно зарегистрировано",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "402": {
-                        "description": "На счету недостаточно средств",
+                    "400": {
+                        "description": "Неверный формат запроса",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "422": {
-                        "description": "Неверный номер заказа",
+                    "409": {
+                        "description": "Ключ поиска уже зарегистрирован",
                         "schema": {
                             "type": "string"
                         }
@@ -246,9 +293,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/login": {
+        "/api/orders": {
             "post": {
-                "description": "Для передачи аутентификационных данных используется механизм cookies",
+                "description": "Для начисления баллов состав заказа должен быть проверен на совпадения с зарегистрированными записями вознаграждений за товары\nНачисляется сумма совпадений\nПринятый заказ не обязан браться в обработку непосредственно в момент получения запроса",
                 "consumes": [
                     "application/json"
                 ],
@@ -256,23 +303,23 @@ const docTemplate = `{
                     "text/plain"
                 ],
                 "tags": [
-                    "Пользователь"
+                    "Админ"
                 ],
-                "summary": "Аутентификация пользователя",
+                "summary": "Регистрация нового совершённого заказа",
                 "parameters": [
                     {
-                        "description": "Логин и пароль зарегистрированного пользователя",
-                        "name": "creds",
+                        "description": "Регистрация нового совершённого заказа",
+                        "name": "reward",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/Creds"
+                            "$ref": "#/definitions/Order"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Пользователь успешно зарегистрирован и аутентифицирован",
+                    "202": {
+                        "description": "Заказ успешно принят в обработку",
                         "schema": {
                             "type": "string"
                         }
@@ -283,8 +330,8 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
-                    "401": {
-                        "description": "Неверная пара логин/пароль",
+                    "409": {
+                        "description": "Заказ уже принят в обработку",
                         "schema": {
                             "type": "string"
                         }
@@ -298,9 +345,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/orders": {
+        "/api/orders/{number}": {
             "get": {
-                "description": "Хендлер доступен только авторизованному пользователю\nНомера заказа в выдаче должны быть отсортированы по времени загрузки от самых старых к самым новым\nФормат даты — RFC3339.",
+                "description": "Получение информации о расчёте начислений баллов лояльности за совершённый заказ\nНомером заказа является последовательность цифр произвольной длины.\nНомер заказа может быть проверен на корректность ввода с помощью алгоритма Луна.",
                 "consumes": [
                     "text/plain"
                 ],
@@ -308,24 +355,61 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Заказы"
+                    "Сервис"
+                ],
+                "summary": "Получение информации о расчёте начислений",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Номером заказа",
+                        "name": "number",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Получение списка загруженных номеров заказов",
                 "responses": {
                     "200": {
                         "description": "Успешная обработка запроса",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/Order"
-                            }
+                            "$ref": "#/definitions/storagedefault.Order"
                         }
                     },
                     "204": {
-                        "description": "Нет данных для ответа",
+                        "description": "Заказ не зарегистрирован в системе расчёта",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "429": {
+                        "description": "Превышено количество запросов к сервису",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
                         "schema": {
                             "type": "string"
                         }
+                    }
+                }
+            }
+        },
+        "/api/user/balance": {
+            "get": {
+                "description": "Хендлер доступен только авторизованному пользователю.\nВ ответе должны содержаться данные о текущей сумме баллов лояльности,\nа также сумме использованных за весь период регистрации баллов.\nreserved - баллы, удержанные под неподтвержденные списания, в current они не входят.\nexpiring_soon - сколько из current скоро сгорит, expiring_at - срок ближайшей сгорающей партии.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Пользователь"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешная обработка запроса",
+                        "schema": {
+                            "$ref": "#/definitions/Balance"
+                        }
                     },
                     "401": {
                         "description": "Пользователь не авторизован",
@@ -340,65 +424,91 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/user/balance/reserve": {
             "post": {
-                "description": "Хендлер доступен только аутентифицированным пользователям\nНомером заказа является последовательность цифр произвольной длины",
+                "description": "Хендлер доступен только авторизованному пользователю.\nБаллы переходят из доступных в удержанные. Списание в статусе PENDING нужно\nподтвердить или отменить до expires_at, иначе резерв снимется сам.",
                 "consumes": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
                     "Заказы"
                 ],
-                "summary": "Загрузка номера заказа",
+                "summary": "Резерв баллов под списание",
                 "parameters": [
                     {
-                        "description": "Трек номер заказа",
-                        "name": "number",
+                        "description": "Номер заказа и сумма",
+                        "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/WithdrawRequest"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Номер заказа уже был загружен этим пользователем",
+                        "description": "Баллы удержаны",
+                        "schema": {
+                            "$ref": "#/definitions/Withdrawal"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса или сумма не больше нуля",
                         "schema": {
                             "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило списания"
+                            }
                         }
                     },
-                    "202": {
-                        "description": "Новый номер заказа принят в обработку",
+                    "401": {
+                        "description": "Пользователь не авторизован",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "400": {
-                        "description": "Неверный формат запроса",
+                    "402": {
+                        "description": "На счету недостаточно средств",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "401": {
-                        "description": "Пользователь не аутентифицирован",
+                    "403": {
+                        "description": "Превышен дневной или месячный лимит или списания запрещены после смены пароля",
                         "schema": {
                             "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило списания"
+                            }
                         }
                     },
                     "409": {
-                        "description": "Номер заказа уже был загружен другим пользователем",
+                        "description": "Списание в счет этого заказа уже было",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "422": {
-                        "description": "Неверный формат номера заказа",
+                        "description": "Неверный номер заказа или сумма вне допустимых границ",
                         "schema": {
                             "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило списания"
+                            }
                         }
                     },
                     "500": {
@@ -410,32 +520,810 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/register": {
+        "/api/user/balance/withdraw": {
             "post": {
-                "description": "Для передачи аутентификационных данных используется механизм cookies",
+                "description": "Хендлер доступен только авторизованному пользователю.\nНомер заказа представляет собой гипотетический номер\nнового заказа пользователя, в счёт оплаты которого списываются баллы.",
                 "consumes": [
                     "application/json"
                 ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Заказы"
+                ],
+                "parameters": [
+                    {
+                        "description": "Номер заказа и сумма",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/WithdrawRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешная обработка запроса",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса или сумма не больше нуля",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило списания"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "402": {
+                        "description": "На счету недостаточно средств",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Превышен дневной или месячный лимит или списания запрещены после смены пароля",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило списания"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Списание в счет этого заказа уже было",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Неверный номер заказа или сумма вне допустимых границ",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило списания"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/events": {
+            "get": {
+                "description": "Server-Sent Events: смена статуса заказа (event: order.status) и баланса (event: balance).\nВ data - объект Event, в id - его номер. После переподключения поток продолжается\nс события, следующего за Last-Event-ID (заголовок или параметр last_event_id).\nБез них приходят только новые события.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "Пользователи"
+                ],
+                "summary": "Поток событий пользователя",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Номер последнего полученного события",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "То же, для клиентов без доступа к заголовкам",
+                        "name": "last_event_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Поток событий",
+                        "schema": {
+                            "$ref": "#/definitions/Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный номер события",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/login": {
+            "post": {
+                "description": "Для передачи аутентификационных данных используется механизм cookies",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Пользователь"
+                ],
+                "summary": "Аутентификация пользователя",
+                "parameters": [
+                    {
+                        "description": "Логин и пароль зарегистрированного пользователя",
+                        "name": "creds",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/Creds"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пользователь успешно зарегистрирован и аутентифицирован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Неверная пара логин/пароль",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/orders": {
+            "get": {
+                "description": "Хендлер доступен только авторизованному пользователю\nНомера заказа в выдаче должны быть отсортированы по времени загрузки от самых старых к самым новым\nФормат даты — RFC3339.\nБез параметров возвращается весь список. С limit возвращается страница,\nкурсор следующей страницы приходит в заголовке X-Next-Cursor.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Заказы"
+                ],
+                "summary": "Получение списка загруженных номеров заказов",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы, от 1 до 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор из заголовка X-Next-Cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Статусы через запятую, например NEW,PROCESSING",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Загружены не раньше, RFC3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Загружены раньше, RFC3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Порядок по времени загрузки: asc или desc",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешная обработка запроса",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/Order"
+                            }
+                        },
+                        "headers": {
+                            "X-Next-Cursor": {
+                                "type": "string",
+                                "description": "Курсор следующей страницы, если она есть"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "Нет данных для ответа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверные параметры списка",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Хендлер доступен только аутентифицированным пользователям\nНомером заказа является последовательность цифр произвольной длины",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Заказы"
+                ],
+                "summary": "Загрузка номера заказа",
+                "parameters": [
+                    {
+                        "description": "Трек номер заказа",
+                        "name": "number",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Номер заказа уже был загружен этим пользователем",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "202": {
+                        "description": "Новый номер заказа принят в обработку",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не аутентифицирован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Номер заказа уже был загружен другим пользователем",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Неверный формат номера заказа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/password": {
+            "post": {
+                "description": "Хендлер доступен только авторизованному пользователю.\nПосле смены пароля списания на время запрещены, см. withdraw_password_cooldown.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Пользователь"
+                ],
+                "summary": "Смена пароля",
+                "parameters": [
+                    {
+                        "description": "Текущий и новый пароль",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/PasswordChangeRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пароль изменен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован или текущий пароль неверен",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/profile": {
+            "get": {
+                "description": "Хендлер доступен только авторизованному пользователю.\nУровень зависит от суммы за скользящий период и пересчитывается воркером периодически.\nmultiplier - во сколько раз увеличивается начисление по заказу,\nto_next - сколько осталось набрать до next_tier.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Пользователь"
+                ],
+                "summary": "Уровень лояльности пользователя",
+                "responses": {
+                    "200": {
+                        "description": "Успешная обработка запроса",
+                        "schema": {
+                            "$ref": "#/definitions/Profile"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/referrals": {
+            "get": {
+                "description": "Хендлер доступен только авторизованному пользователю.\ncode - код для поля referral_code при регистрации приглашенного.\nБонус обоим начисляется один раз, когда первый заказ приглашенного обработан.\nrejected - приглашенные, за которых бонус не положен, pending - еще без обработанного заказа,\nearned - сколько баллов принесли приглашения.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Пользователь"
+                ],
+                "summary": "Приглашения пользователя",
+                "responses": {
+                    "200": {
+                        "description": "Успешная обработка запроса",
+                        "schema": {
+                            "$ref": "#/definitions/ReferralStats"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/register": {
+            "post": {
+                "description": "Для передачи аутентификационных данных используется механизм cookies\nreferral_code - код пригласившего пользователя из /api/user/referrals, необязателен.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Пользователь"
+                ],
+                "summary": "Регистрация пользователя",
+                "parameters": [
+                    {
+                        "description": "Логин и пароль не зарегистрированного пользователя",
+                        "name": "creds",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Пользователь успешно зарегистрирован и аутентифицирован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса или неизвестный код приглашения",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Логин уже занят",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/transfer": {
+            "post": {
+                "description": "Хендлер доступен только авторизованному пользователю.\nБаллы переходят с доступного баланса отправителя на доступный баланс получателя\nв одной транзакции. Перевод виден обоим в истории /api/user/withdrawals:\nTRANSFER_OUT у отправителя и TRANSFER_IN у получателя.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
                     "Пользователь"
                 ],
-                "summary": "Регистрация пользователя",
+                "summary": "Перевод баллов другому пользователю",
+                "parameters": [
+                    {
+                        "description": "Логин получателя и сумма",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/TransferRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Перевод выполнен",
+                        "schema": {
+                            "$ref": "#/definitions/Transfer"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат запроса, сумма не больше нуля или перевод самому себе",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило перевода"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "402": {
+                        "description": "На счету недостаточно средств",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Превышен лимит, переводы запрещены после смены пароля или счет заблокирован",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило перевода"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Получатель не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Счет получателя заблокирован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Сумма вне допустимых границ",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "X-Withdrawal-Rule": {
+                                "type": "string",
+                                "description": "Нарушенное правило перевода"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/withdrawals": {
+            "get": {
+                "description": "Хендлер доступен только авторизованному пользователю.\nФакты выводов в выдаче должны быть отсортированы по времени вывода от самых старых к самым новым.\nФормат даты — RFC3339.\nБез параметров возвращается весь список. С limit возвращается страница,\nкурсор следующей страницы приходит в заголовке X-Next-Cursor.\nПереводы баллов идут в том же списке: type TRANSFER_OUT или TRANSFER_IN,\norder - номер перевода вида T42, counterparty - второй участник.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Заказы"
+                ],
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Размер страницы, от 1 до 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор из заголовка X-Next-Cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Статусы через запятую, например PENDING,PROCESSED",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Списаны не раньше, RFC3339",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Списаны раньше, RFC3339",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "asc",
+                            "desc"
+                        ],
+                        "type": "string",
+                        "description": "Порядок по времени списания: asc или desc",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешная обработка запроса",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/Withdrawal"
+                            }
+                        },
+                        "headers": {
+                            "X-Next-Cursor": {
+                                "type": "string",
+                                "description": "Курсор следующей страницы, если она есть"
+                            }
+                        }
+                    },
+                    "204": {
+                        "description": "Нет ни одного списания",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверные параметры списка",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/user/withdrawals/{order}/cancel": {
+            "post": {
+                "description": "Удержанные баллы возвращаются на доступный баланс: PENDING -\u003e CANCELLED",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Заказы"
+                ],
+                "summary": "Отмена списания",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Номер заказа списания",
+                        "name": "order",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Резерв снят",
+                        "schema": {
+                            "$ref": "#/definitions/Withdrawal"
+                        }
+                    },
+                    "401": {
+                        "description": "Пользователь не авторизован",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Списание не найдено",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Списание не в статусе PENDING",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/webhooks": {
+            "post": {
+                "description": "Когда заказ переходит в статус PROCESSED или INVALID, на указанный адрес отправляется POST с событием\nТело запроса подписывается HMAC-SHA256 с секретом подписки: заголовок X-Webhook-Signature от \"X-Webhook-Timestamp.тело\"\nПовторная подписка того же адреса обновляет секрет",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Админ"
+                ],
+                "summary": "Подписка на события о расчете начислений",
                 "parameters": [
                     {
-                        "description": "Логин и пароль не зарегистрированного пользователя",
-                        "name": "creds",
+                        "description": "Адрес и секрет подписки",
+                        "name": "webhook",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/Creds"
+                            "$ref": "#/definitions/Webhook"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Пользователь успешно зарегистрирован и аутентифицирован",
+                    "201": {
+                        "description": "Подписка зарегистрирована",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/Webhook"
                         }
                     },
                     "400": {
@@ -444,12 +1332,6 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
-                    "409": {
-                        "description": "Логин уже занят",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
                     "500": {
                         "description": "Внутренняя ошибка сервера",
                         "schema": {
@@ -459,30 +1341,39 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/user/withdrawals": {
-            "get": {
-                "description": "Хендлер доступен только авторизованному пользователю.\nФакты выводов в выдаче должны быть отсортированы по времени вывода от самых старых к самым новым.\nФормат даты — RFC3339.",
+        "/api/webhooks/{id}": {
+            "delete": {
                 "produces": [
-                    "application/json"
+                    "text/plain"
                 ],
                 "tags": [
-                    "Заказы"
+                    "Админ"
+                ],
+                "summary": "Удаление подписки на события",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Идентификатор подписки",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Успешная обработка запроса",
+                        "description": "Подписка удалена",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "204": {
-                        "description": "Нет ни одного списания",
+                    "400": {
+                        "description": "Неверный идентификатор",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "401": {
-                        "description": "Пользователь не авторизован",
+                    "404": {
+                        "description": "Подписка не найдена",
                         "schema": {
                             "type": "string"
                         }
@@ -496,6 +1387,25 @@ const docTemplate = `{
                 }
             }
         },
+        "/healthz": {
+            "get": {
+                "description": "Процесс жив и обслуживает http запросы. Зависимости не проверяются",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Разное"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/HealthReport"
+                        }
+                    }
+                }
+            }
+        },
         "/ping": {
             "get": {
                 "description": "Простая проверка состояния сервера",
@@ -508,6 +1418,37 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Хранилище недоступно",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Готовность принимать трафик: база данных, миграции, воркеры, очередь\n503 если недоступна критичная зависимость, degraded если некритичная",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Разное"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сервис готов",
+                        "schema": {
+                            "$ref": "#/definitions/HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Критичная зависимость недоступна",
+                        "schema": {
+                            "$ref": "#/definitions/HealthReport"
+                        }
                     }
                 }
             }
@@ -520,6 +1461,17 @@ const docTemplate = `{
                 "current": {
                     "type": "number"
                 },
+                "expiring_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "example": "2021-12-10T15:15:45+03:00"
+                },
+                "expiring_soon": {
+                    "type": "number"
+                },
+                "reserved": {
+                    "type": "number"
+                },
                 "withdrawn": {
                     "type": "number"
                 }
@@ -536,28 +1488,171 @@ const docTemplate = `{
                 }
             }
         },
-        "Good": {
+        "Event": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time"
+                },
+                "data": {
+                    "type": "object"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "$ref": "#/definitions/storagemart.EventType"
+                }
+            }
+        },
+        "HealthCheckResult": {
             "type": "object",
             "properties": {
-                "description": {
+                "details": {},
+                "error": {
                     "type": "string"
                 },
-                "price": {
-                    "type": "number"
+                "status": {
+                    "type": "string"
                 }
             }
         },
-        "Order": {
+        "HealthReport": {
             "type": "object",
             "properties": {
-                "goods": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/Good"
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/HealthCheckResult"
                     }
                 },
-                "order": {
+                "service": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "Order": {
+            "type": "object",
+            "properties": {
+                "accrual": {
+                    "type": "number"
+                },
+                "bonus": {
+                    "description": "Надбавка уровня лояльности сверх accrual",
+                    "type": "number"
+                },
+                "number": {
+                    "type": "string",
+                    "example": "12345678903"
+                },
+                "processed_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "example": "2020-12-10T15:15:45+03:00"
+                },
+                "status": {
+                    "$ref": "#/definitions/storagedefault.OrderStatus"
+                },
+                "uploaded_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "example": "2020-12-10T15:15:45+03:00"
+                }
+            }
+        },
+        "PasswordChangeRequest": {
+            "type": "object",
+            "properties": {
+                "new_password": {
+                    "type": "string"
+                },
+                "old_password": {
+                    "type": "string"
+                }
+            }
+        },
+        "Profile": {
+            "type": "object",
+            "properties": {
+                "login": {
+                    "type": "string"
+                },
+                "multiplier": {
+                    "type": "number",
+                    "example": 1.1
+                },
+                "next_threshold": {
+                    "type": "number",
+                    "example": 5000
+                },
+                "next_tier": {
+                    "description": "Следующий уровень, его порог и сколько осталось набрать. Нет на высшем уровне",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storagemart.Tier"
+                        }
+                    ],
+                    "example": "GOLD"
+                },
+                "score": {
+                    "description": "Сумма за скользящий период, по которой считается уровень",
+                    "type": "number",
+                    "example": 1500
+                },
+                "tier": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storagemart.Tier"
+                        }
+                    ],
+                    "example": "SILVER"
+                },
+                "to_next": {
+                    "type": "number",
+                    "example": 3500
+                }
+            }
+        },
+        "ReferralStats": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "K3QF7ZR2XA"
+                },
+                "earned": {
+                    "type": "number"
+                },
+                "invited": {
+                    "type": "integer"
+                },
+                "pending": {
+                    "type": "integer"
+                },
+                "rejected": {
+                    "type": "integer"
+                },
+                "rewarded": {
+                    "type": "integer"
+                }
+            }
+        },
+        "RegisterRequest": {
+            "type": "object",
+            "properties": {
+                "login": {
+                    "type": "string"
+                },
+                "password": {
                     "type": "string"
+                },
+                "referral_code": {
+                    "type": "string",
+                    "example": "K3QF7ZR2XA"
                 }
             }
         },
@@ -575,6 +1670,127 @@ const docTemplate = `{
                 }
             }
         },
+        "Transfer": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "example": "2020-12-10T15:15:45+03:00"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "sum": {
+                    "type": "number"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "TransferRequest": {
+            "type": "object",
+            "properties": {
+                "sum": {
+                    "type": "number",
+                    "example": 100
+                },
+                "to": {
+                    "type": "string",
+                    "example": "family"
+                }
+            }
+        },
+        "Webhook": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "http://gophermart:8080/api/accrual/webhook"
+                }
+            }
+        },
+        "WebhookEvent": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "order-12345678903-processed"
+                },
+                "order": {
+                    "$ref": "#/definitions/storagedefault.Order"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "order.processed"
+                }
+            }
+        },
+        "WithdrawRequest": {
+            "type": "object",
+            "properties": {
+                "order": {
+                    "type": "string",
+                    "example": "2377225624"
+                },
+                "sum": {
+                    "type": "number",
+                    "example": 751
+                }
+            }
+        },
+        "Withdrawal": {
+            "type": "object",
+            "properties": {
+                "counterparty": {
+                    "description": "Второй участник перевода",
+                    "type": "string",
+                    "example": "family"
+                },
+                "expires_at": {
+                    "description": "До какого момента действует резерв, только для PENDING",
+                    "type": "string",
+                    "format": "date-time",
+                    "example": "2020-12-10T15:30:45+03:00"
+                },
+                "order": {
+                    "type": "string",
+                    "example": "12345678903"
+                },
+                "processed_at": {
+                    "type": "string",
+                    "format": "date-time",
+                    "example": "2020-12-10T15:15:45+03:00"
+                },
+                "status": {
+                    "$ref": "#/definitions/storagemart.WithdrawalStatus"
+                },
+                "sum": {
+                    "type": "number"
+                },
+                "type": {
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/storagemart.HistoryType"
+                        }
+                    ],
+                    "example": "WITHDRAWAL"
+                }
+            }
+        },
         "storageaccrual.RewardType": {
             "type": "string",
             "enum": [
@@ -617,6 +1833,60 @@ const docTemplate = `{
                 "StatusInvalid",
                 "StatusProcessed"
             ]
+        },
+        "storagemart.EventType": {
+            "type": "string",
+            "enum": [
+                "order.status",
+                "balance"
+            ],
+            "x-enum-varnames": [
+                "EventOrderStatus",
+                "EventBalance"
+            ]
+        },
+        "storagemart.HistoryType": {
+            "type": "string",
+            "enum": [
+                "WITHDRAWAL",
+                "TRANSFER_OUT",
+                "TRANSFER_IN"
+            ],
+            "x-enum-varnames": [
+                "HistoryWithdrawal",
+                "HistoryTransferOut",
+                "HistoryTransferIn"
+            ]
+        },
+        "storagemart.Tier": {
+            "type": "string",
+            "enum": [
+                "BRONZE",
+                "SILVER",
+                "GOLD"
+            ],
+            "x-enum-varnames": [
+                "TierBronze",
+                "TierSilver",
+                "TierGold"
+            ]
+        },
+        "storagemart.WithdrawalStatus": {
+            "type": "string",
+            "enum": [
+                "PENDING",
+                "PROCESSED",
+                "CANCELLED",
+                "EXPIRED",
+                "REFUNDED"
+            ],
+            "x-enum-varnames": [
+                "WithdrawalPending",
+                "WithdrawalProcessed",
+                "WithdrawalCancelled",
+                "WithdrawalExpired",
+                "WithdrawalRefunded"
+            ]
         }
     }
 }`
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/lib/logger"
 )
 
 const (
@@ -37,6 +38,7 @@ func GetUserCookie(userLogin, key string) *http.Cookie {
 }
 
 // ValidateUserCookie проверяет подлинность куки и возвращает идентификатор пользователя.
+// Логин пользователя добавляется в контекст запроса для логов.
 func ValidateUserCookie(c echo.Context, key string) (string, bool) {
 	cookie, err := c.Cookie(CookieName)
 	if err != nil {
@@ -53,6 +55,8 @@ func ValidateUserCookie(c echo.Context, key string) (string, bool) {
 
 	expectedSignature := SignUser(userLogin, key)
 	if hmac.Equal([]byte(expectedSignature), []byte(signature)) {
+		ctx := logger.WithLogin(c.Request().Context(), userLogin)
+		c.SetRequest(c.Request().WithContext(ctx))
 		return userLogin, true
 	}
 
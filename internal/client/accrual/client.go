@@ -0,0 +1,318 @@
+package clientaccrual
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/metrics"
+	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/lib/breaker"
+	"github.com/mi4r/gophermart/lib/logger"
+	"github.com/mi4r/gophermart/lib/ratelimit"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// Заголовок корреляции запросов между сервисами
+	headerRequestID = "X-Request-ID"
+	// Пауза, если Accrual System вернул 429 без корректного Retry-After
+	defaultRetryAfter = time.Minute
+	// Сколько тела ответа сохранять в ошибке
+	maxErrorBody = 512
+	// Служебные маршруты подписок, требуют токен
+	webhooksPath = "/api/webhooks"
+)
+
+// Client - типизированный клиент API Accrual System
+type Client struct {
+	address    string
+	httpClient *http.Client
+	limiter    *ratelimit.Bucket
+	breaker    *breaker.Breaker
+	// Токен служебных маршрутов, нужен для подписки на вебхуки
+	adminToken string
+}
+
+type Option func(*Client)
+
+// WithTimeout задает таймаут одного запроса
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithHTTPClient подменяет http клиент, например для тестов
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithLimiter включает общий клиентский лимитер.
+// Перед каждым запросом клиент ждет токен, а при 429 ставит лимитер на паузу
+func WithLimiter(limiter *ratelimit.Bucket) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// WithBreaker включает предохранитель: после серии сетевых ошибок и 5xx
+// клиент перестает обращаться к Accrual System и сразу возвращает ErrCircuitOpen
+func WithBreaker(b *breaker.Breaker) Option {
+	return func(c *Client) {
+		c.breaker = b
+	}
+}
+
+// WithAdminToken задает токен служебных маршрутов Accrual System.
+// Он уходит в заголовке Authorization с запросами подписки на вебхуки
+func WithAdminToken(token string) Option {
+	return func(c *Client) {
+		c.adminToken = token
+	}
+}
+
+// New создает клиента. Адрес без схемы считается http адресом
+func New(address string, opts ...Option) *Client {
+	address = strings.TrimRight(address, "/")
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	c := &Client{
+		address: address,
+		httpClient: &http.Client{
+			Timeout: defaultTimeout,
+			// Спан на каждый запрос и передача traceparent в Accrual System
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Address возвращает базовый адрес Accrual System
+func (c *Client) Address() string {
+	return c.address
+}
+
+// GetOrder получает информацию о расчете начислений по заказу
+func (c *Client) GetOrder(ctx context.Context, number string) (storagedefault.Order, error) {
+	var order storagedefault.Order
+	resp, err := c.do(ctx, http.MethodGet, "/api/orders/"+url.PathEscape(number), nil)
+	if err != nil {
+		return order, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return order, ErrOrderNotFound
+	default:
+		return order, responseError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&order); err != nil {
+		return order, fmt.Errorf("decode accrual order: %w", err)
+	}
+	return order, nil
+}
+
+// RegisterOrder регистрирует новый совершенный заказ
+func (c *Client) RegisterOrder(ctx context.Context, order storageaccrual.Order) error {
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/orders", order)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// CreateReward регистрирует механику вознаграждения за товар
+func (c *Client) CreateReward(ctx context.Context, reward storageaccrual.Reward) error {
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/goods", reward)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// Subscribe подписывает адрес на вебхуки о завершении расчета
+func (c *Client) Subscribe(ctx context.Context, callbackURL, secret string) (storageaccrual.Webhook, error) {
+	var webhook storageaccrual.Webhook
+	resp, err := c.doJSON(ctx, http.MethodPost, webhooksPath, storageaccrual.Webhook{
+		URL:    callbackURL,
+		Secret: secret,
+	})
+	if err != nil {
+		return webhook, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return webhook, responseError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&webhook); err != nil {
+		return webhook, fmt.Errorf("decode accrual webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// Unsubscribe удаляет подписку на вебхуки
+func (c *Client) Unsubscribe(ctx context.Context, id int64) error {
+	resp, err := c.do(ctx, http.MethodDelete, webhooksPath+"/"+strconv.FormatInt(id, 10), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// Ping проверяет доступность Accrual System через /healthz.
+// Не расходует токены лимитера и не влияет на предохранитель
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.address+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(ctx, method, path, b)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if c.breaker != nil {
+		if err := c.breaker.Allow(); err != nil {
+			return nil, ErrCircuitOpen
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+path, bytes.NewReader(body))
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// Токен нужен только подпискам, в запросы заказов он не уходит
+	if c.adminToken != "" && strings.HasPrefix(path, webhooksPath) {
+		req.Header.Set("Authorization", "Bearer "+c.adminToken)
+	}
+	// Один X-Request-ID в логах gophermart и accrual
+	if id := logger.RequestID(ctx); id != "" {
+		req.Header.Set(headerRequestID, id)
+	}
+
+	slog.DebugContext(ctx, "accrual request", slog.String("method", method), slog.String("path", path))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Запрос отменил вызывающий - о здоровье сервиса это ничего не говорит
+			c.release()
+		} else {
+			c.failure()
+		}
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		c.failure()
+	} else {
+		c.success()
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		metrics.AccrualClientRateLimitedTotal.Inc()
+		retryAfter, err := ratelimit.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if err != nil {
+			slog.Warn("parse retry-after header error", slog.String("err", err.Error()))
+			retryAfter = defaultRetryAfter
+		}
+		if c.limiter != nil {
+			c.limiter.Pause(retryAfter)
+		}
+		return nil, &RateLimitError{RetryAfter: retryAfter}
+	}
+	return resp, nil
+}
+
+func (c *Client) success() {
+	if c.breaker != nil {
+		c.breaker.Success()
+	}
+}
+
+func (c *Client) failure() {
+	if c.breaker != nil {
+		c.breaker.Failure()
+	}
+}
+
+func (c *Client) release() {
+	if c.breaker != nil {
+		c.breaker.Release()
+	}
+}
+
+// responseError превращает неожиданный ответ в типизированную ошибку
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return ErrAlreadyExists
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return &ServerError{StatusCode: resp.StatusCode, Body: string(body)}
+	default:
+		return &ResponseError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+}
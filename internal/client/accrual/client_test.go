@@ -0,0 +1,112 @@
+package clientaccrual
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+)
+
+func TestClient_GetOrder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/orders/12345678903", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"number":"12345678903","status":"PROCESSED","accrual":500}`))
+	})
+	mux.HandleFunc("/api/orders/4561261212345467", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/api/orders/79927398713", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/api/orders/2377225624", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := New(srv.URL, WithTimeout(time.Second))
+
+	t.Run("processed", func(t *testing.T) {
+		order, err := client.GetOrder(context.Background(), "12345678903")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := storagedefault.Order{Number: "12345678903", Status: storagedefault.StatusProcessed, Accrual: 500}
+		if order != want {
+			t.Errorf("GetOrder() = %+v, want %+v", order, want)
+		}
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		_, err := client.GetOrder(context.Background(), "4561261212345467")
+		if !errors.Is(err, ErrOrderNotFound) {
+			t.Errorf("GetOrder() error = %v, want %v", err, ErrOrderNotFound)
+		}
+	})
+
+	t.Run("rate_limited", func(t *testing.T) {
+		_, err := client.GetOrder(context.Background(), "79927398713")
+		var rateErr *RateLimitError
+		if !errors.As(err, &rateErr) {
+			t.Fatalf("GetOrder() error = %v, want RateLimitError", err)
+		}
+		if rateErr.RetryAfter != time.Minute {
+			t.Errorf("RetryAfter = %v, want %v", rateErr.RetryAfter, time.Minute)
+		}
+	})
+
+	t.Run("server_error", func(t *testing.T) {
+		_, err := client.GetOrder(context.Background(), "2377225624")
+		var srvErr *ServerError
+		if !errors.As(err, &srvErr) {
+			t.Fatalf("GetOrder() error = %v, want ServerError", err)
+		}
+		if srvErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("StatusCode = %d, want %d", srvErr.StatusCode, http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestNew_AddressWithoutScheme(t *testing.T) {
+	client := New("accrual:8080/")
+	if got, want := client.Address(), "http://accrual:8080"; got != want {
+		t.Errorf("Address() = %s, want %s", got, want)
+	}
+}
+
+func TestClient_AdminToken(t *testing.T) {
+	auth := make(map[string]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		auth[r.URL.Path] = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1,"url":"http://gophermart/api/accrual/webhook"}`))
+	})
+	mux.HandleFunc("/api/orders/12345678903", func(w http.ResponseWriter, r *http.Request) {
+		auth[r.URL.Path] = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := New(srv.URL, WithAdminToken("token"))
+	if _, err := client.Subscribe(context.Background(), "http://gophermart/api/accrual/webhook", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	client.GetOrder(context.Background(), "12345678903")
+
+	// Токен уходит только служебным маршрутам
+	if got := auth["/api/webhooks"]; got != "Bearer token" {
+		t.Errorf("subscribe Authorization = %q, want Bearer token", got)
+	}
+	if got := auth["/api/orders/12345678903"]; got != "" {
+		t.Errorf("order Authorization = %q, want empty", got)
+	}
+}
@@ -0,0 +1,50 @@
+package clientaccrual
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mi4r/gophermart/lib/breaker"
+)
+
+var (
+	// ErrOrderNotFound - заказ не зарегистрирован в системе расчета (204)
+	ErrOrderNotFound = errors.New("order not registered in accrual system")
+	// ErrAlreadyExists - заказ или ключ вознаграждения уже зарегистрирован (409)
+	ErrAlreadyExists = errors.New("already exists in accrual system")
+	// ErrNotFound - запрошенный ресурс не найден (404)
+	ErrNotFound = errors.New("not found in accrual system")
+	// ErrCircuitOpen - предохранитель разомкнут, запрос не отправлялся
+	ErrCircuitOpen = breaker.ErrOpen
+)
+
+// RateLimitError - Accrual System вернул 429
+type RateLimitError struct {
+	// Сколько нужно подождать перед следующим запросом
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("accrual system rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// ServerError - Accrual System вернул 5xx
+type ServerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("accrual system error: status %d: %s", e.StatusCode, e.Body)
+}
+
+// ResponseError - любой другой неожиданный ответ, например 400
+type ResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("unexpected accrual system response: status %d: %s", e.StatusCode, e.Body)
+}
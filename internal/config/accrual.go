@@ -1,47 +1,135 @@
 package config
 
 import (
-	"flag"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 )
 
 type AccrualConfig struct {
-	ListenAddr  string
-	DriverType  string
-	LogLevel    string
-	StoragePath string
-	RateLimit   int
+	ListenAddr  string `yaml:"run_address" toml:"run_address" env:"RUN_ADDRESS" flag:"a" usage:"Listen address with port"`
+	StoragePath string `yaml:"database_uri" toml:"database_uri" env:"DATABASE_URI" flag:"d" usage:"Path to store" secret:"url"`
+	// Применять новые миграции при запуске. Если выключено, сервис не стартует на отставшей схеме
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate" env:"AUTO_MIGRATE" flag:"am" usage:"Apply pending migrations on startup"`
+	// Запросов в секунду на клиента и запас
+	RateLimit int `yaml:"rate_limit" toml:"rate_limit" env:"RATE_LIMIT" flag:"rl" usage:"Requests per second limit per client" reload:"true"`
+	RateBurst int `yaml:"rate_burst" toml:"rate_burst" env:"RATE_BURST" flag:"rb" usage:"Requests burst per client" reload:"true"`
+	// Период отправки вебхуков и число попыток до dead-letter
+	WebhookInterval    time.Duration `yaml:"webhook_interval" toml:"webhook_interval" env:"WEBHOOK_INTERVAL" flag:"wi" usage:"Webhook dispatch interval"`
+	WebhookMaxAttempts int           `yaml:"webhook_max_attempts" toml:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" flag:"wa" usage:"Webhook delivery attempts before dead letter"`
+	// Хосты адресов подписок через запятую. Пусто - любые, кроме служебных адресов
+	WebhookHosts string `yaml:"webhook_hosts" toml:"webhook_hosts" env:"WEBHOOK_HOSTS" flag:"wh" usage:"Comma separated hosts allowed in webhook callback URLs"`
+	// Токен маршрутов подписок на вебхуки, пусто - подписки отключены
+	AdminToken string `yaml:"admin_token" toml:"admin_token" env:"ADMIN_TOKEN" flag:"at" usage:"Bearer token for /api/webhooks routes" secret:"true"`
+	// Сколько ждать завершения запросов и воркеров при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"st" usage:"Graceful shutdown timeout"`
+	// Размер очереди задач расчета и число воркеров
+	WorkerPoolSize int `yaml:"worker_pool_size" toml:"worker_pool_size" env:"WORKER_POOL_SIZE" flag:"wp" usage:"Accrual worker pool size" reload:"true"`
+	QueueSize      int `yaml:"queue_size" toml:"queue_size" env:"QUEUE_SIZE" flag:"qs" usage:"Accrual task queue size"`
+	LogConfig      `yaml:",inline"`
+	TraceConfig    `yaml:",inline"`
+
+	// Вычисляется из StoragePath
+	DriverType string `yaml:"-" toml:"-"`
+	// Параметры загрузки
+	Meta Meta `yaml:"-" toml:"-"`
 }
 
-func NewAccrualConfig() AccrualConfig {
-	return loadAccSysConfigFromFlags()
+func defaultAccrualConfig() AccrualConfig {
+	return AccrualConfig{
+		ListenAddr:  "localhost:8081",
+		AutoMigrate: true,
+		// 5 запросов в секунду на клиента, с запасом в 60 запросов
+		RateLimit:          5,
+		RateBurst:          60,
+		WebhookInterval:    5 * time.Second,
+		WebhookMaxAttempts: 10,
+		ShutdownTimeout:    10 * time.Second,
+		QueueSize:          100,
+		WorkerPoolSize:     1,
+		LogConfig:          defaultLogConfig(),
+		TraceConfig:        defaultTraceConfig(),
+	}
 }
 
-// Первым делом парсим из окружения
-func loadAccrualConfigFromEnv() AccrualConfig {
-	var c AccrualConfig
-	c.ListenAddr = os.Getenv("RUN_ADDRESS")
-	c.StoragePath = os.Getenv("DATABASE_URI")
-	return c
+// NewAccrualConfig собирает конфигурацию из аргументов командной строки и окружения
+func NewAccrualConfig() (AccrualConfig, error) {
+	return LoadAccrualConfig(os.Args[1:], os.Getenv)
 }
 
-// Затем парсим из флагов. Если есть из флага то заменяем
-func loadAccSysConfigFromFlags() AccrualConfig {
-	confFromEnv := loadAccrualConfigFromEnv()
-	var c AccrualConfig
-	d := flag.String("d", "", "Path to store")
-	l := flag.String("l", "debug", "Logger Level")
-	a := flag.String("a", "", "Listen address with port")
-	flag.Parse()
+// LoadAccrualConfig: значения по умолчанию -> файл -> окружение -> флаги
+func LoadAccrualConfig(args []string, getenv func(string) string) (AccrualConfig, error) {
+	c := defaultAccrualConfig()
+	meta, err := load("accrual", &c, args, getenv)
+	if err != nil {
+		return c, err
+	}
+	c.Meta = meta
+	c.DriverType = parseDriverType(c.StoragePath)
+	return c, c.Validate()
+}
 
-	c.StoragePath = ifEmpty(*d, confFromEnv.StoragePath)
-	c.ListenAddr = ifEmpty(*a, confFromEnv.ListenAddr)
+// Redacted возвращает итоговую конфигурацию в YAML со скрытыми секретами
+func (c AccrualConfig) Redacted() (string, error) {
+	return redactedYAML(c)
+}
 
-	c.DriverType = parseDriverType(c.StoragePath)
-	c.LogLevel = *l
+// Reload заново собирает конфигурацию с теми же аргументами командной строки
+func (c AccrualConfig) Reload() (AccrualConfig, error) {
+	return LoadAccrualConfig(c.Meta.args, os.Getenv)
+}
+
+// Diff возвращает измененные поля: применяемые на лету и требующие перезапуска
+func (c AccrualConfig) Diff(next AccrualConfig) (reloadable, restart []string) {
+	return diffFields(c, next)
+}
 
-	// 5 запросов в минуту
-	c.RateLimit = 5
+// WebhookHostList возвращает разрешенные хосты подписок в нижнем регистре
+func (c AccrualConfig) WebhookHostList() []string {
+	var hosts []string
+	for _, host := range strings.Split(c.WebhookHosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
 
-	return c
+// Validate проверяет конфигурацию. Возвращает все найденные ошибки сразу
+func (c AccrualConfig) Validate() error {
+	var errs []error
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("run_address: required"))
+	}
+	if err := validateStorage(c.StoragePath, c.DriverType); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RateLimit <= 0 {
+		errs = append(errs, errors.New("rate_limit: must be positive"))
+	}
+	if c.RateBurst <= 0 {
+		errs = append(errs, errors.New("rate_burst: must be positive"))
+	}
+	if c.WebhookInterval <= 0 {
+		errs = append(errs, errors.New("webhook_interval: must be positive"))
+	}
+	if c.WebhookMaxAttempts <= 0 {
+		errs = append(errs, errors.New("webhook_max_attempts: must be positive"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout: must be positive"))
+	}
+	if c.WorkerPoolSize <= 0 {
+		errs = append(errs, errors.New("worker_pool_size: must be positive"))
+	}
+	if c.QueueSize <= 0 {
+		errs = append(errs, errors.New("queue_size: must be positive"))
+	}
+	errs = append(errs, c.LogConfig.validate(), c.TraceConfig.validate())
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid accrual config:\n%w", err)
+	}
+	return nil
 }
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(m map[string]string) func(string) string {
+	return func(key string) string { return m[key] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadGophermartConfig_Layers(t *testing.T) {
+	file := writeFile(t, "gophermart.yaml", `
+run_address: file:8080
+database_uri: postgres://file
+accrual_system_address: http://file
+secret_key: from-file
+ticker_time: 30s
+log_level: warn
+`)
+
+	c, err := LoadGophermartConfig(
+		[]string{"-c", file, "-t", "1m"},
+		env(map[string]string{
+			"RUN_ADDRESS": "env:8080",
+			"SECRET_KEY":  "from-env",
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Флаг перекрывает файл
+	if c.TickerTime != time.Minute {
+		t.Errorf("TickerTime = %v", c.TickerTime)
+	}
+	// Окружение перекрывает файл
+	if c.ListenAddr != "env:8080" || c.SecretKey != "from-env" {
+		t.Errorf("ListenAddr = %q, SecretKey = %q", c.ListenAddr, c.SecretKey)
+	}
+	// Из файла
+	if c.StoragePath != "postgres://file" || c.LogLevel != "warn" {
+		t.Errorf("StoragePath = %q, LogLevel = %q", c.StoragePath, c.LogLevel)
+	}
+	// По умолчанию
+	if c.BreakerThreshold != 5 || c.LogFormat != "pretty" {
+		t.Errorf("BreakerThreshold = %d, LogFormat = %q", c.BreakerThreshold, c.LogFormat)
+	}
+	// Программа приглашений включается только явно
+	if c.ReferralProgram().Enabled() {
+		t.Errorf("referral program enabled by default: %+v", c.ReferralProgram())
+	}
+	if c.DriverType != DriverPostgres {
+		t.Errorf("DriverType = %q", c.DriverType)
+	}
+}
+
+func TestLoadAccrualConfig_TOML(t *testing.T) {
+	file := writeFile(t, "accrual.toml", `
+database_uri = "postgres://file"
+rate_limit = 20
+webhook_interval = "2s"
+`)
+
+	c, err := LoadAccrualConfig([]string{"-rb", "100"}, env(map[string]string{"CONFIG_FILE": file}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RateLimit != 20 || c.RateBurst != 100 || c.WebhookInterval != 2*time.Second {
+		t.Errorf("RateLimit = %d, RateBurst = %d, WebhookInterval = %v", c.RateLimit, c.RateBurst, c.WebhookInterval)
+	}
+}
+
+func TestLoadGophermartConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "empty",
+			want: []string{"database_uri", "accrual_system_address", "secret_key"},
+		},
+		{
+			name: "invalid values",
+			args: []string{
+				"-d", "mysql://db", "-r", "accrual", "-k", "secret",
+				"-t", "0s", "-l", "trace", "-te", "file", "-wu", "http://hook",
+			},
+			want: []string{"unsupported driver", "ticker_time", "log_level", "trace_file", "webhook_secret"},
+		},
+		{
+			name: "withdraw rules",
+			args: []string{
+				"-d", "postgres://db", "-r", "accrual", "-k", "secret",
+				"-wmn", "100", "-wmx", "10", "-wdl", "500", "-wml", "100", "-wpc", "-1h",
+			},
+			want: []string{"withdraw_min", "withdraw_daily_limit", "withdraw_password_cooldown"},
+		},
+		{
+			name: "transfer limits",
+			args: []string{
+				"-d", "postgres://db", "-r", "accrual", "-k", "secret",
+				"-tfn", "100", "-tfx", "10", "-tfd", "-1",
+			},
+			want: []string{"transfer_min", "transfer limits"},
+		},
+		{
+			name: "referral program",
+			args: []string{
+				"-d", "postgres://db", "-r", "accrual", "-k", "secret",
+				"-rrb", "-1", "-rmx", "-1",
+			},
+			want: []string{"referral bonuses", "referral_max_rewards"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadGophermartConfig(tt.args, env(nil))
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig_UnknownFileKey(t *testing.T) {
+	file := writeFile(t, "accrual.yaml", "rate_limits: 1\n")
+	if _, err := LoadAccrualConfig([]string{"-c", file, "-d", "postgres://db"}, env(nil)); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c, err := LoadGophermartConfig(
+		[]string{"-d", "postgres://user:pass@db/mart", "-r", "accrual", "-k", "jwt-secret", "--print-config"},
+		env(nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Meta.PrintConfig {
+		t.Error("PrintConfig = false")
+	}
+
+	out, err := c.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"jwt-secret", "pass@"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output contains secret %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "postgres://user:xxxxx@db/mart") {
+		t.Errorf("database_uri not redacted:\n%s", out)
+	}
+}
+
+func TestGophermartConfig_Reload(t *testing.T) {
+	file := writeFile(t, "gophermart.yaml", `
+database_uri: postgres://db
+accrual_system_address: http://accrual
+secret_key: secret
+`)
+	args := []string{"-c", file}
+	c, err := LoadGophermartConfig(args, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(file, []byte(`
+database_uri: postgres://db
+accrual_system_address: http://accrual
+secret_key: secret
+ticker_time: 1s
+log_level: error
+run_address: localhost:9090
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	next, err := c.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadable, restart := c.Diff(next)
+	if strings.Join(reloadable, ",") != "ticker_time,log_level" {
+		t.Errorf("reloadable = %v", reloadable)
+	}
+	if strings.Join(restart, ",") != "run_address" {
+		t.Errorf("restart = %v", restart)
+	}
+
+	// Неверная конфигурация отклоняется
+	if err := os.WriteFile(file, []byte("secret_key: \"\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Reload(); err == nil {
+		t.Error("expected error for invalid config")
+	}
+}
+
+func TestWatch_FileChanged(t *testing.T) {
+	file := writeFile(t, "accrual.yaml", "rate_limit: 1\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan string, 1)
+	go Watch(ctx, file, 10*time.Millisecond, func(reason string) {
+		reloaded <- reason
+	})
+
+	// Время изменения файла должно отличаться от исходного
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(file, []byte("rate_limit: 2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("reload was not called")
+	}
+}
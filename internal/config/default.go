@@ -1,6 +1,10 @@
 package config
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 const (
 	DriverPostgres = "postgres"
@@ -14,10 +18,12 @@ func parseDriverType(path string) string {
 	return strings.Split(path, ":")[0]
 }
 
-func ifEmpty(fromFlag, fromEnv string) string {
-	// Если пусто во флаге, то вернем из окружения
-	if fromFlag == "" {
-		return fromEnv
+func validateStorage(path, driver string) error {
+	if path == "" {
+		return errors.New("database_uri: required, set -d or DATABASE_URI")
+	}
+	if driver != DriverPostgres && driver != "postgresql" {
+		return fmt.Errorf("database_uri: unsupported driver %q, want %s://", driver, DriverPostgres)
 	}
-	return fromFlag
+	return nil
 }
@@ -1,53 +1,161 @@
 package config
 
 import (
-	"flag"
+	"errors"
+	"fmt"
 	"os"
 	"time"
 )
 
 type GophermartConfig struct {
-	ListenAddr           string
-	DriverType           string
-	LogLevel             string
-	StoragePath          string
-	AccrualSystemAddress string
-	SecretKey            string
-	TickerTime           time.Duration
-}
-
-func NewGophermartConfig() GophermartConfig {
-	return loadGophermartFromFlags()
-}
-
-// Первым делом парсим из окружения
-func loadGophermartFromEnv() GophermartConfig {
-	var c GophermartConfig
-	c.ListenAddr = os.Getenv("RUN_ADDRESS")
-	c.StoragePath = os.Getenv("DATABASE_URI")
-	c.AccrualSystemAddress = os.Getenv("ACCRUAL_SYSTEM_ADDRESS")
-	c.SecretKey = os.Getenv("SECRET_KEY")
-	return c
-}
-
-// Затем парсим из флагов. Если есть из флага то заменяем
-func loadGophermartFromFlags() GophermartConfig {
-	confFromEnv := loadGophermartFromEnv()
-	var c GophermartConfig
-	d := flag.String("d", "", "Path to store")
-	l := flag.String("l", "debug", "Logger Level")
-	a := flag.String("a", "", "Listen address with port")
-	r := flag.String("r", "", "Accrual system address")
-	k := flag.String("k", "", "Secret key for JWT")
-	t := flag.Duration("t", 10*time.Second, "Ticker time")
-	flag.Parse()
-
-	c.StoragePath = ifEmpty(*d, confFromEnv.StoragePath)
-	c.ListenAddr = ifEmpty(*a, confFromEnv.ListenAddr)
-	c.AccrualSystemAddress = ifEmpty(*r, confFromEnv.AccrualSystemAddress)
+	ListenAddr  string `yaml:"run_address" toml:"run_address" env:"RUN_ADDRESS" flag:"a" usage:"Listen address with port"`
+	StoragePath string `yaml:"database_uri" toml:"database_uri" env:"DATABASE_URI" flag:"d" usage:"Path to store" secret:"url"`
+	// Применять новые миграции при запуске. Если выключено, сервис не стартует на отставшей схеме
+	AutoMigrate          bool          `yaml:"auto_migrate" toml:"auto_migrate" env:"AUTO_MIGRATE" flag:"am" usage:"Apply pending migrations on startup"`
+	AccrualSystemAddress string        `yaml:"accrual_system_address" toml:"accrual_system_address" env:"ACCRUAL_SYSTEM_ADDRESS" flag:"r" usage:"Accrual system address"`
+	SecretKey            string        `yaml:"secret_key" toml:"secret_key" env:"SECRET_KEY" flag:"k" usage:"Secret key for JWT" secret:"true"`
+	TickerTime           time.Duration `yaml:"ticker_time" toml:"ticker_time" env:"TICKER_TIME" flag:"t" usage:"Ticker time" reload:"true"`
+	// Ограничение запросов к Accrual System в секунду
+	AccrualRateLimit int `yaml:"accrual_rate_limit" toml:"accrual_rate_limit" env:"ACCRUAL_RATE_LIMIT" flag:"rl" usage:"Accrual system requests per second limit" reload:"true"`
+	// Секрет подписи вебхуков Accrual System и адрес, на который их слать
+	WebhookSecret string `yaml:"webhook_secret" toml:"webhook_secret" env:"WEBHOOK_SECRET" flag:"ws" usage:"Accrual webhook secret" secret:"true"`
+	WebhookURL    string `yaml:"webhook_url" toml:"webhook_url" env:"WEBHOOK_URL" flag:"wu" usage:"Public URL of accrual webhook receiver"`
+	// Токен служебных маршрутов Accrual System для подписки на вебхуки
+	AccrualAdminToken string `yaml:"accrual_admin_token" toml:"accrual_admin_token" env:"ACCRUAL_ADMIN_TOKEN" flag:"aat" usage:"Accrual System admin token for webhook subscription" secret:"true"`
+	// Токен служебных маршрутов /api/admin: подтверждение и возврат списаний. Пусто - маршруты отключены
+	AdminToken string `yaml:"admin_token" toml:"admin_token" env:"ADMIN_TOKEN" flag:"at" usage:"Bearer token for /api/admin routes" secret:"true"`
+	// Сколько живет резерв баллов под списание, пока его не подтвердят или отменят
+	ReservationTTL time.Duration `yaml:"reservation_ttl" toml:"reservation_ttl" env:"RESERVATION_TTL" flag:"rt" usage:"Withdrawal reservation lifetime"`
+	// Сколько живут начисленные баллы, 0 - не сгорают
+	PointsTTL time.Duration `yaml:"points_ttl" toml:"points_ttl" env:"POINTS_TTL" flag:"pt" usage:"Accrued points lifetime, 0 - never expire"`
+	// За сколько до сгорания баллы попадают в expiring_soon баланса
+	ExpiryNotice time.Duration `yaml:"expiry_notice" toml:"expiry_notice" env:"EXPIRY_NOTICE" flag:"en" usage:"Show points expiring within this period in balance"`
+	// Сколько хранятся события пользователей. Поток можно продолжить только в этих пределах
+	EventsRetention time.Duration `yaml:"events_retention" toml:"events_retention" env:"EVENTS_RETENTION" flag:"er" usage:"User events retention for stream resume"`
+	// Предохранитель вызовов Accrual System
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold" env:"BREAKER_THRESHOLD" flag:"bt" usage:"Accrual circuit breaker failure threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown" env:"BREAKER_COOLDOWN" flag:"bc" usage:"Accrual circuit breaker cooldown"`
+	// Сколько ждать завершения запросов и воркеров при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"st" usage:"Graceful shutdown timeout"`
+	LogConfig       `yaml:",inline"`
+	TraceConfig     `yaml:",inline"`
+	OutboxConfig    `yaml:",inline"`
+	TierConfig      `yaml:",inline"`
+	WithdrawConfig  `yaml:",inline"`
+	TransferConfig  `yaml:",inline"`
+	ReferralConfig  `yaml:",inline"`
+
+	// Вычисляется из StoragePath
+	DriverType string `yaml:"-" toml:"-"`
+	// Параметры загрузки
+	Meta Meta `yaml:"-" toml:"-"`
+}
+
+func defaultGophermartConfig() GophermartConfig {
+	return GophermartConfig{
+		ListenAddr:       "localhost:8080",
+		AutoMigrate:      true,
+		TickerTime:       10 * time.Second,
+		AccrualRateLimit: 5,
+		ReservationTTL:   15 * time.Minute,
+		ExpiryNotice:     30 * 24 * time.Hour,
+		EventsRetention:  24 * time.Hour,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+		ShutdownTimeout:  10 * time.Second,
+		LogConfig:        defaultLogConfig(),
+		TraceConfig:      defaultTraceConfig(),
+		OutboxConfig:     defaultOutboxConfig(),
+		TierConfig:       defaultTierConfig(),
+		WithdrawConfig:   defaultWithdrawConfig(),
+		TransferConfig:   defaultTransferConfig(),
+		ReferralConfig:   defaultReferralConfig(),
+	}
+}
+
+// NewGophermartConfig собирает конфигурацию из аргументов командной строки и окружения
+func NewGophermartConfig() (GophermartConfig, error) {
+	return LoadGophermartConfig(os.Args[1:], os.Getenv)
+}
+
+// LoadGophermartConfig: значения по умолчанию -> файл -> окружение -> флаги
+func LoadGophermartConfig(args []string, getenv func(string) string) (GophermartConfig, error) {
+	c := defaultGophermartConfig()
+	meta, err := load("gophermart", &c, args, getenv)
+	if err != nil {
+		return c, err
+	}
+	c.Meta = meta
 	c.DriverType = parseDriverType(c.StoragePath)
-	c.LogLevel = *l
-	c.SecretKey = *k
-	c.TickerTime = *t
-	return c
+	return c, c.Validate()
+}
+
+// Redacted возвращает итоговую конфигурацию в YAML со скрытыми секретами
+func (c GophermartConfig) Redacted() (string, error) {
+	return redactedYAML(c)
+}
+
+// Reload заново собирает конфигурацию с теми же аргументами командной строки
+func (c GophermartConfig) Reload() (GophermartConfig, error) {
+	return LoadGophermartConfig(c.Meta.args, os.Getenv)
+}
+
+// Diff возвращает измененные поля: применяемые на лету и требующие перезапуска
+func (c GophermartConfig) Diff(next GophermartConfig) (reloadable, restart []string) {
+	return diffFields(c, next)
+}
+
+// Validate проверяет конфигурацию. Возвращает все найденные ошибки сразу
+func (c GophermartConfig) Validate() error {
+	var errs []error
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("run_address: required"))
+	}
+	if err := validateStorage(c.StoragePath, c.DriverType); err != nil {
+		errs = append(errs, err)
+	}
+	if c.AccrualSystemAddress == "" {
+		errs = append(errs, errors.New("accrual_system_address: required"))
+	}
+	if c.SecretKey == "" {
+		errs = append(errs, errors.New("secret_key: required, set -k or SECRET_KEY"))
+	}
+	if c.TickerTime <= 0 {
+		errs = append(errs, errors.New("ticker_time: must be positive"))
+	}
+	if c.AccrualRateLimit <= 0 {
+		errs = append(errs, errors.New("accrual_rate_limit: must be positive"))
+	}
+	if c.WebhookURL != "" && c.WebhookSecret == "" {
+		errs = append(errs, errors.New("webhook_secret: required when webhook_url is set"))
+	}
+	if c.WebhookURL != "" && c.AccrualAdminToken == "" {
+		errs = append(errs, errors.New("accrual_admin_token: required when webhook_url is set"))
+	}
+	if c.ReservationTTL <= 0 {
+		errs = append(errs, errors.New("reservation_ttl: must be positive"))
+	}
+	if c.PointsTTL < 0 {
+		errs = append(errs, errors.New("points_ttl: must not be negative"))
+	}
+	if c.ExpiryNotice <= 0 {
+		errs = append(errs, errors.New("expiry_notice: must be positive"))
+	}
+	if c.EventsRetention <= 0 {
+		errs = append(errs, errors.New("events_retention: must be positive"))
+	}
+	if c.BreakerThreshold <= 0 {
+		errs = append(errs, errors.New("breaker_threshold: must be positive"))
+	}
+	if c.BreakerCooldown <= 0 {
+		errs = append(errs, errors.New("breaker_cooldown: must be positive"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout: must be positive"))
+	}
+	errs = append(errs, c.LogConfig.validate(), c.TraceConfig.validate(), c.OutboxConfig.validate(), c.TierConfig.validate(), c.WithdrawConfig.validate(), c.TransferConfig.validate(), c.ReferralConfig.validate())
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid gophermart config:\n%w", err)
+	}
+	return nil
 }
@@ -0,0 +1,286 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Конфигурация собирается слоями, каждый следующий перекрывает предыдущий:
+// значения по умолчанию -> файл (YAML/TOML) -> окружение -> флаги.
+//
+// Поля описываются тегами:
+//
+//	yaml, toml - ключ в файле
+//	env        - переменная окружения
+//	flag       - имя флага, usage - его описание
+//	secret     - "true" скрывает значение в --print-config, "url" скрывает пароль в адресе
+//	reload     - "true" значение применяется без перезапуска
+
+const redacted = "******"
+
+var errUnsupportedConfigFile = errors.New("unsupported config file extension, want .yaml, .yml or .toml")
+
+// Meta - параметры загрузки, которые не являются частью конфигурации
+type Meta struct {
+	// Файл конфигурации: -c или CONFIG_FILE
+	File string
+	// --print-config: вывести итоговую конфигурацию и выйти
+	PrintConfig bool
+
+	// Аргументы для повторной загрузки
+	args []string
+}
+
+// Watch перечитывает конфигурацию по SIGHUP и при изменении файла, см. Watch
+func (m Meta) Watch(ctx context.Context, reload func(reason string)) {
+	Watch(ctx, m.File, WatchInterval, reload)
+}
+
+// load заполняет cfg слоями. cfg должен быть указателем на структуру с заданными значениями по умолчанию
+func load(name string, cfg any, args []string, getenv func(string) string) (Meta, error) {
+	meta := Meta{args: args}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&meta.File, "c", "", "Config file (YAML or TOML)")
+	fs.BoolVar(&meta.PrintConfig, "print-config", false, "Print effective config with secrets redacted and exit")
+
+	// Флаги пишут в копию, а в cfg переносятся только явно заданные,
+	// чтобы значения флагов по умолчанию не перекрывали файл и окружение
+	fromFlags := reflect.New(reflect.TypeOf(cfg).Elem())
+	fromFlags.Elem().Set(reflect.ValueOf(cfg).Elem())
+	flagFields := make(map[string]reflect.Value)
+	if err := walkFields(fromFlags.Elem(), func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("flag")
+		if name == "" {
+			return nil
+		}
+		fs.Var(fieldValue{v}, name, f.Tag.Get("usage"))
+		flagFields[name] = v
+		return nil
+	}); err != nil {
+		return meta, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return meta, err
+	}
+	if meta.File == "" {
+		meta.File = getenv("CONFIG_FILE")
+	}
+
+	if meta.File != "" {
+		if err := loadFile(meta.File, cfg); err != nil {
+			return meta, fmt.Errorf("config file %s: %w", meta.File, err)
+		}
+	}
+
+	if err := walkFields(reflect.ValueOf(cfg).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		key := f.Tag.Get("env")
+		if key == "" {
+			return nil
+		}
+		value := getenv(key)
+		if value == "" {
+			return nil
+		}
+		if err := setField(v, value); err != nil {
+			return fmt.Errorf("env %s: %w", key, err)
+		}
+		return nil
+	}); err != nil {
+		return meta, err
+	}
+
+	// Явно заданные флаги перекрывают все остальные слои
+	flagTargets := make(map[string]reflect.Value)
+	_ = walkFields(reflect.ValueOf(cfg).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		if name := f.Tag.Get("flag"); name != "" {
+			flagTargets[name] = v
+		}
+		return nil
+	})
+	fs.Visit(func(fl *flag.Flag) {
+		if src, ok := flagFields[fl.Name]; ok {
+			flagTargets[fl.Name].Set(src)
+		}
+	})
+	return meta, nil
+}
+
+func loadFile(path string, cfg any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		// Пустой файл - не ошибка
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) != 0 {
+			return fmt.Errorf("unknown keys: %v", undecoded)
+		}
+		return nil
+	}
+	return errUnsupportedConfigFile
+}
+
+// walkFields обходит поля структуры, раскрывая встроенные структуры
+func walkFields(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if err := walkFields(v.Field(i), fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(f, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setField(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// fieldValue позволяет использовать поле структуры как flag.Value
+type fieldValue struct {
+	v reflect.Value
+}
+
+func (f fieldValue) String() string {
+	if !f.v.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+func (f fieldValue) Set(s string) error {
+	return setField(f.v, s)
+}
+
+// IsBoolFlag разрешает булевы флаги без значения
+func (f fieldValue) IsBoolFlag() bool {
+	return f.v.IsValid() && f.v.Kind() == reflect.Bool
+}
+
+// redactedYAML возвращает конфигурацию в YAML со скрытыми секретами
+func redactedYAML(cfg any) (string, error) {
+	v := reflect.New(reflect.TypeOf(cfg))
+	v.Elem().Set(reflect.ValueOf(cfg))
+	_ = walkFields(v.Elem(), func(f reflect.StructField, fv reflect.Value) error {
+		if fv.Kind() != reflect.String || fv.String() == "" {
+			return nil
+		}
+		switch f.Tag.Get("secret") {
+		case "true":
+			fv.SetString(redacted)
+		case "url":
+			fv.SetString(redactURL(fv.String()))
+		}
+		return nil
+	})
+	b, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// redactURL скрывает пароль в адресе базы данных
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
+
+// diffFields сравнивает две конфигурации одного типа и возвращает ключи измененных полей:
+// те, что применяются на лету, и те, что требуют перезапуска
+func diffFields(a, b any) (reloadable, restart []string) {
+	va := reflect.ValueOf(a)
+	fields := make(map[string]reflect.Value)
+	_ = walkFields(va, func(f reflect.StructField, v reflect.Value) error {
+		fields[f.Name] = v
+		return nil
+	})
+	_ = walkFields(reflect.ValueOf(b), func(f reflect.StructField, v reflect.Value) error {
+		key := f.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			return nil
+		}
+		if reflect.DeepEqual(fields[f.Name].Interface(), v.Interface()) {
+			return nil
+		}
+		if f.Tag.Get("reload") == "true" {
+			reloadable = append(reloadable, key)
+		} else {
+			restart = append(restart, key)
+		}
+		return nil
+	})
+	return reloadable, restart
+}
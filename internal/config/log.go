@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mi4r/gophermart/lib/logger"
+)
+
+// LogConfig - настройки логов, общие для обоих сервисов
+type LogConfig struct {
+	LogLevel       string `yaml:"log_level" toml:"log_level" env:"LOG_LEVEL" flag:"l" usage:"Log level: debug, info, warn, error" reload:"true"`
+	LogFormat      string `yaml:"log_format" toml:"log_format" env:"LOG_FORMAT" flag:"lf" usage:"Log format: pretty, json, logfmt"`
+	LogModules     string `yaml:"log_modules" toml:"log_modules" env:"LOG_MODULES" flag:"lm" usage:"Per-module log levels, e.g. worker=debug,http=warn" reload:"true"`
+	LogSampling    int    `yaml:"log_sampling" toml:"log_sampling" env:"LOG_SAMPLING" flag:"ls" usage:"Debug log sampling: first N equal messages per second, then every N-th"`
+	LogFile        string `yaml:"log_file" toml:"log_file" env:"LOG_FILE" flag:"lo" usage:"Log file path, stdout if empty"`
+	LogFileMaxSize int    `yaml:"log_file_max_size" toml:"log_file_max_size" env:"LOG_FILE_MAX_SIZE" flag:"lsz" usage:"Log file max size in MB before rotation"`
+	LogFileBackups int    `yaml:"log_file_backups" toml:"log_file_backups" env:"LOG_FILE_BACKUPS" flag:"lbk" usage:"Log file rotated backups to keep"`
+}
+
+func defaultLogConfig() LogConfig {
+	return LogConfig{
+		LogLevel:       "debug",
+		LogFormat:      logger.FormatPretty,
+		LogFileMaxSize: 100,
+		LogFileBackups: 5,
+	}
+}
+
+// Options собирает настройки логгера
+func (c LogConfig) Options() logger.Options {
+	return logger.Options{
+		Level:          c.LogLevel,
+		Format:         c.LogFormat,
+		ModuleLevels:   c.LogModules,
+		DebugSampling:  c.LogSampling,
+		File:           c.LogFile,
+		FileMaxSizeMB:  c.LogFileMaxSize,
+		FileMaxBackups: c.LogFileBackups,
+	}
+}
+
+func (c LogConfig) validate() error {
+	var errs []error
+	if _, err := logger.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	switch c.LogFormat {
+	case logger.FormatPretty, logger.FormatJSON, logger.FormatLogfmt:
+	default:
+		errs = append(errs, fmt.Errorf("log_format: unknown format %q", c.LogFormat))
+	}
+	if _, err := logger.ParseModuleLevels(c.LogModules); err != nil {
+		errs = append(errs, fmt.Errorf("log_modules: %w", err))
+	}
+	if c.LogSampling < 0 {
+		errs = append(errs, errors.New("log_sampling: must not be negative"))
+	}
+	if c.LogFileMaxSize < 0 || c.LogFileBackups < 0 {
+		errs = append(errs, errors.New("log_file_max_size, log_file_backups: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/outbox"
+)
+
+// OutboxConfig - доставка доменных событий gophermart во внешние системы
+type OutboxConfig struct {
+	OutboxPublisher string `yaml:"outbox_publisher" toml:"outbox_publisher" env:"OUTBOX_PUBLISHER" flag:"op" usage:"Outbox publisher: none, webhook, file, stdout"`
+	OutboxURL       string `yaml:"outbox_url" toml:"outbox_url" env:"OUTBOX_URL" flag:"ou" usage:"Outbox webhook URL"`
+	OutboxSecret    string `yaml:"outbox_secret" toml:"outbox_secret" env:"OUTBOX_SECRET" flag:"os" usage:"Outbox webhook signing secret" secret:"true"`
+	OutboxFile      string `yaml:"outbox_file" toml:"outbox_file" env:"OUTBOX_FILE" flag:"of" usage:"Outbox file for file publisher"`
+	// Как часто relay проверяет outbox
+	OutboxInterval time.Duration `yaml:"outbox_interval" toml:"outbox_interval" env:"OUTBOX_INTERVAL" flag:"oi" usage:"Outbox relay interval"`
+	// Сколько события ждут publisher, пока он не настроен. С publisher ничего не удаляется
+	OutboxRetention time.Duration `yaml:"outbox_retention" toml:"outbox_retention" env:"OUTBOX_RETENTION" flag:"or" usage:"Outbox events retention while publisher is none"`
+}
+
+func defaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		OutboxPublisher: outbox.PublisherNone,
+		OutboxInterval:  time.Second,
+		OutboxRetention: 72 * time.Hour,
+	}
+}
+
+// Options возвращает параметры publisher
+func (c OutboxConfig) Options() outbox.Config {
+	return outbox.Config{
+		Publisher: c.OutboxPublisher,
+		URL:       c.OutboxURL,
+		Secret:    c.OutboxSecret,
+		FilePath:  c.OutboxFile,
+	}
+}
+
+func (c OutboxConfig) validate() error {
+	var errs []error
+	switch c.OutboxPublisher {
+	case outbox.PublisherNone, outbox.PublisherStdout:
+	case outbox.PublisherWebhook:
+		if c.OutboxURL == "" {
+			errs = append(errs, errors.New("outbox_url: required for webhook publisher"))
+		}
+		if c.OutboxSecret == "" {
+			errs = append(errs, errors.New("outbox_secret: required for webhook publisher"))
+		}
+	case outbox.PublisherFile:
+		if c.OutboxFile == "" {
+			errs = append(errs, errors.New("outbox_file: required for file publisher"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("outbox_publisher: unknown publisher %q", c.OutboxPublisher))
+	}
+	if c.OutboxInterval <= 0 {
+		errs = append(errs, errors.New("outbox_interval: must be positive"))
+	}
+	if c.OutboxRetention <= 0 {
+		errs = append(errs, errors.New("outbox_retention: must be positive"))
+	}
+	return errors.Join(errs...)
+}
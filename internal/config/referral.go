@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// ReferralConfig - бонусы за приглашения. Начисляются обоим, когда первый заказ
+// приглашенного обработан. Нулевые бонусы отключают программу
+type ReferralConfig struct {
+	ReferrerBonus float64 `yaml:"referral_referrer_bonus" toml:"referral_referrer_bonus" env:"REFERRAL_REFERRER_BONUS" flag:"rrb" usage:"Referral bonus for the inviting user"`
+	ReferredBonus float64 `yaml:"referral_referred_bonus" toml:"referral_referred_bonus" env:"REFERRAL_REFERRED_BONUS" flag:"rdb" usage:"Referral bonus for the invited user"`
+	// Защита от накруток: минимальное начисление за первый заказ и предел бонусов на одного пригласившего
+	ReferralMinAccrual float64 `yaml:"referral_min_accrual" toml:"referral_min_accrual" env:"REFERRAL_MIN_ACCRUAL" flag:"rma" usage:"Minimum first order accrual for referral bonus"`
+	ReferralMaxRewards int     `yaml:"referral_max_rewards" toml:"referral_max_rewards" env:"REFERRAL_MAX_REWARDS" flag:"rmx" usage:"Referral bonuses per inviting user, 0 - unlimited"`
+}
+
+// Программа выключена, пока оператор не задаст бонусы
+func defaultReferralConfig() ReferralConfig {
+	return ReferralConfig{
+		ReferralMinAccrual: 50,
+		ReferralMaxRewards: 20,
+	}
+}
+
+// ReferralProgram возвращает настройки программы для хранилища
+func (c ReferralConfig) ReferralProgram() storagemart.ReferralProgram {
+	return storagemart.ReferralProgram{
+		ReferrerBonus: c.ReferrerBonus,
+		ReferredBonus: c.ReferredBonus,
+		MinAccrual:    c.ReferralMinAccrual,
+		MaxRewards:    c.ReferralMaxRewards,
+	}
+}
+
+func (c ReferralConfig) validate() error {
+	var errs []error
+	if c.ReferrerBonus < 0 || c.ReferredBonus < 0 {
+		errs = append(errs, errors.New("referral bonuses: must not be negative"))
+	}
+	if c.ReferralMinAccrual < 0 {
+		errs = append(errs, errors.New("referral_min_accrual: must not be negative"))
+	}
+	if c.ReferralMaxRewards < 0 {
+		errs = append(errs, errors.New("referral_max_rewards: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// TierConfig - уровни программы лояльности gophermart. Bronze дается всем, Silver и Gold -
+// за сумму начислений или списаний за скользящий период
+type TierConfig struct {
+	TierBasis            string        `yaml:"tier_basis" toml:"tier_basis" env:"TIER_BASIS" flag:"tb" usage:"Tier score: accrued or spent points"`
+	TierWindow           time.Duration `yaml:"tier_window" toml:"tier_window" env:"TIER_WINDOW" flag:"tw" usage:"Tier score rolling window"`
+	TierInterval         time.Duration `yaml:"tier_interval" toml:"tier_interval" env:"TIER_INTERVAL" flag:"ti" usage:"Tier recalculation interval"`
+	TierSilverThreshold  float64       `yaml:"tier_silver_threshold" toml:"tier_silver_threshold" env:"TIER_SILVER_THRESHOLD" flag:"tst" usage:"Score required for Silver tier"`
+	TierSilverMultiplier float64       `yaml:"tier_silver_multiplier" toml:"tier_silver_multiplier" env:"TIER_SILVER_MULTIPLIER" flag:"tsm" usage:"Accrual multiplier for Silver tier"`
+	TierGoldThreshold    float64       `yaml:"tier_gold_threshold" toml:"tier_gold_threshold" env:"TIER_GOLD_THRESHOLD" flag:"tgt" usage:"Score required for Gold tier"`
+	TierGoldMultiplier   float64       `yaml:"tier_gold_multiplier" toml:"tier_gold_multiplier" env:"TIER_GOLD_MULTIPLIER" flag:"tgm" usage:"Accrual multiplier for Gold tier"`
+}
+
+func defaultTierConfig() TierConfig {
+	return TierConfig{
+		TierBasis:            storagemart.TierBasisAccrued,
+		TierWindow:           365 * 24 * time.Hour,
+		TierInterval:         time.Hour,
+		TierSilverThreshold:  1000,
+		TierSilverMultiplier: 1.1,
+		TierGoldThreshold:    5000,
+		TierGoldMultiplier:   1.25,
+	}
+}
+
+// Tiers возвращает уровни по возрастанию порога
+func (c TierConfig) Tiers() storagemart.Tiers {
+	return storagemart.Tiers{
+		{Tier: storagemart.TierBronze, Threshold: 0, Multiplier: 1},
+		{Tier: storagemart.TierSilver, Threshold: c.TierSilverThreshold, Multiplier: c.TierSilverMultiplier},
+		{Tier: storagemart.TierGold, Threshold: c.TierGoldThreshold, Multiplier: c.TierGoldMultiplier},
+	}
+}
+
+func (c TierConfig) validate() error {
+	var errs []error
+	switch c.TierBasis {
+	case storagemart.TierBasisAccrued, storagemart.TierBasisSpent:
+	default:
+		errs = append(errs, fmt.Errorf("tier_basis: unknown basis %q", c.TierBasis))
+	}
+	if c.TierWindow <= 0 {
+		errs = append(errs, errors.New("tier_window: must be positive"))
+	}
+	if c.TierInterval <= 0 {
+		errs = append(errs, errors.New("tier_interval: must be positive"))
+	}
+	if c.TierSilverThreshold <= 0 || c.TierGoldThreshold <= c.TierSilverThreshold {
+		errs = append(errs, errors.New("tier thresholds: want 0 < silver < gold"))
+	}
+	if c.TierSilverMultiplier < 1 || c.TierGoldMultiplier < c.TierSilverMultiplier {
+		errs = append(errs, errors.New("tier multipliers: want 1 <= silver <= gold"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mi4r/gophermart/internal/tracing"
+)
+
+// TraceConfig - экспортер трассировки, общий для обоих сервисов
+type TraceConfig struct {
+	TraceExporter string `yaml:"trace_exporter" toml:"trace_exporter" env:"TRACE_EXPORTER" flag:"te" usage:"Trace exporter: none, stdout, file, otlp"`
+	TraceFile     string `yaml:"trace_file" toml:"trace_file" env:"TRACE_FILE" flag:"tf" usage:"Trace file for file exporter"`
+}
+
+func defaultTraceConfig() TraceConfig {
+	return TraceConfig{TraceExporter: tracing.ExporterNone}
+}
+
+func (c TraceConfig) validate() error {
+	switch c.TraceExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+		return nil
+	case tracing.ExporterFile:
+		if c.TraceFile == "" {
+			return errors.New("trace_file: required for file exporter")
+		}
+		return nil
+	}
+	return fmt.Errorf("trace_exporter: unknown exporter %q", c.TraceExporter)
+}
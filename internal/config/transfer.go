@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/rules"
+)
+
+// TransferConfig - лимиты переводов баллов между пользователями. Нулевое значение отключает лимит
+type TransferConfig struct {
+	TransferMin          float64 `yaml:"transfer_min" toml:"transfer_min" env:"TRANSFER_MIN" flag:"tfn" usage:"Minimum transfer sum, 0 - no minimum"`
+	TransferMax          float64 `yaml:"transfer_max" toml:"transfer_max" env:"TRANSFER_MAX" flag:"tfx" usage:"Maximum transfer sum, 0 - no maximum"`
+	TransferDailyLimit   float64 `yaml:"transfer_daily_limit" toml:"transfer_daily_limit" env:"TRANSFER_DAILY_LIMIT" flag:"tfd" usage:"Outgoing transfers sum limit per day, 0 - unlimited"`
+	TransferMonthlyLimit float64 `yaml:"transfer_monthly_limit" toml:"transfer_monthly_limit" env:"TRANSFER_MONTHLY_LIMIT" flag:"tfm" usage:"Outgoing transfers sum limit per calendar month, 0 - unlimited"`
+}
+
+func defaultTransferConfig() TransferConfig {
+	return TransferConfig{
+		TransferDailyLimit: 10000,
+	}
+}
+
+// TransferRules возвращает настройки правил перевода. Запрет после смены пароля
+// общий со списаниями: cooldown - значение withdraw_password_cooldown
+func (c TransferConfig) TransferRules(cooldown time.Duration) rules.Config {
+	return rules.Config{
+		MinAmount:        c.TransferMin,
+		MaxAmount:        c.TransferMax,
+		DailyCap:         c.TransferDailyLimit,
+		MonthlyCap:       c.TransferMonthlyLimit,
+		PasswordCooldown: cooldown,
+	}
+}
+
+func (c TransferConfig) validate() error {
+	var errs []error
+	if c.TransferMin < 0 || c.TransferMax < 0 || c.TransferDailyLimit < 0 || c.TransferMonthlyLimit < 0 {
+		errs = append(errs, errors.New("transfer limits: must not be negative"))
+	}
+	if c.TransferMax > 0 && c.TransferMin > c.TransferMax {
+		errs = append(errs, errors.New("transfer_min: must not exceed transfer_max"))
+	}
+	if c.TransferDailyLimit > 0 && c.TransferMonthlyLimit > 0 && c.TransferDailyLimit > c.TransferMonthlyLimit {
+		errs = append(errs, errors.New("transfer_daily_limit: must not exceed transfer_monthly_limit"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WatchInterval - как часто проверяется файл конфигурации
+const WatchInterval = 2 * time.Second
+
+// Watch вызывает reload по SIGHUP и при изменении файла конфигурации.
+// Блокируется до отмены ctx. reload вызывается последовательно из одной горутины
+func Watch(ctx context.Context, file string, interval time.Duration, reload func(reason string)) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	var tickCh <-chan time.Time
+	var last fileStamp
+	if file != "" {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+		last = stampOf(file)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hupCh:
+			reload("SIGHUP")
+		case <-tickCh:
+			stamp := stampOf(file)
+			if stamp == last {
+				continue
+			}
+			last = stamp
+			// Файл могли удалить или переименовать при атомарной записи - дождемся нового
+			if !stamp.exists {
+				slog.Warn("config file is missing", slog.String("file", file))
+				continue
+			}
+			reload("config file changed")
+		}
+	}
+}
+
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stampOf(file string) fileStamp {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
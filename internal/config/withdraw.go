@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/rules"
+)
+
+// WithdrawConfig - правила списания баллов. Нулевое значение отключает правило
+type WithdrawConfig struct {
+	WithdrawMin          float64 `yaml:"withdraw_min" toml:"withdraw_min" env:"WITHDRAW_MIN" flag:"wmn" usage:"Minimum withdrawal sum, 0 - no minimum"`
+	WithdrawMax          float64 `yaml:"withdraw_max" toml:"withdraw_max" env:"WITHDRAW_MAX" flag:"wmx" usage:"Maximum withdrawal sum, 0 - no maximum"`
+	WithdrawDailyLimit   float64 `yaml:"withdraw_daily_limit" toml:"withdraw_daily_limit" env:"WITHDRAW_DAILY_LIMIT" flag:"wdl" usage:"Withdrawals sum limit per day, 0 - unlimited"`
+	WithdrawMonthlyLimit float64 `yaml:"withdraw_monthly_limit" toml:"withdraw_monthly_limit" env:"WITHDRAW_MONTHLY_LIMIT" flag:"wml" usage:"Withdrawals sum limit per calendar month, 0 - unlimited"`
+	// Сколько после смены пароля списания запрещены
+	WithdrawPasswordCooldown time.Duration `yaml:"withdraw_password_cooldown" toml:"withdraw_password_cooldown" env:"WITHDRAW_PASSWORD_COOLDOWN" flag:"wpc" usage:"Withdrawals ban after password change, 0 - no ban"`
+	// Пометки для проверки администратором, списание при этом проходит
+	WithdrawFlagVelocity int     `yaml:"withdraw_flag_velocity" toml:"withdraw_flag_velocity" env:"WITHDRAW_FLAG_VELOCITY" flag:"wfv" usage:"Flag a withdrawal after this many withdrawals in an hour, 0 - off"`
+	WithdrawFlagAmount   float64 `yaml:"withdraw_flag_amount" toml:"withdraw_flag_amount" env:"WITHDRAW_FLAG_AMOUNT" flag:"wfa" usage:"Flag withdrawals of this sum and above, 0 - off"`
+}
+
+func defaultWithdrawConfig() WithdrawConfig {
+	return WithdrawConfig{
+		WithdrawPasswordCooldown: 24 * time.Hour,
+		WithdrawFlagVelocity:     5,
+	}
+}
+
+// Rules возвращает настройки движка правил списания
+func (c WithdrawConfig) Rules() rules.Config {
+	return rules.Config{
+		MinAmount:        c.WithdrawMin,
+		MaxAmount:        c.WithdrawMax,
+		DailyCap:         c.WithdrawDailyLimit,
+		MonthlyCap:       c.WithdrawMonthlyLimit,
+		PasswordCooldown: c.WithdrawPasswordCooldown,
+		VelocityCount:    c.WithdrawFlagVelocity,
+		LargeAmount:      c.WithdrawFlagAmount,
+	}
+}
+
+func (c WithdrawConfig) validate() error {
+	var errs []error
+	if c.WithdrawMin < 0 || c.WithdrawMax < 0 || c.WithdrawDailyLimit < 0 || c.WithdrawMonthlyLimit < 0 || c.WithdrawFlagAmount < 0 {
+		errs = append(errs, errors.New("withdraw limits: must not be negative"))
+	}
+	if c.WithdrawMax > 0 && c.WithdrawMin > c.WithdrawMax {
+		errs = append(errs, errors.New("withdraw_min: must not exceed withdraw_max"))
+	}
+	if c.WithdrawDailyLimit > 0 && c.WithdrawMonthlyLimit > 0 && c.WithdrawDailyLimit > c.WithdrawMonthlyLimit {
+		errs = append(errs, errors.New("withdraw_daily_limit: must not exceed withdraw_monthly_limit"))
+	}
+	if c.WithdrawPasswordCooldown < 0 {
+		errs = append(errs, errors.New("withdraw_password_cooldown: must not be negative"))
+	}
+	if c.WithdrawFlagVelocity < 0 {
+		errs = append(errs, errors.New("withdraw_flag_velocity: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package fakeaccrual
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+)
+
+// Fake - заглушка Accrual System для тестов и локальной разработки.
+// Для каждого номера заказа можно задать последовательность ответов:
+// очередной запрос получает следующий ответ, последний повторяется бесконечно.
+// Незапрограммированные заказы получают ответ по умолчанию (204).
+type Fake struct {
+	Router *echo.Echo
+
+	mu       sync.Mutex
+	scripts  map[string][]Response
+	requests map[string]int
+	fallback Response
+}
+
+// New создает заглушку без запрограммированных заказов
+func New() *Fake {
+	f := &Fake{
+		Router:   echo.New(),
+		scripts:  make(map[string][]Response),
+		requests: make(map[string]int),
+		fallback: NotRegistered(),
+	}
+	f.Router.HideBanner = true
+	f.Router.GET("/api/orders/:number", f.ordersGetHandler)
+	f.Router.POST("/fake/orders/:number", f.scriptPostHandler)
+	f.Router.DELETE("/fake/orders", f.resetHandler)
+	return f
+}
+
+// ServeHTTP позволяет использовать заглушку в httptest.NewServer
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Router.ServeHTTP(w, r)
+}
+
+// Script задает последовательность ответов для заказа
+func (f *Fake) Script(number string, responses ...Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts[number] = responses
+}
+
+// SetDefault задает ответ для незапрограммированных заказов
+func (f *Fake) SetDefault(response Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fallback = response
+}
+
+// Requests возвращает число запросов по заказу
+func (f *Fake) Requests(number string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[number]
+}
+
+// Reset удаляет все сценарии и счетчики
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = make(map[string][]Response)
+	f.requests = make(map[string]int)
+	f.fallback = NotRegistered()
+}
+
+// next возвращает очередной ответ для заказа
+func (f *Fake) next(number string) Response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests[number]++
+	script, ok := f.scripts[number]
+	if !ok || len(script) == 0 {
+		return f.fallback
+	}
+	resp := script[0]
+	if len(script) > 1 {
+		f.scripts[number] = script[1:]
+	}
+	return resp
+}
+
+func (f *Fake) ordersGetHandler(c echo.Context) error {
+	number := c.Param("number")
+	resp := f.next(number)
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(resp.Delay)):
+		case <-c.Request().Context().Done():
+			return nil
+		}
+	}
+
+	if resp.RetryAfter != "" {
+		c.Response().Header().Set("Retry-After", resp.RetryAfter)
+	}
+	if resp.Body != "" {
+		return c.Blob(resp.code(), echo.MIMEApplicationJSON, []byte(resp.Body))
+	}
+	if resp.code() != http.StatusOK {
+		return c.NoContent(resp.code())
+	}
+	return c.JSON(http.StatusOK, storagedefault.Order{
+		Number:  number,
+		Status:  resp.Status,
+		Accrual: resp.Accrual,
+	})
+}
+
+// scriptPostHandler задает сценарий заказа по HTTP: тело - массив Response
+func (f *Fake) scriptPostHandler(c echo.Context) error {
+	var responses []Response
+	if err := c.Bind(&responses); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	f.Script(c.Param("number"), responses...)
+	return c.NoContent(http.StatusOK)
+}
+
+func (f *Fake) resetHandler(c echo.Context) error {
+	f.Reset()
+	return c.NoContent(http.StatusOK)
+}
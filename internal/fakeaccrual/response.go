@@ -0,0 +1,91 @@
+package fakeaccrual
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+)
+
+// Duration - time.Duration, которая в JSON записывается строкой вида "1.5s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Response - запрограммированный ответ на GET /api/orders/{number}
+type Response struct {
+	// HTTP статус ответа. По умолчанию 200
+	Code    int                        `json:"code,omitempty"`
+	Status  storagedefault.OrderStatus `json:"status,omitempty"`
+	Accrual float64                    `json:"accrual,omitempty"`
+	// Задержка перед ответом
+	Delay Duration `json:"delay,omitempty"`
+	// Значение заголовка Retry-After как есть: секунды или HTTP-date
+	RetryAfter string `json:"retry_after,omitempty"`
+	// Сырое тело ответа. Если задано, заменяет JSON заказа
+	Body string `json:"body,omitempty"`
+}
+
+func (r Response) code() int {
+	if r.Code == 0 {
+		return http.StatusOK
+	}
+	return r.Code
+}
+
+// Processed - расчет завершен с начислением accrual
+func Processed(accrual float64) Response {
+	return Response{Status: storagedefault.StatusProcessed, Accrual: accrual}
+}
+
+// Invalid - заказ не принят к расчету
+func Invalid() Response {
+	return Response{Status: storagedefault.StatusInvalid}
+}
+
+// Processing - расчет еще идет
+func Processing() Response {
+	return Response{Status: storagedefault.StatusProcessing}
+}
+
+// NotRegistered - заказ не зарегистрирован (204)
+func NotRegistered() Response {
+	return Response{Code: http.StatusNoContent}
+}
+
+// TooManyRequests - превышен лимит запросов (429)
+func TooManyRequests(retryAfter string) Response {
+	return Response{Code: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+// ServerError - внутренняя ошибка сервиса (500)
+func ServerError() Response {
+	return Response{Code: http.StatusInternalServerError, Body: "internal server error"}
+}
+
+// Malformed - ответ 200 с телом, которое нельзя разобрать
+func Malformed() Response {
+	return Response{Body: `{"number":`}
+}
+
+// WithDelay возвращает копию ответа с задержкой
+func (r Response) WithDelay(delay time.Duration) Response {
+	r.Delay = Duration(delay)
+	return r
+}
@@ -0,0 +1,24 @@
+package fakeaccrual
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// LoadFile загружает сценарии из JSON файла вида
+//
+//	{"12345678903": [{"code": 429, "retry_after": "1"}, {"status": "PROCESSED", "accrual": 500}]}
+func (f *Fake) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var scripts map[string][]Response
+	if err := json.Unmarshal(b, &scripts); err != nil {
+		return err
+	}
+	for number, responses := range scripts {
+		f.Script(number, responses...)
+	}
+	return nil
+}
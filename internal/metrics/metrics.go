@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	namespace = "gophermart"
+
+	WorkerGophermart = "gophermart_poller"
+	WorkerAccrual    = "accrual_calculator"
+	WorkerWebhook    = "accrual_webhook"
+	WorkerOutbox     = "gophermart_outbox"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	// HTTP
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route and status.",
+	}, []string{"service", "route", "method", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "route", "method", "status"})
+
+	// Ответы 429, отправленные клиентам
+	HTTPRateLimitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_rate_limited_total",
+		Help:      "Number of requests rejected with 429.",
+	})
+
+	// Workers
+	WorkerTasksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_tasks_total",
+		Help:      "Number of tasks processed by background workers.",
+	}, []string{"worker", "result"})
+
+	WorkerTaskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_task_duration_seconds",
+		Help:      "Duration of background worker tasks.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"worker"})
+
+	WorkerQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_queue_depth",
+		Help:      "Number of items waiting for a background worker.",
+	}, []string{"worker"})
+
+	// Accrual System
+	AccrualOrdersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_orders_total",
+		Help:      "Number of accrual orders by status transition.",
+	}, []string{"status"})
+
+	AccrualRewardMatchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_reward_matches_total",
+		Help:      "Number of goods matched by reward rule, by reward type.",
+	}, []string{"type"})
+
+	// Ответы 429, полученные от Accrual System
+	AccrualClientRateLimitedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_client_rate_limited_total",
+		Help:      "Number of 429 responses received from accrual system.",
+	})
+
+	// Открытые потоки /api/user/events
+	EventStreamsOpen = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_streams_open",
+		Help:      "Number of open user event streams.",
+	})
+
+	// Points
+	PointsAccruedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_accrued_total",
+		Help:      "Loyalty points credited to users.",
+	})
+
+	PointsWithdrawnTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_withdrawn_total",
+		Help:      "Loyalty points withdrawn by users.",
+	})
+
+	PointsRefundedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_refunded_total",
+		Help:      "Withdrawn loyalty points returned to users on order refunds.",
+	})
+
+	PointsTransferredTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_transferred_total",
+		Help:      "Loyalty points transferred between users.",
+	})
+
+	ReferralRewardsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "referral_rewards_total",
+		Help:      "Referrals settled on the first processed order of the referred user, by status.",
+	}, []string{"status"})
+
+	WithdrawalRuleHitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "withdrawal_rule_hits_total",
+		Help:      "Withdrawals rejected or flagged for review by withdrawal rules.",
+	}, []string{"rule", "action"})
+)
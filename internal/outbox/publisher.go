@@ -0,0 +1,152 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	"github.com/mi4r/gophermart/lib/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	PublisherNone    = "none"
+	PublisherWebhook = "webhook"
+	PublisherFile    = "file"
+	PublisherStdout  = "stdout"
+
+	webhookTimeout = 10 * time.Second
+)
+
+var (
+	errUnknownPublisher = errors.New("unknown outbox publisher")
+	errEmptyURL         = errors.New("outbox url must not be empty for webhook publisher")
+	errEmptyFile        = errors.New("outbox file path must not be empty for file publisher")
+)
+
+// Publisher доставляет доменное событие во внешнюю систему.
+// Ошибка означает, что событие не доставлено и его нужно отправить еще раз
+type Publisher interface {
+	Publish(ctx context.Context, event storagemart.OutboxEvent) error
+	Close() error
+}
+
+type Config struct {
+	Publisher string
+	// Адрес и секрет подписи для webhook
+	URL    string
+	Secret string
+	// Файл для file. События пишутся в JSON по одному на строку
+	FilePath string
+}
+
+// New создает publisher по конфигурации. Для none возвращает nil: события копятся в outbox
+func New(cfg Config) (Publisher, error) {
+	switch cfg.Publisher {
+	case PublisherNone, "":
+		return nil, nil
+	case PublisherWebhook:
+		if cfg.URL == "" {
+			return nil, errEmptyURL
+		}
+		return NewWebhookPublisher(cfg.URL, cfg.Secret), nil
+	case PublisherStdout:
+		return NewWriterPublisher(os.Stdout, nil), nil
+	case PublisherFile:
+		if cfg.FilePath == "" {
+			return nil, errEmptyFile
+		}
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterPublisher(f, f), nil
+	}
+	return nil, fmt.Errorf("%w: %q", errUnknownPublisher, cfg.Publisher)
+}
+
+// WebhookPublisher отправляет событие POST запросом с подписью HMAC-SHA256,
+// как вебхуки Accrual System. Доставленным считается ответ 2xx
+type WebhookPublisher struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookPublisher(url, secret string) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		secret: secret,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event storagemart.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	webhook.SetHeaders(req, p.secret, event.ID, time.Now(), body)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *WebhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
+
+// WriterPublisher пишет события в JSON по одному на строку
+type WriterPublisher struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterPublisher пишет события в w. closer закрывается в Close, если не nil
+func NewWriterPublisher(w io.Writer, closer io.Closer) *WriterPublisher {
+	return &WriterPublisher{w: w, closer: closer}
+}
+
+func (p *WriterPublisher) Publish(_ context.Context, event storagemart.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(append(line, '\n'))
+	return err
+}
+
+func (p *WriterPublisher) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
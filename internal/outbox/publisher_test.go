@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	"github.com/mi4r/gophermart/lib/webhook"
+)
+
+var testEvent = storagemart.OutboxEvent{
+	Seq:        1,
+	ID:         "5f0c6c1e-3a7e-4c5e-9d0e-3c1f1b2a4d5e",
+	Type:       storagemart.OutboxPointsAccrued,
+	OccurredAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	Data:       json.RawMessage(`{"login":"user","number":"12345678903","accrual":500}`),
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	status := http.StatusOK
+	var got storagemart.OutboxEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("secret", r.Header, body, time.Now(), webhook.DefaultTolerance); err != nil {
+			t.Errorf("signature: %v", err)
+		}
+		if id := r.Header.Get(webhook.HeaderEventID); id != testEvent.ID {
+			t.Errorf("event id header = %q, want %q", id, testEvent.ID)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	p := NewWebhookPublisher(srv.URL, "secret")
+	defer p.Close()
+	if err := p.Publish(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != testEvent.ID || got.Type != testEvent.Type || !bytes.Equal(got.Data, testEvent.Data) {
+		t.Errorf("received %+v, want %+v", got, testEvent)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := p.Publish(context.Background(), testEvent); err == nil {
+		t.Error("want error on 503")
+	}
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewWriterPublisher(&buf, nil)
+	if err := p.Publish(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"5f0c6c1e-3a7e-4c5e-9d0e-3c1f1b2a4d5e","type":"points.accrued","occurred_at":"2024-05-01T10:00:00Z",` +
+		`"data":{"login":"user","number":"12345678903","accrual":500}}` + "\n"
+	if buf.String() != want {
+		t.Errorf("line = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "none", cfg: Config{Publisher: PublisherNone}, wantNil: true},
+		{name: "stdout", cfg: Config{Publisher: PublisherStdout}},
+		{name: "webhook", cfg: Config{Publisher: PublisherWebhook, URL: "http://crm/events"}},
+		{name: "webhook_no_url", cfg: Config{Publisher: PublisherWebhook}, wantErr: true},
+		{name: "file", cfg: Config{Publisher: PublisherFile, FilePath: filepath.Join(t.TempDir(), "events.jsonl")}},
+		{name: "file_no_path", cfg: Config{Publisher: PublisherFile}, wantErr: true},
+		{name: "unknown", cfg: Config{Publisher: "kafka"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (p == nil) != (tt.wantNil || tt.wantErr) {
+				t.Fatalf("New() = %v", p)
+			}
+			if p != nil {
+				p.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// Kind - чем оборачивается нарушение правила
+type Kind int
+
+const (
+	// Запрос некорректен сам по себе
+	KindInvalid Kind = iota
+	// Сумма вне допустимых границ
+	KindAmount
+	// Лимит исчерпан или списания временно запрещены
+	KindDenied
+	// Списание проходит, но попадает на проверку
+	KindFlag
+)
+
+// Violation - нарушение правила списания
+type Violation struct {
+	Rule   string
+	Kind   Kind
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// Request - списание или перевод, который проверяют правила
+type Request struct {
+	Login string
+	// Номер заказа списания, у перевода - логин получателя
+	Order string
+	Sum   float64
+	// Траты пользователя того же вида за текущие сутки, месяц и последний час
+	Stats storagemart.SpendingStats
+	Now   time.Time
+}
+
+// Rule проверяет списание. nil - правило не нарушено
+type Rule func(req Request) *Violation
+
+// Engine прогоняет списание через правила по порядку
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine создает движок с проверкой положительной суммы и правилами rules
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: append([]Rule{Positive()}, rules...)}
+}
+
+// Add добавляет правило в конец
+func (e *Engine) Add(rule Rule) {
+	e.rules = append(e.rules, rule)
+}
+
+// Check возвращает первое нарушение, запрещающее списание, как *Violation.
+// Если запрета нет, возвращает пометки для проверки
+func (e *Engine) Check(req Request) ([]Violation, error) {
+	var flags []Violation
+	for _, rule := range e.rules {
+		v := rule(req)
+		if v == nil {
+			continue
+		}
+		if v.Kind != KindFlag {
+			return nil, v
+		}
+		flags = append(flags, *v)
+	}
+	return flags, nil
+}
+
+// Positive запрещает нулевые, отрицательные и нечисловые суммы
+func Positive() Rule {
+	return func(req Request) *Violation {
+		if !(req.Sum > 0) || math.IsInf(req.Sum, 0) {
+			return &Violation{Rule: "positive", Kind: KindInvalid, Reason: "sum must be positive"}
+		}
+		return nil
+	}
+}
+
+// MinAmount запрещает списания меньше min
+func MinAmount(min float64) Rule {
+	return func(req Request) *Violation {
+		if req.Sum < min {
+			return &Violation{Rule: "min_amount", Kind: KindAmount, Reason: fmt.Sprintf("sum is less than minimum %v", min)}
+		}
+		return nil
+	}
+}
+
+// MaxAmount запрещает списания больше max
+func MaxAmount(max float64) Rule {
+	return func(req Request) *Violation {
+		if req.Sum > max {
+			return &Violation{Rule: "max_amount", Kind: KindAmount, Reason: fmt.Sprintf("sum exceeds maximum %v", max)}
+		}
+		return nil
+	}
+}
+
+// DailyCap ограничивает сумму трат за сутки
+func DailyCap(cap float64) Rule {
+	return func(req Request) *Violation {
+		if req.Stats.Day+req.Sum > cap {
+			return &Violation{Rule: "daily_cap", Kind: KindDenied,
+				Reason: fmt.Sprintf("daily limit %v exceeded, %v left", cap, math.Max(0, cap-req.Stats.Day))}
+		}
+		return nil
+	}
+}
+
+// MonthlyCap ограничивает сумму трат за календарный месяц
+func MonthlyCap(cap float64) Rule {
+	return func(req Request) *Violation {
+		if req.Stats.Month+req.Sum > cap {
+			return &Violation{Rule: "monthly_cap", Kind: KindDenied,
+				Reason: fmt.Sprintf("monthly limit %v exceeded, %v left", cap, math.Max(0, cap-req.Stats.Month))}
+		}
+		return nil
+	}
+}
+
+// PasswordCooldown запрещает списания в течение cooldown после смены пароля
+func PasswordCooldown(cooldown time.Duration) Rule {
+	return func(req Request) *Violation {
+		changed := req.Stats.PasswordChangedAt
+		if changed == nil {
+			return nil
+		}
+		if until := changed.Add(cooldown); req.Now.Before(until) {
+			return &Violation{Rule: "password_cooldown", Kind: KindDenied,
+				Reason: "withdrawals and transfers are disabled until " + until.UTC().Format(time.RFC3339) + " after password change"}
+		}
+		return nil
+	}
+}
+
+// Velocity помечает списание, если за последний час их было count или больше
+func Velocity(count int) Rule {
+	return func(req Request) *Violation {
+		if req.Stats.LastHour >= count {
+			return &Violation{Rule: "velocity", Kind: KindFlag,
+				Reason: fmt.Sprintf("%d withdrawals in the last hour", req.Stats.LastHour+1)}
+		}
+		return nil
+	}
+}
+
+// LargeAmount помечает списания от amount и больше
+func LargeAmount(amount float64) Rule {
+	return func(req Request) *Violation {
+		if req.Sum >= amount {
+			return &Violation{Rule: "large_amount", Kind: KindFlag, Reason: fmt.Sprintf("sum %v is not less than %v", req.Sum, amount)}
+		}
+		return nil
+	}
+}
+
+// Config - настройки встроенных правил. Нулевое значение отключает правило
+type Config struct {
+	MinAmount        float64
+	MaxAmount        float64
+	DailyCap         float64
+	MonthlyCap       float64
+	PasswordCooldown time.Duration
+	// Пометки для проверки
+	VelocityCount int
+	LargeAmount   float64
+}
+
+// New собирает движок из встроенных правил по конфигурации
+func New(cfg Config) *Engine {
+	e := NewEngine()
+	if cfg.MinAmount > 0 {
+		e.Add(MinAmount(cfg.MinAmount))
+	}
+	if cfg.MaxAmount > 0 {
+		e.Add(MaxAmount(cfg.MaxAmount))
+	}
+	if cfg.PasswordCooldown > 0 {
+		e.Add(PasswordCooldown(cfg.PasswordCooldown))
+	}
+	if cfg.DailyCap > 0 {
+		e.Add(DailyCap(cfg.DailyCap))
+	}
+	if cfg.MonthlyCap > 0 {
+		e.Add(MonthlyCap(cfg.MonthlyCap))
+	}
+	if cfg.VelocityCount > 0 {
+		e.Add(Velocity(cfg.VelocityCount))
+	}
+	if cfg.LargeAmount > 0 {
+		e.Add(LargeAmount(cfg.LargeAmount))
+	}
+	return e
+}
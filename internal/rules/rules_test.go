@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+func TestEngine_Check(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	changed := now.Add(-time.Hour)
+	engine := New(Config{
+		MinAmount:        10,
+		MaxAmount:        1000,
+		DailyCap:         1500,
+		MonthlyCap:       5000,
+		PasswordCooldown: 24 * time.Hour,
+		VelocityCount:    3,
+		LargeAmount:      500,
+	})
+
+	tests := []struct {
+		name      string
+		sum       float64
+		stats     storagemart.SpendingStats
+		wantRule  string
+		wantKind  Kind
+		wantFlags []string
+	}{
+		{name: "ok", sum: 100},
+		{name: "zero", sum: 0, wantRule: "positive", wantKind: KindInvalid},
+		{name: "negative", sum: -5, wantRule: "positive", wantKind: KindInvalid},
+		{name: "nan", sum: math.NaN(), wantRule: "positive", wantKind: KindInvalid},
+		{name: "below_min", sum: 9.99, wantRule: "min_amount", wantKind: KindAmount},
+		{name: "above_max", sum: 1000.01, wantRule: "max_amount", wantKind: KindAmount},
+		{name: "daily_cap", sum: 600, stats: storagemart.SpendingStats{Day: 1000, Month: 1000}, wantRule: "daily_cap", wantKind: KindDenied},
+		{name: "daily_cap_exact", sum: 500, stats: storagemart.SpendingStats{Day: 1000, Month: 1000}, wantFlags: []string{"large_amount"}},
+		{name: "monthly_cap", sum: 100, stats: storagemart.SpendingStats{Month: 4950}, wantRule: "monthly_cap", wantKind: KindDenied},
+		{name: "password_cooldown", sum: 100, stats: storagemart.SpendingStats{PasswordChangedAt: &changed}, wantRule: "password_cooldown", wantKind: KindDenied},
+		{name: "flags", sum: 700, stats: storagemart.SpendingStats{LastHour: 3}, wantFlags: []string{"velocity", "large_amount"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, err := engine.Check(Request{Login: "user", Order: "12345678903", Sum: tt.sum, Stats: tt.stats, Now: now})
+			if tt.wantRule != "" {
+				var v *Violation
+				if !errors.As(err, &v) {
+					t.Fatalf("Check() error = %v, want violation %s", err, tt.wantRule)
+				}
+				if v.Rule != tt.wantRule || v.Kind != tt.wantKind {
+					t.Errorf("violation = %s/%d, want %s/%d", v.Rule, v.Kind, tt.wantRule, tt.wantKind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if len(flags) != len(tt.wantFlags) {
+				t.Fatalf("flags = %v, want %v", flags, tt.wantFlags)
+			}
+			for i, f := range flags {
+				if f.Rule != tt.wantFlags[i] || f.Kind != KindFlag {
+					t.Errorf("flag[%d] = %+v, want %s", i, f, tt.wantFlags[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordCooldown_Expired(t *testing.T) {
+	now := time.Now()
+	changed := now.Add(-25 * time.Hour)
+	rule := PasswordCooldown(24 * time.Hour)
+	if v := rule(Request{Sum: 1, Stats: storagemart.SpendingStats{PasswordChangedAt: &changed}, Now: now}); v != nil {
+		t.Errorf("cooldown is over, got %v", v)
+	}
+}
+
+func TestNew_Defaults(t *testing.T) {
+	// Без настроек проверяется только положительная сумма
+	engine := New(Config{})
+	if _, err := engine.Check(Request{Sum: 1e9, Stats: storagemart.SpendingStats{Day: 1e9, LastHour: 100}}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if _, err := engine.Check(Request{Sum: -1}); err == nil {
+		t.Error("want error for negative sum")
+	}
+}
+
+func TestEngine_Add(t *testing.T) {
+	engine := NewEngine()
+	engine.Add(func(req Request) *Violation {
+		if req.Order == "blocked" {
+			return &Violation{Rule: "blocklist", Kind: KindDenied, Reason: "order is blocked"}
+		}
+		return nil
+	})
+	var v *Violation
+	if _, err := engine.Check(Request{Order: "blocked", Sum: 1}); !errors.As(err, &v) || v.Rule != "blocklist" {
+		t.Errorf("Check() error = %v, want blocklist violation", err)
+	}
+}
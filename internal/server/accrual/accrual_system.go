@@ -1,12 +1,13 @@
 package serveraccrual
 
 import (
-	"context"
 	"log/slog"
 
+	"github.com/mi4r/gophermart/internal/metrics"
 	"github.com/mi4r/gophermart/internal/server"
 	"github.com/mi4r/gophermart/internal/storage"
 	workeraccrual "github.com/mi4r/gophermart/internal/worker/accrual"
+	"github.com/mi4r/gophermart/lib/logger"
 	"golang.org/x/time/rate"
 )
 
@@ -14,39 +15,59 @@ type AccrualSystem struct {
 	*server.Server
 	taskCh      chan workeraccrual.Task
 	storage     storage.StorageAccrualSystem
-	rateLimiter *rate.Limiter
+	rateLimiter *server.ClientRateLimiter
+	worker      *workeraccrual.Pool
+	// Разрешенные хосты адресов подписок, пусто - любые, кроме служебных
+	webhookHosts []string
 }
 
-func NewAccrualSystem(server *server.Server, taskCh chan workeraccrual.Task) *AccrualSystem {
+func NewAccrualSystem(core *server.Server, taskCh chan workeraccrual.Task) *AccrualSystem {
 	return &AccrualSystem{
 		taskCh: taskCh,
-		Server: server,
-		// 5 requests in 1 minute
-		rateLimiter: rate.NewLimiter(rate.Limit(server.Config.RateLimit), 60),
+		Server: core,
+		// Отдельный лимит на каждого клиента
+		rateLimiter: server.NewClientRateLimiter(
+			rate.Limit(core.Config.RateLimit), core.Config.RateBurst,
+		),
 	}
 }
 
+// SetWorker передает пул воркеров расчета начислений для readiness
+func (s *AccrualSystem) SetWorker(pool *workeraccrual.Pool) {
+	s.worker = pool
+}
+
+// SetWebhookHosts ограничивает хосты, на которые можно подписать вебхуки
+func (s *AccrualSystem) SetWebhookHosts(hosts []string) {
+	s.webhookHosts = hosts
+}
+
+// SetRateLimit меняет ограничение запросов на клиента на лету
+func (s *AccrualSystem) SetRateLimit(limit, burst int) {
+	s.rateLimiter.SetLimit(rate.Limit(limit), burst)
+}
+
 func (s *AccrualSystem) SetRoutes() {
 	gAPI := s.Router.Group("/api")
 	gAPI.GET("/orders/:number", s.ordersGetHandler, server.RateLimiterMiddleware(s.rateLimiter))
 	gAPI.POST("/orders", s.ordersPostHandler)
 	gAPI.POST("/goods", s.rewardPostHandler)
+	// Подписка задает, куда accrual будет ходить сам, - только со служебным токеном
+	if s.Config.AdminToken != "" {
+		gWebhooks := gAPI.Group("/webhooks", server.AdminTokenMiddleware(s.Config.AdminToken))
+		gWebhooks.POST("", s.webhookPostHandler)
+		gWebhooks.DELETE("/:id", s.webhookDeleteHandler)
+	}
+	s.setHealthChecks()
 }
 
+// SetStorage задает уже открытое хранилище с актуальной схемой
 func (s *AccrualSystem) SetStorage(storage storage.StorageAccrualSystem) {
 	s.storage = storage
-	ctx := context.Background()
-	if err := s.storage.Open(ctx); err != nil {
-		slog.Error(err.Error())
-		s.Shutdown()
-	}
-
-	// Try auto-migration
-	s.storage.Migrate(s.Config.MigrDirName)
-
 }
 
 func (s *AccrualSystem) AddTask(task workeraccrual.Task) {
-	slog.Debug("new task", slog.Any("order", task.Order))
+	slog.Debug("new task", slog.String("order", task.Order.Order), slog.String(logger.KeyRequestID, task.RequestID))
 	s.taskCh <- task
+	metrics.WorkerQueueDepth.WithLabelValues(metrics.WorkerAccrual).Set(float64(len(s.taskCh)))
 }
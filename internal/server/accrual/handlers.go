@@ -1,21 +1,30 @@
 package serveraccrual
 
 import (
-	"context"
 	"errors"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/metrics"
+	"github.com/mi4r/gophermart/internal/server"
 	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
 	workeraccrual "github.com/mi4r/gophermart/internal/worker/accrual"
 	"github.com/mi4r/gophermart/lib/helper"
 )
 
 const (
-	rewardCreated = "new reward will be created"
-	orderAccepted = "order accepted"
+	rewardCreated  = "new reward will be created"
+	orderAccepted  = "order accepted"
+	webhookDeleted = "webhook deleted"
 )
 
 var (
@@ -29,6 +38,10 @@ var (
 	errInvalidOrderID            = errors.New("invalid order number format")
 	errOrderAlreadyExists        = errors.New("order already exists")
 	errInternalServerError       = errors.New("internal server error")
+	errInvalidWebhook            = errors.New("webhook url must be absolute http(s) url and secret must not be empty")
+	errInvalidWebhookID          = errors.New("invalid webhook id")
+	errForbiddenWebhookHost      = errors.New("webhook host is not allowed")
+	errNotFoundWebhook           = errors.New("webhook not found")
 )
 
 // Reward created
@@ -61,7 +74,7 @@ func (s *AccrualSystem) rewardPostHandler(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errRewardIsInvalidType.Error())
 	}
 
-	if err := s.storage.RewardCreate(context.Background(), reward); err != nil {
+	if err := s.storage.RewardCreate(c.Request().Context(), reward); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 			return c.String(http.StatusConflict, errMatchKeyAlreadyExists.Error())
@@ -92,23 +105,26 @@ func (s *AccrualSystem) ordersPostHandler(c echo.Context) error {
 	}
 
 	// Нужна ли проверка? поидее этой ручкой наполняем базу и уже проверили все
+	server.SetLogOrder(c, order.Order)
 	if !helper.IsLuhn(order.Order) {
 		return c.String(http.StatusBadRequest, errInvalidOrderID.Error())
 	}
 
-	if err := s.storage.OrderRegCreate(context.Background(), order); err != nil {
+	if err := s.storage.OrderRegCreate(c.Request().Context(), order); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			slog.Debug("internal error. 23505", slog.String("msg", err.Error()))
+			slog.DebugContext(c.Request().Context(), "internal error. 23505", slog.String("msg", err.Error()))
 			return c.String(http.StatusConflict, errOrderAlreadyExists.Error())
 		}
-		slog.Debug("internal error. unknown", slog.String("msg", err.Error()))
+		slog.DebugContext(c.Request().Context(), "internal error. unknown", slog.String("msg", err.Error()))
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
+	metrics.AccrualOrdersTotal.WithLabelValues(string(storagedefault.StatusRegistered)).Inc()
+
 	// Отправляем рассчитывать
 	s.AddTask(
-		workeraccrual.NewTask(order),
+		workeraccrual.NewTask(c.Request().Context(), order),
 	)
 
 	return c.String(http.StatusAccepted, orderAccepted)
@@ -130,6 +146,7 @@ func (s *AccrualSystem) ordersPostHandler(c echo.Context) error {
 // @Router /api/orders/{number} [get]
 func (s *AccrualSystem) ordersGetHandler(c echo.Context) error {
 	number := c.Param("number")
+	server.SetLogOrder(c, number)
 	if !helper.IsLuhn(number) {
 		// Нет более подходящего статуса ответа исходя из ТЗ
 		return c.String(http.StatusNoContent, errInvalidOrderID.Error())
@@ -138,7 +155,7 @@ func (s *AccrualSystem) ordersGetHandler(c echo.Context) error {
 	// 429 status
 	// Реализовано в middleware
 
-	order, err := s.storage.OrderRegReadOne(context.Background(), number)
+	order, err := s.storage.OrderRegReadOne(c.Request().Context(), number)
 	if err != nil {
 		if err.Error() == errNotFoundOrder.Error() {
 			return c.NoContent(http.StatusNoContent)
@@ -149,3 +166,89 @@ func (s *AccrualSystem) ordersGetHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, order)
 }
+
+// Webhook subscribe
+// @Summary Подписка на события о расчете начислений
+// @Description Когда заказ переходит в статус PROCESSED или INVALID, на указанный адрес отправляется POST с событием
+// @Description Тело запроса подписывается HMAC-SHA256 с секретом подписки: заголовок X-Webhook-Signature от "X-Webhook-Timestamp.тело"
+// @Description Повторная подписка того же адреса обновляет секрет
+// @Description Служебный маршрут, нужен заголовок Authorization: Bearer <admin_token>.
+// @Description Хост адреса должен быть в webhook_hosts, без списка запрещены link-local, unspecified и multicast адреса
+// @Tags Админ
+// @Accept  application/json
+// @Produce application/json
+// @Param webhook body Webhook true "Адрес и секрет подписки"
+// @Success 201 {object} Webhook "Подписка зарегистрирована"
+// @Failure 400 {string} string "Неверный формат запроса или запрещенный хост"
+// @Failure 401 {string} string "Неверный служебный токен"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/webhooks [post]
+func (s *AccrualSystem) webhookPostHandler(c echo.Context) error {
+	var webhook storageaccrual.Webhook
+	if err := c.Bind(&webhook); err != nil {
+		return c.String(http.StatusBadRequest, errInvalidWebhook.Error())
+	}
+	if !webhook.IsValid() {
+		return c.String(http.StatusBadRequest, errInvalidWebhook.Error())
+	}
+	if !s.webhookHostAllowed(webhook.URL) {
+		return c.String(http.StatusBadRequest, errForbiddenWebhookHost.Error())
+	}
+
+	id, err := s.storage.WebhookCreate(c.Request().Context(), webhook)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, storageaccrual.Webhook{
+		ID:  id,
+		URL: webhook.URL,
+	})
+}
+
+// Webhook unsubscribe
+// @Summary Удаление подписки на события
+// @Description Служебный маршрут, нужен заголовок Authorization: Bearer <admin_token>.
+// @Tags Админ
+// @Produce text/plain
+// @Param id path int true "Идентификатор подписки"
+// @Success 200 {string} string "Подписка удалена"
+// @Failure 400 {string} string "Неверный идентификатор"
+// @Failure 401 {string} string "Неверный служебный токен"
+// @Failure 404 {string} string "Подписка не найдена"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/webhooks/{id} [delete]
+func (s *AccrualSystem) webhookDeleteHandler(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, errInvalidWebhookID.Error())
+	}
+
+	if err := s.storage.WebhookDelete(c.Request().Context(), id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.String(http.StatusNotFound, errNotFoundWebhook.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.String(http.StatusOK, webhookDeleted)
+}
+
+// webhookHostAllowed проверяет хост адреса подписки. Со списком webhook_hosts пускает только его хосты,
+// без списка - любые, кроме link-local (метаданные облака), unspecified и multicast адресов.
+// Имена хостов не разрешаются в адреса, поэтому в продакшене нужен список
+func (s *AccrualSystem) webhookHostAllowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if len(s.webhookHosts) != 0 {
+		return slices.Contains(s.webhookHosts, host)
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return true
+	}
+	ip = ip.Unmap()
+	return !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() && !ip.IsUnspecified() && !ip.IsMulticast()
+}
@@ -0,0 +1,75 @@
+package serveraccrual
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/server"
+	"github.com/mi4r/gophermart/internal/storage"
+	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
+)
+
+// webhookStorage запоминает созданные подписки
+type webhookStorage struct {
+	storage.StorageAccrualSystem
+	created []string
+}
+
+func (s *webhookStorage) WebhookCreate(_ context.Context, webhook storageaccrual.Webhook) (int64, error) {
+	s.created = append(s.created, webhook.URL)
+	return int64(len(s.created)), nil
+}
+
+func TestWebhookPost(t *testing.T) {
+	st := &webhookStorage{}
+	s := NewAccrualSystem(server.NewServer(server.Config{RateLimit: 1, RateBurst: 1, AdminToken: "token"}), nil)
+	s.SetStorage(st)
+	s.SetRoutes()
+
+	tests := []struct {
+		name  string
+		url   string
+		token string
+		want  int
+	}{
+		{"no token", "http://gophermart/api/accrual/webhook", "", http.StatusUnauthorized},
+		{"wrong token", "http://gophermart/api/accrual/webhook", "wrong", http.StatusUnauthorized},
+		{"cloud metadata", "http://169.254.169.254/latest/meta-data", "token", http.StatusBadRequest},
+		{"mapped metadata", "http://[::ffff:169.254.169.254]/", "token", http.StatusBadRequest},
+		{"unspecified", "http://0.0.0.0:8080/", "token", http.StatusBadRequest},
+		{"ftp scheme", "ftp://gophermart/", "token", http.StatusBadRequest},
+		{"ok", "http://gophermart/api/accrual/webhook", "token", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"url":"` + tt.url + `","secret":"secret"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.Router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+	if len(st.created) != 1 {
+		t.Errorf("created = %v, want one webhook", st.created)
+	}
+}
+
+func TestWebhookHostAllowed(t *testing.T) {
+	s := &AccrualSystem{webhookHosts: []string{"gophermart"}}
+	if !s.webhookHostAllowed("http://GopherMart:8080/api/accrual/webhook") {
+		t.Error("listed host must be allowed")
+	}
+	if s.webhookHostAllowed("http://example.com/") {
+		t.Error("host outside the list must be rejected")
+	}
+}
@@ -0,0 +1,23 @@
+package serveraccrual
+
+import (
+	"context"
+
+	"github.com/mi4r/gophermart/internal/server"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+	"github.com/mi4r/gophermart/internal/worker"
+)
+
+// setHealthChecks регистрирует проверки для /readyz.
+// Хранилище и воркер задаются после SetRoutes, поэтому обращаемся к ним лениво
+func (s *AccrualSystem) setHealthChecks() {
+	s.AddReadinessCheck("storage", true, func(ctx context.Context) (any, error) {
+		return nil, s.storage.Ping(ctx)
+	})
+	s.AddReadinessCheck("migrations", true, server.MigrationsCheck(func(ctx context.Context) (migrations.Status, error) {
+		return s.storage.MigrationStatus(ctx)
+	}))
+	s.AddReadinessCheck("worker", true, server.WorkerCheck(func() worker.Status {
+		return s.worker.Status()
+	}, nil))
+}
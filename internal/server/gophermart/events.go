@@ -0,0 +1,222 @@
+package servermart
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/auth"
+	"github.com/mi4r/gophermart/internal/metrics"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+const (
+	// Заголовок, в котором браузер при переподключении присылает id последнего события
+	headerLastEventID = "Last-Event-ID"
+	// Сколько событий читать из хранилища за раз
+	eventsBatchSize = 100
+	// Пустой комментарий не дает прокси закрыть простаивающее соединение.
+	// Заодно поток перечитывает события, если уведомление потерялось
+	eventsHeartbeat = 15 * time.Second
+	// Через сколько клиенту переподключаться после обрыва
+	eventsRetry = 3 * time.Second
+	// Пауза перед новой подпиской на уведомления после обрыва соединения с базой
+	eventsListenRetry = 5 * time.Second
+)
+
+var errInvalidLastEventID = errors.New("invalid last event id")
+
+// eventHub будит открытые потоки событий пользователя, когда хранилище сообщает о новом событии
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+	// Закрывается при остановке сервера, чтобы потоки не держали Shutdown
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: make(map[string]map[chan struct{}]struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// subscribe возвращает канал сигналов о новых событиях пользователя.
+// Несколько сигналов подряд схлопываются в один
+func (h *eventHub) subscribe(login string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	if h.subs[login] == nil {
+		h.subs[login] = make(map[chan struct{}]struct{})
+	}
+	h.subs[login][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs[login], ch)
+		if len(h.subs[login]) == 0 {
+			delete(h.subs, login)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// notify будит потоки пользователя login, пустой login - всех
+func (h *eventHub) notify(login string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for l, chans := range h.subs {
+		if login != "" && l != login {
+			continue
+		}
+		for ch := range chans {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (h *eventHub) close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// ListenEvents передает уведомления хранилища открытым потокам событий до отмены ctx.
+// После обрыва соединения с базой подписывается заново
+func (s *Gophermart) ListenEvents(ctx context.Context) {
+	for {
+		err := s.storage.UserEventsListen(ctx, s.events.notify)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.WarnContext(ctx, "user events listen error", slog.String("err", err.Error()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsListenRetry):
+		}
+	}
+}
+
+// User events
+// @Summary Поток событий пользователя
+// @Description Server-Sent Events: смена статуса заказа (event: order.status) и баланса (event: balance).
+// @Description В data - объект Event, в id - его номер. После переподключения поток продолжается
+// @Description с события, следующего за Last-Event-ID (заголовок или параметр last_event_id).
+// @Description Без них приходят только новые события.
+// @Tags Пользователи
+// @Produce text/event-stream
+// @Param Last-Event-ID header int false "Номер последнего полученного события"
+// @Param last_event_id query int false "То же, для клиентов без доступа к заголовкам"
+// @Success 200 {object} Event "Поток событий"
+// @Failure 400 {string} string "Неверный номер события"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/user/events [get]
+func (s *Gophermart) userEventsHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+	lastID, resume, err := parseLastEventID(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := c.Request().Context()
+	// Подписываемся до чтения последнего id, чтобы не пропустить событие между ними
+	wake, unsubscribe := s.events.subscribe(login)
+	defer unsubscribe()
+	if !resume {
+		if lastID, err = s.storage.UserEventLastID(ctx, login); err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// nginx не должен копить поток в буфере
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprintf(res, "retry: %d\n\n", eventsRetry.Milliseconds())
+	res.Flush()
+
+	metrics.EventStreamsOpen.Inc()
+	defer metrics.EventStreamsOpen.Dec()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		for {
+			events, err := s.storage.UserEventsList(ctx, login, lastID, eventsBatchSize)
+			if err != nil {
+				// Ответ уже начат, остается закрыть поток: клиент переподключится с Last-Event-ID
+				if ctx.Err() == nil {
+					slog.ErrorContext(ctx, "read user events error", slog.String("err", err.Error()))
+				}
+				return nil
+			}
+			for _, e := range events {
+				if err := writeEvent(res, e); err != nil {
+					return nil
+				}
+				lastID = e.ID
+			}
+			res.Flush()
+			if len(events) < eventsBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-wake:
+		case <-heartbeat.C:
+			fmt.Fprint(res, ": ping\n\n")
+			res.Flush()
+		case <-ctx.Done():
+			return nil
+		case <-s.events.done:
+			return nil
+		}
+	}
+}
+
+// parseLastEventID возвращает id последнего полученного клиентом события
+// и признак того, что клиент продолжает поток
+func parseLastEventID(c echo.Context) (int64, bool, error) {
+	raw := c.Request().Header.Get(headerLastEventID)
+	if raw == "" {
+		raw = c.QueryParam("last_event_id")
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, errInvalidLastEventID
+	}
+	return id, true, nil
+}
+
+// writeEvent пишет событие в формате text/event-stream
+func writeEvent(w io.Writer, e storagemart.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,114 @@
+package servermart
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+func TestEventHub(t *testing.T) {
+	h := newEventHub()
+	alice, unsubAlice := h.subscribe("alice")
+	bob, unsubBob := h.subscribe("bob")
+	defer unsubBob()
+
+	// Несколько уведомлений подряд схлопываются в один сигнал
+	h.notify("alice")
+	h.notify("alice")
+	select {
+	case <-alice:
+	default:
+		t.Fatal("alice is not notified")
+	}
+	select {
+	case <-alice:
+		t.Error("notifications are not coalesced")
+	case <-bob:
+		t.Error("bob is notified about alice's event")
+	default:
+	}
+
+	// Пустой логин будит всех
+	h.notify("")
+	for name, ch := range map[string]<-chan struct{}{"alice": alice, "bob": bob} {
+		select {
+		case <-ch:
+		default:
+			t.Errorf("%s is not notified", name)
+		}
+	}
+
+	unsubAlice()
+	h.notify("alice")
+	if _, ok := h.subs["alice"]; ok {
+		t.Error("alice is still subscribed")
+	}
+
+	h.close()
+	h.close()
+	select {
+	case <-h.done:
+	default:
+		t.Error("hub is not closed")
+	}
+}
+
+func TestParseLastEventID(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		query      string
+		wantID     int64
+		wantResume bool
+		wantErr    bool
+	}{
+		{name: "new", wantID: 0},
+		{name: "header", header: "42", wantID: 42, wantResume: true},
+		{name: "query", query: "last_event_id=7", wantID: 7, wantResume: true},
+		{name: "header_first", header: "42", query: "last_event_id=7", wantID: 42, wantResume: true},
+		{name: "zero", header: "0", wantID: 0, wantResume: true},
+		{name: "negative", header: "-1", wantErr: true},
+		{name: "not_number", query: "last_event_id=abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/events?"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(headerLastEventID, tt.header)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			id, resume, err := parseLastEventID(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseLastEventID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.wantID || resume != tt.wantResume {
+				t.Errorf("parseLastEventID() = %d, %v, want %d, %v", id, resume, tt.wantID, tt.wantResume)
+			}
+		})
+	}
+}
+
+func TestWriteEvent(t *testing.T) {
+	e := storagemart.Event{
+		ID:        5,
+		Type:      storagemart.EventOrderStatus,
+		Data:      json.RawMessage(`{"number":"12345678903","status":"PROCESSED","accrual":500}`),
+		CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	var sb strings.Builder
+	if err := writeEvent(&sb, e); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 5\nevent: order.status\n" +
+		`data: {"id":5,"type":"order.status","data":{"number":"12345678903","status":"PROCESSED","accrual":500},"created_at":"2024-05-01T10:00:00Z"}` +
+		"\n\n"
+	if sb.String() != want {
+		t.Errorf("writeEvent() = %q, want %q", sb.String(), want)
+	}
+}
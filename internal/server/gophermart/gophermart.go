@@ -1,45 +1,118 @@
 package servermart
 
 import (
-	"context"
-	"log/slog"
+	"time"
 
+	clientaccrual "github.com/mi4r/gophermart/internal/client/accrual"
+	"github.com/mi4r/gophermart/internal/rules"
 	"github.com/mi4r/gophermart/internal/server"
 	"github.com/mi4r/gophermart/internal/storage"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	workermart "github.com/mi4r/gophermart/internal/worker/gophermart"
+	"github.com/mi4r/gophermart/lib/breaker"
 )
 
 type Gophermart struct {
 	*server.Server
-	storage storage.StorageGophermart
+	storage        storage.StorageGophermart
+	accrual        *clientaccrual.Client
+	accrualBreaker *breaker.Breaker
+	worker         *workermart.Worker
+	// Сколько живет резерв баллов под списание
+	reservationTTL time.Duration
+	// За сколько до сгорания показывать баллы в expiring_soon
+	expiryNotice time.Duration
+	// Уровни лояльности для профиля
+	tiers storagemart.Tiers
+	// Правила, через которые проходят списания и резервы
+	withdrawRules *rules.Engine
+	// Лимиты переводов между пользователями
+	transferRules *rules.Engine
+	// Уведомления открытых потоков /api/user/events
+	events *eventHub
 }
 
 func NewGophermart(server *server.Server) *Gophermart {
 	return &Gophermart{
-		Server: server,
+		Server:        server,
+		events:        newEventHub(),
+		withdrawRules: rules.New(rules.Config{}),
+		transferRules: rules.New(rules.Config{}),
 	}
 }
 
+// SetStorage задает уже открытое хранилище с актуальной схемой
 func (s *Gophermart) SetStorage(storage storage.StorageGophermart) {
 	s.storage = storage
-	ctx := context.Background()
-	if err := s.storage.Open(ctx); err != nil {
-		slog.Error(err.Error())
-		s.Shutdown()
-	}
+}
 
-	// Try auto-migration
-	s.storage.Migrate(s.Config.MigrDirName)
+// SetReservationTTL задает время жизни резерва баллов под списание
+func (s *Gophermart) SetReservationTTL(ttl time.Duration) {
+	s.reservationTTL = ttl
+}
+
+// SetExpiryNotice задает период, за который баланс предупреждает о сгорании баллов
+func (s *Gophermart) SetExpiryNotice(notice time.Duration) {
+	s.expiryNotice = notice
+}
+
+// SetTiers задает уровни лояльности, по которым профиль показывает прогресс
+func (s *Gophermart) SetTiers(tiers storagemart.Tiers) {
+	s.tiers = tiers
+}
+
+// SetWithdrawRules задает правила списания. По умолчанию проверяется только положительная сумма
+func (s *Gophermart) SetWithdrawRules(engine *rules.Engine) {
+	s.withdrawRules = engine
+}
 
+// SetTransferRules задает лимиты переводов. По умолчанию проверяется только положительная сумма
+func (s *Gophermart) SetTransferRules(engine *rules.Engine) {
+	s.transferRules = engine
+}
+
+// SetAccrual передает клиент Accrual System и его предохранитель для readiness
+func (s *Gophermart) SetAccrual(client *clientaccrual.Client, b *breaker.Breaker) {
+	s.accrual = client
+	s.accrualBreaker = b
+}
+
+// SetWorker передает воркер опроса Accrual System для readiness
+func (s *Gophermart) SetWorker(worker *workermart.Worker) {
+	s.worker = worker
 }
 
 func (s *Gophermart) SetRoutes() {
 	s.Router.GET("/ping", s.pingHandler)
+	s.setHealthChecks()
 	gUsers := s.Router.Group("/api/user")
 	gUsers.POST("/register", s.userRegisterHandler)
 	gUsers.POST("/login", s.userLoginHandler)
+	gUsers.POST("/password", s.userChangePasswordHandler)
 	gUsers.POST("/orders", s.userPostOrdersHandler)
 	gUsers.GET("/orders", s.userGetOrdersHandler)
 	gUsers.GET("/balance", s.userGetBalanceHandler)
+	gUsers.GET("/profile", s.userGetProfileHandler)
+	gUsers.GET("/referrals", s.userGetReferralsHandler)
 	gUsers.POST("/balance/withdraw", s.userBalanceWithdrawHandler)
 	gUsers.GET("/withdrawals", s.getBalanceWithdrawalsHandler)
+	gUsers.POST("/transfer", s.userTransferHandler)
+	gUsers.POST("/balance/reserve", s.userBalanceReserveHandler)
+	gUsers.POST("/withdrawals/:order/cancel", s.withdrawalCancelHandler)
+	gUsers.GET("/events", s.userEventsHandler)
+	// Потоки событий бесконечны - при остановке закрываем их сами, иначе Shutdown ждет таймаут
+	s.Router.Server.RegisterOnShutdown(s.events.close)
+
+	// Подтверждение и возврат списаний решает магазин, а не покупатель
+	if s.Config.AdminToken != "" {
+		gAdmin := s.Router.Group("/api/admin", server.AdminTokenMiddleware(s.Config.AdminToken))
+		gAdmin.POST("/withdrawals/:login/:order/confirm", s.adminWithdrawalConfirmHandler)
+		gAdmin.POST("/withdrawals/:login/:order/cancel", s.adminWithdrawalCancelHandler)
+		gAdmin.POST("/withdrawals/:login/:order/refund", s.adminWithdrawalRefundHandler)
+	}
+
+	// Без секрета проверить подпись невозможно - остается только опрос
+	if s.Config.WebhookSecret != "" {
+		s.Router.POST("/api/accrual/webhook", s.accrualWebhookHandler)
+	}
 }
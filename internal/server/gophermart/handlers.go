@@ -1,7 +1,6 @@
 package servermart
 
 import (
-	"context"
 	"errors"
 	"io"
 	"log/slog"
@@ -11,10 +10,12 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/rules"
 	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
 	"github.com/mi4r/gophermart/lib/helper"
 
 	"github.com/mi4r/gophermart/internal/auth"
+	"github.com/mi4r/gophermart/internal/server"
 )
 
 const (
@@ -22,6 +23,7 @@ const (
 	orderAlreadyUpload string = "order number already uploaded by this user"
 	orderAccepted      string = "order number accepted for processing"
 	withdrawCompleted  string = "withdraw balance completed"
+	passwordChanged    string = "password has been changed"
 )
 
 var (
@@ -32,37 +34,59 @@ var (
 	errInvalidOrderID       = errors.New("invalid order number format")
 	errOrderUploadByAnother = errors.New("order number already uploaded by another user")
 	errInsufficientFunds    = errors.New("insufficient funds")
+	errWithdrawalExists     = errors.New("withdrawal for this order number already exists")
 )
 
+// WithdrawRequest - запрос на списание или резерв баллов в счет оплаты заказа
+type WithdrawRequest struct {
+	Order string  `json:"order" example:"2377225624"`
+	Sum   float64 `json:"sum" example:"751"`
+} // @name WithdrawRequest
+
+// RegisterRequest - логин, пароль и необязательный код пригласившего
+type RegisterRequest struct {
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty" example:"K3QF7ZR2XA"`
+} // @name RegisterRequest
+
+// PasswordChangeRequest - запрос на смену пароля
+type PasswordChangeRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+} // @name PasswordChangeRequest
+
 // Ping
 // @Description Простая проверка состояния сервера
 // @Tags Разное
 // @Success 200 {string} pong
+// @Failure 503 {string} string "Хранилище недоступно"
 // @Router /ping [get]
 func (s *Gophermart) pingHandler(c echo.Context) error {
-	storageOK := "pong"
-	if err := s.storage.Ping(); err != nil {
-		storageOK = err.Error()
+	if err := s.storage.Ping(c.Request().Context()); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, err.Error())
 	}
-	return c.JSON(http.StatusOK, storageOK)
+	return c.JSON(http.StatusOK, "pong")
 }
 
 // User register
 // @Summary Регистрация пользователя
 // @Description Для передачи аутентификационных данных используется механизм cookies
+// @Description referral_code - код пригласившего пользователя из /api/user/referrals, необязателен.
 // @Tags Пользователь
 // @Accept  json
-// @Param creds body Creds true "Логин и пароль не зарегистрированного пользователя"
+// @Param creds body RegisterRequest true "Логин и пароль не зарегистрированного пользователя"
 // @Router /api/user/register [post]
 // @Success 200 {string} string "Пользователь успешно зарегистрирован и аутентифицирован"
-// @Failure 400 {string} string "Неверный формат запроса"
+// @Failure 400 {string} string "Неверный формат запроса или неизвестный код приглашения"
 // @Failure 409 {string} string "Логин уже занят"
 // @Failure 500 {string} string "Внутренняя ошибка сервера"
 func (s *Gophermart) userRegisterHandler(c echo.Context) error {
-	var creds storagemart.Creds
-	if err := c.Bind(&creds); err != nil {
+	var req RegisterRequest
+	if err := c.Bind(&req); err != nil {
 		return c.String(http.StatusBadRequest, err.Error())
 	}
+	creds := storagemart.Creds{Login: req.Login, Password: req.Password}
 
 	if creds.IsEmpty() {
 		return c.String(http.StatusBadRequest, errEmptyLoginOrPassword.Error())
@@ -70,17 +94,25 @@ func (s *Gophermart) userRegisterHandler(c echo.Context) error {
 
 	user, err := storagemart.NewUserFromCreds(creds)
 	if err != nil {
-		slog.Error(err.Error())
+		slog.ErrorContext(c.Request().Context(), err.Error())
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
+	if code := storagemart.NormalizeReferralCode(req.ReferralCode); code != "" {
+		user.ReferredBy, err = s.storage.UserLoginByReferralCode(c.Request().Context(), code)
+		if errors.Is(err, storagemart.ErrUnknownReferralCode) {
+			return c.String(http.StatusBadRequest, err.Error())
+		} else if err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+	}
 
 	// Ожидаются еще ответы 409 - Логин уже занят
-	if err := s.storage.UserCreate(context.Background(), user); err != nil {
+	if err := s.storage.UserCreate(c.Request().Context(), user); err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
 			return c.String(http.StatusConflict, errLoginIsExists.Error())
 		}
-		slog.Error(err.Error())
+		slog.ErrorContext(c.Request().Context(), err.Error())
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
@@ -109,7 +141,7 @@ func (s *Gophermart) userLoginHandler(c echo.Context) error {
 		return c.String(http.StatusBadRequest, errEmptyLoginOrPassword.Error())
 	}
 
-	user, err := s.storage.UserReadOne(context.Background(), creds.Login)
+	user, err := s.storage.UserReadOne(c.Request().Context(), creds.Login)
 	if err == pgx.ErrNoRows {
 		return c.String(http.StatusUnauthorized, pgx.ErrNoRows.Error())
 	} else if err != nil {
@@ -125,6 +157,52 @@ func (s *Gophermart) userLoginHandler(c echo.Context) error {
 	return c.String(http.StatusOK, successUserLogin)
 }
 
+// Password change
+// @Summary Смена пароля
+// @Description Хендлер доступен только авторизованному пользователю.
+// @Description После смены пароля списания на время запрещены, см. withdraw_password_cooldown.
+// @Tags Пользователь
+// @Accept  json
+// @Produce text/plain
+// @Param request body PasswordChangeRequest true "Текущий и новый пароль"
+// @Success 200 {string} string "Пароль изменен"
+// @Failure 400 {string} string "Неверный формат запроса"
+// @Failure 401 {string} string "Пользователь не авторизован или текущий пароль неверен"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/user/password [post]
+func (s *Gophermart) userChangePasswordHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+	var req PasswordChangeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if req.OldPassword == "" || req.NewPassword == "" {
+		return c.String(http.StatusBadRequest, errEmptyLoginOrPassword.Error())
+	}
+
+	ctx := c.Request().Context()
+	user, err := s.storage.UserReadOne(ctx, login)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if !user.PasswordCompare(storagemart.Creds{Login: login, Password: req.OldPassword}) {
+		return c.String(http.StatusUnauthorized, errPasswordInvalid.Error())
+	}
+
+	newCreds := storagemart.Creds{Login: login, Password: req.NewPassword}
+	hash, err := newCreds.Password2Hash()
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if err := s.storage.UserUpdatePassword(ctx, login, hash); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.String(http.StatusOK, passwordChanged)
+}
+
 // Order register
 // @Summary Загрузка номера заказа
 // @Description Хендлер доступен только аутентифицированным пользователям
@@ -156,6 +234,7 @@ func (s *Gophermart) userPostOrdersHandler(c echo.Context) error {
 	}
 
 	orderNumber := strings.TrimSpace(string(bodyContent))
+	server.SetLogOrder(c, orderNumber)
 
 	if !helper.IsLuhn(orderNumber) {
 		return c.String(http.StatusUnprocessableEntity, errInvalidOrderID.Error())
@@ -165,7 +244,7 @@ func (s *Gophermart) userPostOrdersHandler(c echo.Context) error {
 	//
 
 	var emptyOrder storagemart.Order
-	storedOrder, err := s.storage.UserOrderReadOne(context.Background(), orderNumber)
+	storedOrder, err := s.storage.UserOrderReadOne(c.Request().Context(), orderNumber)
 	if err != nil && err != pgx.ErrNoRows {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
@@ -182,7 +261,7 @@ func (s *Gophermart) userPostOrdersHandler(c echo.Context) error {
 		}
 	}
 
-	err = s.storage.UserOrderCreate(context.Background(), login, orderNumber)
+	err = s.storage.UserOrderCreate(c.Request().Context(), login, orderNumber)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
@@ -195,11 +274,21 @@ func (s *Gophermart) userPostOrdersHandler(c echo.Context) error {
 // @Description Хендлер доступен только авторизованному пользователю
 // @Description Номера заказа в выдаче должны быть отсортированы по времени загрузки от самых старых к самым новым
 // @Description Формат даты — RFC3339.
+// @Description Без параметров возвращается весь список. С limit возвращается страница,
+// @Description курсор следующей страницы приходит в заголовке X-Next-Cursor.
 // @Tags Заказы
 // @Accept  text/plain
 // @Produce json
+// @Param limit query int false "Размер страницы, от 1 до 1000"
+// @Param cursor query string false "Курсор из заголовка X-Next-Cursor"
+// @Param status query string false "Статусы через запятую, например NEW,PROCESSING"
+// @Param from query string false "Загружены не раньше, RFC3339"
+// @Param to query string false "Загружены раньше, RFC3339"
+// @Param sort query string false "Порядок по времени загрузки: asc или desc" Enums(asc, desc)
 // @Success 200 {object} []Order "Успешная обработка запроса"
 // @Success 204 {string} string "Нет данных для ответа"
+// @Header 200 {string} X-Next-Cursor "Курсор следующей страницы, если она есть"
+// @Failure 400 {string} string "Неверные параметры списка"
 // @Failure 401 {string} string "Пользователь не авторизован"
 // @Failure 500 {string} string "Внутренняя ошибка сервера"
 // @Router /api/user/orders [get]
@@ -209,10 +298,18 @@ func (s *Gophermart) userGetOrdersHandler(c echo.Context) error {
 		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
 	}
 
-	orders, err := s.storage.UserOrdersReadByLogin(context.Background(), login)
+	q, err := parseListQuery(c, orderStatuses)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	orders, err := s.storage.UserOrdersList(c.Request().Context(), login, pageLimit(q))
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
+	orders = setNextCursor(c, orders, q.Limit, func(o storagemart.Order) storagemart.Cursor {
+		return storagemart.Cursor{Time: o.UploadedAt, Number: o.Number}
+	})
 
 	if len(orders) == 0 {
 		return c.NoContent(http.StatusNoContent)
@@ -226,6 +323,8 @@ func (s *Gophermart) userGetOrdersHandler(c echo.Context) error {
 // @Description Хендлер доступен только авторизованному пользователю.
 // @Description В ответе должны содержаться данные о текущей сумме баллов лояльности,
 // @Description а также сумме использованных за весь период регистрации баллов.
+// @Description reserved - баллы, удержанные под неподтвержденные списания, в current они не входят.
+// @Description expiring_soon - сколько из current скоро сгорит, expiring_at - срок ближайшей сгорающей партии.
 // @Tags Пользователь
 // @Produce json
 // @Success 200 {object} Balance "Успешная обработка запроса"
@@ -238,12 +337,71 @@ func (s *Gophermart) userGetBalanceHandler(c echo.Context) error {
 		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
 	}
 
-	user, err := s.storage.UserReadOne(context.Background(), login)
+	ctx := c.Request().Context()
+	user, err := s.storage.UserReadOne(ctx, login)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	balance := user.GetBalance()
+	balance.ExpiringSoon, balance.ExpiringAt, err = s.storage.UserPointsExpiring(ctx, login, s.expiryNotice)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, balance)
+}
+
+// Profile get
+// @Summary Уровень лояльности пользователя
+// @Description Хендлер доступен только авторизованному пользователю.
+// @Description Уровень зависит от суммы за скользящий период и пересчитывается воркером периодически.
+// @Description multiplier - во сколько раз увеличивается начисление по заказу,
+// @Description to_next - сколько осталось набрать до next_tier.
+// @Tags Пользователь
+// @Produce json
+// @Success 200 {object} Profile "Успешная обработка запроса"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/user/profile [get]
+func (s *Gophermart) userGetProfileHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+
+	user, err := s.storage.UserReadOne(c.Request().Context(), login)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, s.tiers.NewProfile(login, user.Tier, user.TierScore))
+}
+
+// Referrals get
+// @Summary Приглашения пользователя
+// @Description Хендлер доступен только авторизованному пользователю.
+// @Description code - код для поля referral_code при регистрации приглашенного.
+// @Description Бонус обоим начисляется один раз, когда первый заказ приглашенного обработан.
+// @Description rejected - приглашенные, за которых бонус не положен, pending - еще без обработанного заказа,
+// @Description earned - сколько баллов принесли приглашения.
+// @Tags Пользователь
+// @Produce json
+// @Success 200 {object} ReferralStats "Успешная обработка запроса"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/user/referrals [get]
+func (s *Gophermart) userGetReferralsHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+
+	stats, err := s.storage.UserReferralStats(c.Request().Context(), login)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
-	return c.JSON(http.StatusOK, user.GetBalance())
+	return c.JSON(http.StatusOK, stats)
 }
 
 // Balance withdraw
@@ -254,30 +412,33 @@ func (s *Gophermart) userGetBalanceHandler(c echo.Context) error {
 // @Tags Заказы
 // @Accept  json
 // @Produce text/plain
+// @Param request body WithdrawRequest true "Номер заказа и сумма"
 // @Success 200 {string} string "Успешная обработка запроса"
+// @Failure 400 {string} string "Неверный формат запроса или сумма не больше нуля"
 // @Failure 401 {string} string "Пользователь не авторизован"
 // @Failure 402 {string} string "На счету недостаточно средств"
-// @Failure 422 {string} string "Неверный номер заказа"
+// @Failure 403 {string} string "Превышен дневной или месячный лимит или списания запрещены после смены пароля"
+// @Failure 409 {string} string "Списание в счет этого заказа уже было"
+// @Failure 422 {string} string "Неверный номер заказа или сумма вне допустимых границ"
 // @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Header 400,403,422 {string} X-Withdrawal-Rule "Нарушенное правило списания"
 // @Router /api/user/balance/withdraw [post]
 func (s *Gophermart) userBalanceWithdrawHandler(c echo.Context) error {
 	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
 	if !ok {
 		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
 	}
-	var req struct {
-		Order string  `json:"order"`
-		Sum   float64 `json:"sum"`
-	}
-
+	var req WithdrawRequest
 	if err := c.Bind(&req); err != nil {
 		return c.String(http.StatusBadRequest, "Invalid request format")
 	}
+	server.SetLogOrder(c, req.Order)
 	if !helper.IsLuhn(req.Order) {
 		return c.String(http.StatusUnprocessableEntity, errInvalidOrderID.Error())
 	}
 
-	user, err := s.storage.UserReadOne(context.Background(), login)
+	ctx := c.Request().Context()
+	user, err := s.storage.UserReadOne(ctx, login)
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
@@ -286,8 +447,20 @@ func (s *Gophermart) userBalanceWithdrawHandler(c echo.Context) error {
 		return c.String(http.StatusPaymentRequired, errInsufficientFunds.Error())
 	}
 
-	err = s.storage.WithdrawBalance(context.Background(), login, req.Order, req.Sum, curBalance)
+	check := s.withdrawalCheck(login, req)
+	err = s.storage.WithdrawBalance(ctx, login, req.Order, req.Sum, curBalance, check.check)
+	countRuleHits(check, err)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		var v *rules.Violation
+		switch {
+		case errors.As(err, &v):
+			return ruleViolationResponse(c, v)
+		case errors.Is(err, storagemart.ErrInsufficientFunds):
+			return c.String(http.StatusPaymentRequired, errInsufficientFunds.Error())
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return c.String(http.StatusConflict, errWithdrawalExists.Error())
+		}
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
 
@@ -299,10 +472,22 @@ func (s *Gophermart) userBalanceWithdrawHandler(c echo.Context) error {
 // @Description Хендлер доступен только авторизованному пользователю.
 // @Description Факты выводов в выдаче должны быть отсортированы по времени вывода от самых старых к самым новым.
 // @Description Формат даты — RFC3339.
+// @Description Без параметров возвращается весь список. С limit возвращается страница,
+// @Description курсор следующей страницы приходит в заголовке X-Next-Cursor.
+// @Description Переводы баллов идут в том же списке: type TRANSFER_OUT или TRANSFER_IN,
+// @Description order - номер перевода вида T42, counterparty - второй участник.
 // @Tags Заказы
 // @Produce json
-// @Success 200 {string} string "Успешная обработка запроса"
+// @Param limit query int false "Размер страницы, от 1 до 1000"
+// @Param cursor query string false "Курсор из заголовка X-Next-Cursor"
+// @Param status query string false "Статусы через запятую, например PENDING,PROCESSED"
+// @Param from query string false "Списаны не раньше, RFC3339"
+// @Param to query string false "Списаны раньше, RFC3339"
+// @Param sort query string false "Порядок по времени списания: asc или desc" Enums(asc, desc)
+// @Success 200 {object} []Withdrawal "Успешная обработка запроса"
+// @Header 200 {string} X-Next-Cursor "Курсор следующей страницы, если она есть"
 // @Failure 204 {string} string "Нет ни одного списания"
+// @Failure 400 {string} string "Неверные параметры списка"
 // @Failure 401 {string} string "Пользователь не авторизован"
 // @Failure 500 {string} string "Внутренняя ошибка сервера"
 // @Router /api/user/withdrawals [get]
@@ -312,10 +497,18 @@ func (s *Gophermart) getBalanceWithdrawalsHandler(c echo.Context) error {
 		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
 	}
 
-	withdrawals, err := s.storage.GetUserWithdrawals(context.Background(), login)
+	q, err := parseListQuery(c, withdrawalStatuses)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	withdrawals, err := s.storage.UserWithdrawalsList(c.Request().Context(), login, pageLimit(q))
 	if err != nil {
 		return c.String(http.StatusInternalServerError, err.Error())
 	}
+	withdrawals = setNextCursor(c, withdrawals, q.Limit, func(w storagemart.Withdrawal) storagemart.Cursor {
+		return storagemart.Cursor{Time: w.ProcessedAt, Number: w.Order}
+	})
 
 	if len(withdrawals) == 0 {
 		return c.NoContent(http.StatusNoContent)
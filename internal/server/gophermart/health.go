@@ -0,0 +1,38 @@
+package servermart
+
+import (
+	"context"
+
+	"github.com/mi4r/gophermart/internal/server"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+	"github.com/mi4r/gophermart/internal/worker"
+	"github.com/mi4r/gophermart/lib/breaker"
+)
+
+// setHealthChecks регистрирует проверки для /readyz.
+// Accrual System некритичен: без него пользователи продолжают работать,
+// а заказы будут опрошены позже. Хранилище и воркер задаются после SetRoutes,
+// поэтому обращаемся к ним лениво
+func (s *Gophermart) setHealthChecks() {
+	s.AddReadinessCheck("storage", true, func(ctx context.Context) (any, error) {
+		return nil, s.storage.Ping(ctx)
+	})
+	s.AddReadinessCheck("migrations", true, server.MigrationsCheck(func(ctx context.Context) (migrations.Status, error) {
+		return s.storage.MigrationStatus(ctx)
+	}))
+	s.AddReadinessCheck("worker", true, server.WorkerCheck(func() worker.Status {
+		return s.worker.Status()
+	}, func(ctx context.Context) (int, error) {
+		return s.storage.UserOrderCountPending(ctx)
+	}))
+	s.AddReadinessCheck("accrual", false, func(ctx context.Context) (any, error) {
+		details := map[string]any{
+			"address": s.accrual.Address(),
+			"breaker": s.accrualBreaker.Snapshot(),
+		}
+		if s.accrualBreaker.State() == breaker.StateOpen {
+			return details, breaker.ErrOpen
+		}
+		return details, s.accrual.Ping(ctx)
+	})
+}
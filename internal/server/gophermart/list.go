@@ -0,0 +1,113 @@
+package servermart
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// Курсор следующей страницы отдается заголовком, чтобы тело ответа
+// осталось тем же массивом, что и без пагинации
+const headerNextCursor = "X-Next-Cursor"
+
+// Допустимые значения фильтра status для списков
+var (
+	orderStatuses = map[string]bool{
+		string(storagedefault.StatusNew):        true,
+		string(storagedefault.StatusRegistered): true,
+		string(storagedefault.StatusProcessing): true,
+		string(storagedefault.StatusInvalid):    true,
+		string(storagedefault.StatusProcessed):  true,
+	}
+	withdrawalStatuses = map[string]bool{
+		string(storagemart.WithdrawalPending):   true,
+		string(storagemart.WithdrawalProcessed): true,
+		string(storagemart.WithdrawalCancelled): true,
+		string(storagemart.WithdrawalExpired):   true,
+		string(storagemart.WithdrawalRefunded):  true,
+	}
+)
+
+// parseListQuery разбирает параметры списка: limit, cursor, from, to, sort
+// и status через запятую, значения которого проверяются по statuses
+func parseListQuery(c echo.Context, statuses map[string]bool) (storagemart.ListQuery, error) {
+	var q storagemart.ListQuery
+
+	if s := c.QueryParam("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > storagemart.MaxListLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", storagemart.MaxListLimit)
+		}
+		q.Limit = limit
+	}
+	if s := c.QueryParam("cursor"); s != "" {
+		cursor, err := storagemart.DecodeCursor(s)
+		if err != nil {
+			return q, err
+		}
+		q.After = &cursor
+	}
+	if s := c.QueryParam("status"); s != "" {
+		for _, part := range strings.Split(s, ",") {
+			status := strings.ToUpper(strings.TrimSpace(part))
+			if !statuses[status] {
+				return q, fmt.Errorf("unknown status %q", part)
+			}
+			q.Statuses = append(q.Statuses, status)
+		}
+	}
+	var err error
+	if q.From, err = parseListTime(c, "from"); err != nil {
+		return q, err
+	}
+	if q.To, err = parseListTime(c, "to"); err != nil {
+		return q, err
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+	switch c.QueryParam("sort") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("sort must be asc or desc")
+	}
+	return q, nil
+}
+
+func parseListTime(c echo.Context, name string) (time.Time, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be RFC3339 date", name)
+	}
+	return t.UTC(), nil
+}
+
+// pageLimit - сколько записей запросить у хранилища: на одну больше страницы,
+// чтобы узнать, есть ли следующая
+func pageLimit(q storagemart.ListQuery) storagemart.ListQuery {
+	if q.Limit > 0 {
+		q.Limit++
+	}
+	return q
+}
+
+// setNextCursor обрезает лишнюю запись и отдает курсор на последнюю оставшуюся
+func setNextCursor[T any](c echo.Context, items []T, limit int, cursor func(T) storagemart.Cursor) []T {
+	if limit <= 0 || len(items) <= limit {
+		return items
+	}
+	items = items[:limit]
+	c.Response().Header().Set(headerNextCursor, cursor(items[limit-1]).Encode())
+	return items
+}
@@ -0,0 +1,131 @@
+package servermart
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+func newListContext(query string) (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders?"+query, nil)
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestParseListQuery(t *testing.T) {
+	cursor := storagemart.Cursor{Time: time.Date(2024, 5, 1, 10, 0, 0, 123000, time.UTC), Number: "12345678903"}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    storagemart.ListQuery
+		wantErr bool
+	}{
+		{name: "default", query: "", want: storagemart.ListQuery{}},
+		{
+			name:  "full",
+			query: "limit=10&status=new,Processed&from=2024-05-01T00:00:00Z&to=2024-05-02T03:00:00%2B03:00&sort=desc&cursor=" + cursor.Encode(),
+			want: storagemart.ListQuery{
+				Limit:    10,
+				After:    &cursor,
+				Statuses: []string{"NEW", "PROCESSED"},
+				From:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+				Desc:     true,
+			},
+		},
+		{name: "zero_limit", query: "limit=0", wantErr: true},
+		{name: "big_limit", query: "limit=1001", wantErr: true},
+		{name: "bad_cursor", query: "cursor=abc", wantErr: true},
+		{name: "bad_status", query: "status=DONE", wantErr: true},
+		{name: "bad_date", query: "from=2024-05-01", wantErr: true},
+		{name: "empty_range", query: "from=2024-05-02T00:00:00Z&to=2024-05-01T00:00:00Z", wantErr: true},
+		{name: "bad_sort", query: "sort=up", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newListContext(tt.query)
+			got, err := parseListQuery(c, orderStatuses)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Limit != tt.want.Limit || got.Desc != tt.want.Desc ||
+				!got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) {
+				t.Errorf("parseListQuery() = %+v, want %+v", got, tt.want)
+			}
+			if len(got.Statuses) != len(tt.want.Statuses) {
+				t.Fatalf("statuses = %v, want %v", got.Statuses, tt.want.Statuses)
+			}
+			for i := range got.Statuses {
+				if got.Statuses[i] != tt.want.Statuses[i] {
+					t.Errorf("statuses = %v, want %v", got.Statuses, tt.want.Statuses)
+				}
+			}
+			if (got.After == nil) != (tt.want.After == nil) {
+				t.Fatalf("cursor = %v, want %v", got.After, tt.want.After)
+			}
+			if got.After != nil && (!got.After.Time.Equal(tt.want.After.Time) || got.After.Number != tt.want.After.Number) {
+				t.Errorf("cursor = %+v, want %+v", *got.After, *tt.want.After)
+			}
+		})
+	}
+}
+
+func TestParseListQuery_WithdrawalStatuses(t *testing.T) {
+	c, _ := newListContext("status=pending,REFUNDED")
+	q, err := parseListQuery(c, withdrawalStatuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Statuses) != 2 || q.Statuses[0] != "PENDING" || q.Statuses[1] != "REFUNDED" {
+		t.Errorf("statuses = %v, want [PENDING REFUNDED]", q.Statuses)
+	}
+	// Статусы заказов к списаниям не относятся
+	c, _ = newListContext("status=NEW")
+	if _, err := parseListQuery(c, withdrawalStatuses); err == nil {
+		t.Error("want error for order status in withdrawals list")
+	}
+}
+
+func TestSetNextCursor(t *testing.T) {
+	now := time.Now().UTC()
+	orders := []storagemart.Order{
+		{Order: storagedefault.Order{Number: "1"}, UploadedAt: now},
+		{Order: storagedefault.Order{Number: "2"}, UploadedAt: now.Add(time.Second)},
+		{Order: storagedefault.Order{Number: "3"}, UploadedAt: now.Add(2 * time.Second)},
+	}
+	cursorOf := func(o storagemart.Order) storagemart.Cursor {
+		return storagemart.Cursor{Time: o.UploadedAt, Number: o.Number}
+	}
+
+	// Хранилище вернуло страницу и одну лишнюю запись - следующая страница есть
+	c, rec := newListContext("")
+	page := setNextCursor(c, orders, 2, cursorOf)
+	if len(page) != 2 {
+		t.Fatalf("page size = %d, want 2", len(page))
+	}
+	next, err := storagemart.DecodeCursor(rec.Header().Get(headerNextCursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Number != "2" || !next.Time.Equal(orders[1].UploadedAt) {
+		t.Errorf("next cursor = %+v, want order 2", next)
+	}
+
+	// Последняя страница - без курсора
+	c, rec = newListContext("")
+	if page := setNextCursor(c, orders, 3, cursorOf); len(page) != 3 {
+		t.Errorf("page size = %d, want 3", len(page))
+	}
+	if h := rec.Header().Get(headerNextCursor); h != "" {
+		t.Errorf("unexpected next cursor %q", h)
+	}
+}
@@ -0,0 +1,76 @@
+package servermart
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/auth"
+	"github.com/mi4r/gophermart/internal/rules"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+var errSelfTransfer = errors.New("cannot transfer points to yourself")
+
+// TransferRequest - запрос на перевод баллов другому пользователю
+type TransferRequest struct {
+	To  string  `json:"to" example:"family"`
+	Sum float64 `json:"sum" example:"100"`
+} // @name TransferRequest
+
+// Transfer
+// @Summary Перевод баллов другому пользователю
+// @Description Хендлер доступен только авторизованному пользователю.
+// @Description Баллы переходят с доступного баланса отправителя на доступный баланс получателя
+// @Description в одной транзакции. Перевод виден обоим в истории /api/user/withdrawals:
+// @Description TRANSFER_OUT у отправителя и TRANSFER_IN у получателя.
+// @Tags Пользователь
+// @Accept  json
+// @Produce json
+// @Param request body TransferRequest true "Логин получателя и сумма"
+// @Success 200 {object} Transfer "Перевод выполнен"
+// @Failure 400 {string} string "Неверный формат запроса, сумма не больше нуля или перевод самому себе"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 402 {string} string "На счету недостаточно средств"
+// @Failure 403 {string} string "Превышен лимит, переводы запрещены после смены пароля или счет заблокирован"
+// @Failure 404 {string} string "Получатель не найден"
+// @Failure 409 {string} string "Счет получателя заблокирован"
+// @Failure 422 {string} string "Сумма вне допустимых границ"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Header 400,403,422 {string} X-Withdrawal-Rule "Нарушенное правило перевода"
+// @Router /api/user/transfer [post]
+func (s *Gophermart) userTransferHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+	var req TransferRequest
+	if err := c.Bind(&req); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request format")
+	}
+	if req.To == "" {
+		return c.String(http.StatusBadRequest, storagemart.ErrRecipientNotFound.Error())
+	}
+	if req.To == login {
+		return c.String(http.StatusBadRequest, errSelfTransfer.Error())
+	}
+
+	check := newSpendingCheck(s.transferRules, login, req.To, req.Sum)
+	t, err := s.storage.Transfer(c.Request().Context(), login, req.To, req.Sum, check.check)
+	var v *rules.Violation
+	switch {
+	case errors.As(err, &v):
+		return ruleViolationResponse(c, v)
+	case errors.Is(err, storagemart.ErrInsufficientFunds):
+		return c.String(http.StatusPaymentRequired, errInsufficientFunds.Error())
+	case errors.Is(err, storagemart.ErrUserLocked):
+		return c.String(http.StatusForbidden, err.Error())
+	case errors.Is(err, storagemart.ErrRecipientNotFound):
+		return c.String(http.StatusNotFound, err.Error())
+	case errors.Is(err, storagemart.ErrRecipientLocked):
+		return c.String(http.StatusConflict, err.Error())
+	case err != nil:
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, t)
+}
@@ -0,0 +1,66 @@
+package servermart
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/server"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/lib/webhook"
+)
+
+var (
+	errInvalidWebhookEvent = errors.New("invalid webhook event")
+)
+
+// Accrual webhook
+// @Summary Прием событий о расчете начислений от Accrual System
+// @Description Подпись проверяется по заголовкам X-Webhook-Signature и X-Webhook-Timestamp
+// @Description Повторная доставка того же события не приводит к повторному начислению
+// @Tags Сервис
+// @Accept  json
+// @Param event body WebhookEvent true "Событие о заказе"
+// @Success 200 "Событие принято"
+// @Failure 400 {string} string "Неверный формат события"
+// @Failure 401 {string} string "Неверная подпись"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/accrual/webhook [post]
+func (s *Gophermart) accrualWebhookHandler(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := webhook.Verify(
+		s.Config.WebhookSecret, c.Request().Header, body,
+		time.Now(), webhook.DefaultTolerance,
+	); err != nil {
+		return c.String(http.StatusUnauthorized, err.Error())
+	}
+
+	var event storagedefault.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return c.String(http.StatusBadRequest, errInvalidWebhookEvent.Error())
+	}
+	if !event.Order.Status.IsFinal() {
+		return c.String(http.StatusBadRequest, errInvalidWebhookEvent.Error())
+	}
+
+	server.SetLogOrder(c, event.Order.Number)
+	slog.DebugContext(c.Request().Context(), "accrual webhook received",
+		slog.String("event", event.ID),
+		slog.String("status", string(event.Order.Status)),
+	)
+	if err := s.storage.UserOrderUpdateAll(
+		c.Request().Context(), []storagedefault.Order{event.Order},
+	); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,232 @@
+package servermart
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/auth"
+	"github.com/mi4r/gophermart/internal/metrics"
+	"github.com/mi4r/gophermart/internal/rules"
+	"github.com/mi4r/gophermart/internal/server"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	"github.com/mi4r/gophermart/lib/helper"
+)
+
+// Balance reserve
+// @Summary Резерв баллов под списание
+// @Description Хендлер доступен только авторизованному пользователю.
+// @Description Баллы переходят из доступных в удержанные. Списание в статусе PENDING нужно
+// @Description подтвердить или отменить до expires_at, иначе резерв снимется сам.
+// @Tags Заказы
+// @Accept  json
+// @Produce json
+// @Param request body WithdrawRequest true "Номер заказа и сумма"
+// @Success 200 {object} Withdrawal "Баллы удержаны"
+// @Failure 400 {string} string "Неверный формат запроса или сумма не больше нуля"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 402 {string} string "На счету недостаточно средств"
+// @Failure 403 {string} string "Превышен дневной или месячный лимит или списания запрещены после смены пароля"
+// @Failure 409 {string} string "Списание в счет этого заказа уже было"
+// @Failure 422 {string} string "Неверный номер заказа или сумма вне допустимых границ"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Header 400,403,422 {string} X-Withdrawal-Rule "Нарушенное правило списания"
+// @Router /api/user/balance/reserve [post]
+func (s *Gophermart) userBalanceReserveHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+	var req WithdrawRequest
+	if err := c.Bind(&req); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request format")
+	}
+	server.SetLogOrder(c, req.Order)
+	if !helper.IsLuhn(req.Order) {
+		return c.String(http.StatusUnprocessableEntity, errInvalidOrderID.Error())
+	}
+
+	check := s.withdrawalCheck(login, req)
+	w, err := s.storage.WithdrawalReserve(c.Request().Context(), login, req.Order, req.Sum, s.reservationTTL, check.check)
+	countRuleHits(check, err)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		var v *rules.Violation
+		switch {
+		case errors.As(err, &v):
+			return ruleViolationResponse(c, v)
+		case errors.Is(err, storagemart.ErrInsufficientFunds):
+			return c.String(http.StatusPaymentRequired, err.Error())
+		case errors.As(err, &pgErr) && pgErr.Code == "23505":
+			return c.String(http.StatusConflict, errWithdrawalExists.Error())
+		}
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, w)
+}
+
+// Withdrawal cancel
+// @Summary Отмена списания
+// @Description Удержанные баллы возвращаются на доступный баланс: PENDING -> CANCELLED
+// @Tags Заказы
+// @Produce json
+// @Param order path string true "Номер заказа списания"
+// @Success 200 {object} Withdrawal "Резерв снят"
+// @Failure 401 {string} string "Пользователь не авторизован"
+// @Failure 404 {string} string "Списание не найдено"
+// @Failure 409 {string} string "Списание не в статусе PENDING"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/user/withdrawals/{order}/cancel [post]
+func (s *Gophermart) withdrawalCancelHandler(c echo.Context) error {
+	login, ok := auth.ValidateUserCookie(c, s.Config.SecretKey)
+	if !ok {
+		return c.String(http.StatusUnauthorized, errUnauthorized.Error())
+	}
+	return s.withdrawalAction(c, login, s.storage.WithdrawalCancel)
+}
+
+// Admin withdrawal confirm
+// @Summary Подтверждение списания магазином
+// @Description Служебный маршрут, нужен заголовок Authorization: Bearer <admin_token>.
+// @Description Удержанные баллы списываются окончательно: PENDING -> PROCESSED
+// @Tags Служебные
+// @Produce json
+// @Param login path string true "Логин пользователя"
+// @Param order path string true "Номер заказа списания"
+// @Success 200 {object} Withdrawal "Списание подтверждено"
+// @Failure 401 {string} string "Неверный служебный токен"
+// @Failure 404 {string} string "Списание не найдено"
+// @Failure 409 {string} string "Списание не в статусе PENDING или резерв истек"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/admin/withdrawals/{login}/{order}/confirm [post]
+func (s *Gophermart) adminWithdrawalConfirmHandler(c echo.Context) error {
+	return s.withdrawalAction(c, c.Param("login"), s.storage.WithdrawalConfirm)
+}
+
+// Admin withdrawal cancel
+// @Summary Отмена списания магазином
+// @Description Служебный маршрут, нужен заголовок Authorization: Bearer <admin_token>.
+// @Description Удержанные баллы возвращаются на доступный баланс: PENDING -> CANCELLED
+// @Tags Служебные
+// @Produce json
+// @Param login path string true "Логин пользователя"
+// @Param order path string true "Номер заказа списания"
+// @Success 200 {object} Withdrawal "Резерв снят"
+// @Failure 401 {string} string "Неверный служебный токен"
+// @Failure 404 {string} string "Списание не найдено"
+// @Failure 409 {string} string "Списание не в статусе PENDING"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/admin/withdrawals/{login}/{order}/cancel [post]
+func (s *Gophermart) adminWithdrawalCancelHandler(c echo.Context) error {
+	return s.withdrawalAction(c, c.Param("login"), s.storage.WithdrawalCancel)
+}
+
+// Admin withdrawal refund
+// @Summary Возврат списанных баллов магазином
+// @Description Служебный маршрут, нужен заголовок Authorization: Bearer <admin_token>.
+// @Description При возврате заказа баллы возвращаются на доступный баланс: PROCESSED -> REFUNDED
+// @Tags Служебные
+// @Produce json
+// @Param login path string true "Логин пользователя"
+// @Param order path string true "Номер заказа списания"
+// @Success 200 {object} Withdrawal "Баллы возвращены"
+// @Failure 401 {string} string "Неверный служебный токен"
+// @Failure 404 {string} string "Списание не найдено"
+// @Failure 409 {string} string "Списание не в статусе PROCESSED"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /api/admin/withdrawals/{login}/{order}/refund [post]
+func (s *Gophermart) adminWithdrawalRefundHandler(c echo.Context) error {
+	return s.withdrawalAction(c, c.Param("login"), s.storage.WithdrawalRefund)
+}
+
+// withdrawalAction меняет статус списания пользователя login из пути запроса
+func (s *Gophermart) withdrawalAction(
+	c echo.Context,
+	login string,
+	action func(ctx context.Context, login, order string) (storagemart.Withdrawal, error),
+) error {
+	order := c.Param("order")
+	server.SetLogOrder(c, order)
+
+	w, err := action(c.Request().Context(), login, order)
+	switch {
+	case errors.Is(err, storagemart.ErrWithdrawalNotFound):
+		return c.String(http.StatusNotFound, err.Error())
+	case errors.Is(err, storagemart.ErrWithdrawalStatusChange):
+		return c.String(http.StatusConflict, err.Error())
+	case err != nil:
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, w)
+}
+
+// headerWithdrawalRule - заголовок с именем нарушенного правила списания
+const headerWithdrawalRule = "X-Withdrawal-Rule"
+
+// spendingCheck прогоняет трату через правила. Хранилище вызывает check в транзакции траты
+// со статистикой, прочитанной под блокировкой пользователя, поэтому лимиты не обойти
+// параллельными запросами
+type spendingCheck struct {
+	engine *rules.Engine
+	req    rules.Request
+	// Пометки последней проверки
+	flags []rules.Violation
+}
+
+func newSpendingCheck(engine *rules.Engine, login, target string, sum float64) *spendingCheck {
+	return &spendingCheck{
+		engine: engine,
+		req:    rules.Request{Login: login, Order: target, Sum: sum},
+	}
+}
+
+// check - storagemart.SpendingCheck. Запрет возвращается как *rules.Violation
+func (c *spendingCheck) check(stats storagemart.SpendingStats) ([]storagemart.WithdrawalFlag, error) {
+	req := c.req
+	req.Stats, req.Now = stats, time.Now()
+	flags, err := c.engine.Check(req)
+	if err != nil {
+		return nil, err
+	}
+	c.flags = flags
+	marks := make([]storagemart.WithdrawalFlag, len(flags))
+	for i, f := range flags {
+		marks[i] = storagemart.WithdrawalFlag{Rule: f.Rule, Reason: f.Reason}
+	}
+	return marks, nil
+}
+
+// withdrawalCheck проверяет списание правилами списания
+func (s *Gophermart) withdrawalCheck(login string, req WithdrawRequest) *spendingCheck {
+	return newSpendingCheck(s.withdrawRules, login, req.Order, req.Sum)
+}
+
+// countRuleHits считает в метриках запрет или пометки списания после ответа хранилища
+func countRuleHits(check *spendingCheck, err error) {
+	var v *rules.Violation
+	switch {
+	case errors.As(err, &v):
+		metrics.WithdrawalRuleHitsTotal.WithLabelValues(v.Rule, "rejected").Inc()
+	case err == nil:
+		for _, f := range check.flags {
+			metrics.WithdrawalRuleHitsTotal.WithLabelValues(f.Rule, "flagged").Inc()
+		}
+	}
+}
+
+// ruleViolationResponse отвечает на запрет списания: 400 - сумма не больше нуля,
+// 422 - сумма вне допустимых границ, 403 - лимит исчерпан или списания временно запрещены
+func ruleViolationResponse(c echo.Context, v *rules.Violation) error {
+	c.Response().Header().Set(headerWithdrawalRule, v.Rule)
+	switch v.Kind {
+	case rules.KindInvalid:
+		return c.String(http.StatusBadRequest, v.Reason)
+	case rules.KindAmount:
+		return c.String(http.StatusUnprocessableEntity, v.Reason)
+	default:
+		return c.String(http.StatusForbidden, v.Reason)
+	}
+}
@@ -0,0 +1,118 @@
+package servermart
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/auth"
+	"github.com/mi4r/gophermart/internal/rules"
+	"github.com/mi4r/gophermart/internal/server"
+	"github.com/mi4r/gophermart/internal/storage"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+func TestRuleViolationResponse(t *testing.T) {
+	tests := []struct {
+		kind rules.Kind
+		want int
+	}{
+		{rules.KindInvalid, http.StatusBadRequest},
+		{rules.KindAmount, http.StatusUnprocessableEntity},
+		{rules.KindDenied, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", nil)
+		c := echo.New().NewContext(req, rec)
+		v := &rules.Violation{Rule: "some_rule", Kind: tt.kind, Reason: "reason"}
+		if err := ruleViolationResponse(c, v); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != tt.want {
+			t.Errorf("kind %d: status = %d, want %d", tt.kind, rec.Code, tt.want)
+		}
+		if got := rec.Header().Get(headerWithdrawalRule); got != "some_rule" {
+			t.Errorf("%s = %q, want some_rule", headerWithdrawalRule, got)
+		}
+		if rec.Body.String() != "reason" {
+			t.Errorf("body = %q, want reason", rec.Body.String())
+		}
+	}
+}
+
+// refundStorage запоминает, чьи списания возвращали
+type refundStorage struct {
+	storage.StorageGophermart
+	refunded []string
+}
+
+func (s *refundStorage) WithdrawalRefund(_ context.Context, login, order string) (storagemart.Withdrawal, error) {
+	s.refunded = append(s.refunded, login+"/"+order)
+	return storagemart.Withdrawal{Order: order, Status: storagemart.WithdrawalRefunded}, nil
+}
+
+func TestWithdrawalRefund_AdminOnly(t *testing.T) {
+	st := &refundStorage{}
+	s := NewGophermart(server.NewServer(server.Config{SecretKey: "secret", AdminToken: "token"}))
+	s.SetStorage(st)
+	s.SetRoutes()
+
+	tests := []struct {
+		name   string
+		path   string
+		cookie bool
+		token  string
+		want   int
+	}{
+		{"user refunds own withdrawal", "/api/user/withdrawals/123/refund", true, "", http.StatusNotFound},
+		{"user cookie on admin route", "/api/admin/withdrawals/user/123/refund", true, "", http.StatusUnauthorized},
+		{"wrong admin token", "/api/admin/withdrawals/user/123/refund", false, "wrong", http.StatusUnauthorized},
+		{"admin token", "/api/admin/withdrawals/user/123/refund", false, "token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.cookie {
+				req.AddCookie(auth.GetUserCookie("user", "secret"))
+			}
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.Router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+	if len(st.refunded) != 1 || st.refunded[0] != "user/123" {
+		t.Errorf("refunded = %v, want only user/123 by admin", st.refunded)
+	}
+}
+
+func TestSpendingCheck(t *testing.T) {
+	engine := rules.New(rules.Config{DailyCap: 100, LargeAmount: 50})
+	check := newSpendingCheck(engine, "user", "123", 50)
+
+	// Лимит считается по статистике, которую передает хранилище
+	_, err := check.check(storagemart.SpendingStats{Day: 60})
+	var v *rules.Violation
+	if !errors.As(err, &v) || v.Rule != "daily_cap" {
+		t.Fatalf("check() error = %v, want daily_cap violation", err)
+	}
+
+	flags, err := check.check(storagemart.SpendingStats{Day: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 1 || flags[0].Rule != "large_amount" {
+		t.Errorf("flags = %+v, want large_amount", flags)
+	}
+	if len(check.flags) != 1 {
+		t.Errorf("check.flags = %+v, want one flag", check.flags)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+	"github.com/mi4r/gophermart/internal/worker"
+)
+
+const (
+	HealthStatusUp       = "up"
+	HealthStatusDown     = "down"
+	HealthStatusDegraded = "degraded"
+
+	healthCheckTimeout = 2 * time.Second
+)
+
+var (
+	errWorkerStopped = errors.New("worker is not running")
+)
+
+// HealthCheckFunc проверяет одну зависимость.
+// details попадают в ответ как есть, ошибка означает что зависимость недоступна
+type HealthCheckFunc func(ctx context.Context) (details any, err error)
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    HealthCheckFunc
+}
+
+// HealthCheckResult - результат проверки одной зависимости
+type HealthCheckResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Details any    `json:"details,omitempty"`
+} // @name HealthCheckResult
+
+// HealthReport - ответ readiness проверки
+type HealthReport struct {
+	Service string                       `json:"service"`
+	Status  string                       `json:"status"`
+	Checks  map[string]HealthCheckResult `json:"checks,omitempty"`
+} // @name HealthReport
+
+// AddReadinessCheck регистрирует проверку для /readyz.
+// Недоступность critical зависимости дает 503, остальных - статус degraded
+func (s *Server) AddReadinessCheck(name string, critical bool, check HealthCheckFunc) {
+	s.healthChecks = append(s.healthChecks, healthCheck{
+		name:     name,
+		critical: critical,
+		check:    check,
+	})
+}
+
+// MigrationsCheck проверяет, что схема не отстает от встроенных миграций и не грязная
+func MigrationsCheck(status func(ctx context.Context) (migrations.Status, error)) HealthCheckFunc {
+	return func(ctx context.Context) (any, error) {
+		st, err := status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return st, st.Check()
+	}
+}
+
+// WorkerCheck проверяет, что фоновый воркер запущен.
+// queueDepth необязателен и заполняет глубину очереди в ответе
+func WorkerCheck(status func() worker.Status, queueDepth func(ctx context.Context) (int, error)) HealthCheckFunc {
+	return func(ctx context.Context) (any, error) {
+		st := status()
+		if queueDepth != nil {
+			depth, err := queueDepth(ctx)
+			if err != nil {
+				return st, err
+			}
+			st.QueueDepth = depth
+		}
+		if !st.Running {
+			return st, errWorkerStopped
+		}
+		return st, nil
+	}
+}
+
+// Liveness
+// @Description Процесс жив и обслуживает http запросы. Зависимости не проверяются
+// @Tags Разное
+// @Produce json
+// @Success 200 {object} HealthReport
+// @Router /healthz [get]
+func (s *Server) livenessHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthReport{
+		Service: s.Config.ServiceName,
+		Status:  HealthStatusUp,
+	})
+}
+
+// Readiness
+// @Description Готовность принимать трафик: база данных, миграции, воркеры, очередь
+// @Description 503 если недоступна критичная зависимость, degraded если некритичная
+// @Tags Разное
+// @Produce json
+// @Success 200 {object} HealthReport "Сервис готов"
+// @Failure 503 {object} HealthReport "Критичная зависимость недоступна"
+// @Router /readyz [get]
+func (s *Server) readinessHandler(c echo.Context) error {
+	report := s.Readiness(c.Request().Context())
+	if report.Status == HealthStatusDown {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// Readiness выполняет все зарегистрированные проверки
+func (s *Server) Readiness(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Service: s.Config.ServiceName,
+		Status:  HealthStatusUp,
+		Checks:  make(map[string]HealthCheckResult, len(s.healthChecks)),
+	}
+	for _, hc := range s.healthChecks {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		details, err := hc.check(checkCtx)
+		cancel()
+
+		result := HealthCheckResult{
+			Status:  HealthStatusUp,
+			Details: details,
+		}
+		if err != nil {
+			result.Status = HealthStatusDown
+			result.Error = err.Error()
+			if hc.critical {
+				report.Status = HealthStatusDown
+			} else if report.Status == HealthStatusUp {
+				report.Status = HealthStatusDegraded
+			}
+		}
+		report.Checks[hc.name] = result
+	}
+	return report
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mi4r/gophermart/internal/worker"
+)
+
+func TestServer_Readiness(t *testing.T) {
+	errDown := errors.New("down")
+	ok := func(ctx context.Context) (any, error) { return nil, nil }
+	fail := func(ctx context.Context) (any, error) { return nil, errDown }
+
+	tests := []struct {
+		name       string
+		storage    HealthCheckFunc
+		accrual    HealthCheckFunc
+		wantStatus string
+		wantCode   int
+	}{
+		{name: "all_up", storage: ok, accrual: ok, wantStatus: HealthStatusUp, wantCode: http.StatusOK},
+		{name: "non_critical_down", storage: ok, accrual: fail, wantStatus: HealthStatusDegraded, wantCode: http.StatusOK},
+		{name: "critical_down", storage: fail, accrual: ok, wantStatus: HealthStatusDown, wantCode: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(Config{ServiceName: GophermartName})
+			s.AddReadinessCheck("storage", true, tt.storage)
+			s.AddReadinessCheck("accrual", false, tt.accrual)
+
+			report := s.Readiness(context.Background())
+			if report.Status != tt.wantStatus {
+				t.Errorf("Readiness() status = %s, want %s", report.Status, tt.wantStatus)
+			}
+
+			rec := httptest.NewRecorder()
+			c := s.Router.NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+			if err := s.readinessHandler(c); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("readinessHandler() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWorkerCheck(t *testing.T) {
+	errDepth := errors.New("depth")
+	tests := []struct {
+		name      string
+		running   bool
+		depth     func(ctx context.Context) (int, error)
+		wantErr   error
+		wantDepth int
+	}{
+		{name: "running", running: true, depth: func(ctx context.Context) (int, error) { return 3, nil }, wantDepth: 3},
+		{name: "stopped", running: false, wantErr: errWorkerStopped},
+		{name: "depth_error", running: true, depth: func(ctx context.Context) (int, error) { return 0, errDepth }, wantErr: errDepth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := WorkerCheck(func() worker.Status { return worker.Status{Running: tt.running} }, tt.depth)
+			details, err := check(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WorkerCheck() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := details.(worker.Status).QueueDepth; got != tt.wantDepth {
+				t.Errorf("QueueDepth = %d, want %d", got, tt.wantDepth)
+			}
+		})
+	}
+}
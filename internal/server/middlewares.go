@@ -2,14 +2,18 @@ package server
 
 import (
 	"compress/gzip"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"golang.org/x/time/rate"
+	"github.com/mi4r/gophermart/internal/metrics"
+	"github.com/mi4r/gophermart/lib/ratelimit"
 )
 
 const (
@@ -76,18 +80,65 @@ func GzipMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
-// RateLimiterMiddleware - middleware для ограничения скорости запросов
-func RateLimiterMiddleware(limiter *rate.Limiter) echo.MiddlewareFunc {
+// RateLimiterMiddleware - middleware для ограничения скорости запросов.
+// Лимит считается отдельно для каждого клиента (по IP),
+// в Retry-After отдается реальное время до появления токена.
+func RateLimiterMiddleware(limiter *ClientRateLimiter) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if !limiter.Allow() {
-				limit := limiter.Limit()
-				burst := limiter.Burst()
-				retryAfter := time.Duration(float64(burst) / float64(limit)).Seconds()
-				c.Response().Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter))
-				return c.String(http.StatusTooManyRequests, fmt.Sprintf("No more than %.0f requests per minute allowed", float64(limit)))
+			allowed, retryAfter := limiter.Reserve(c.RealIP(), time.Now())
+			if !allowed {
+				metrics.HTTPRateLimitedTotal.Inc()
+				c.Response().Header().Set("Retry-After", ratelimit.FormatRetryAfter(retryAfter))
+				return c.String(http.StatusTooManyRequests, fmt.Sprintf("No more than %g requests per second allowed", float64(limiter.Limit())))
 			}
 			return next(c)
 		}
 	}
 }
+
+// AdminTokenMiddleware пропускает только запросы с заголовком Authorization: Bearer <token>.
+// Служебные маршруты вызывают другие сервисы и администраторы, а не пользователи
+func AdminTokenMiddleware(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			got, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				return c.String(http.StatusUnauthorized, "admin token required")
+			}
+			return next(c)
+		}
+	}
+}
+
+// MetricsMiddleware считает запросы и их длительность по маршруту и статусу
+func MetricsMiddleware(service string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			code := c.Response().Status
+			if err != nil {
+				// Ответ еще не записан - статус определит обработчик ошибок echo
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					code = he.Code
+				} else {
+					code = http.StatusInternalServerError
+				}
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(code)
+			method := c.Request().Method
+			metrics.HTTPRequestsTotal.WithLabelValues(service, route, method, status).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(service, route, method, status).
+				Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
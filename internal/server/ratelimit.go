@@ -0,0 +1,98 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Через сколько неактивности лимитер клиента удаляется из памяти
+	clientLimiterTTL = 10 * time.Minute
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ClientRateLimiter хранит отдельный token bucket для каждого клиента
+type ClientRateLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+}
+
+// NewClientRateLimiter создает лимитер: limit запросов в секунду и burst на одного клиента
+func NewClientRateLimiter(limit rate.Limit, burst int) *ClientRateLimiter {
+	return &ClientRateLimiter{
+		limit:   limit,
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// Limit возвращает ограничение в запросах в секунду
+func (l *ClientRateLimiter) Limit() rate.Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetLimit меняет ограничение на лету, в том числе для уже известных клиентов
+func (l *ClientRateLimiter) SetLimit(limit rate.Limit, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.burst = burst
+	for _, c := range l.clients {
+		c.limiter.SetLimit(limit)
+		c.limiter.SetBurst(burst)
+	}
+}
+
+// Reserve пытается взять токен для клиента.
+// Если токена нет, возвращает false и время, через которое он появится.
+func (l *ClientRateLimiter) Reserve(client string, now time.Time) (bool, time.Duration) {
+	limiter := l.get(client, now)
+	r := limiter.ReserveN(now, 1)
+	if !r.OK() {
+		// Запрос больше burst - дождаться токена невозможно
+		return false, time.Duration(float64(time.Second) / float64(l.Limit()))
+	}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return true, 0
+	}
+	// Токен нам не положен прямо сейчас - возвращаем его обратно
+	r.CancelAt(now)
+	return false, delay
+}
+
+func (l *ClientRateLimiter) get(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanup(now)
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{
+			limiter: rate.NewLimiter(l.limit, l.burst),
+		}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// cleanup удаляет давно неактивных клиентов. Вызывается под мьютексом
+func (l *ClientRateLimiter) cleanup(now time.Time) {
+	for client, c := range l.clients {
+		if now.Sub(c.lastSeen) > clientLimiterTTL {
+			delete(l.clients, client)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientRateLimiter_SetLimit(t *testing.T) {
+	l := NewClientRateLimiter(1, 1)
+	now := time.Now()
+
+	if ok, _ := l.Reserve("client", now); !ok {
+		t.Fatal("first request must pass")
+	}
+	if ok, _ := l.Reserve("client", now); ok {
+		t.Fatal("second request must be limited")
+	}
+
+	// Новый лимит действует и для уже известного клиента
+	l.SetLimit(10, 5)
+	if got := l.Limit(); got != 10 {
+		t.Errorf("Limit() = %v, want 10", got)
+	}
+	later := now.Add(time.Second)
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.Reserve("client", later); !ok {
+			t.Fatalf("request %d must pass with new burst", i)
+		}
+	}
+}
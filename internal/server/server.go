@@ -2,12 +2,16 @@ package server
 
 import (
 	"context"
+	"errors"
 	"log/slog"
-	"os"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/mi4r/gophermart/lib/logger"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
 const (
@@ -15,17 +19,35 @@ const (
 	AccrualName    = "ACCRUAL"
 )
 
+// Коды завершения процесса
+const (
+	ExitCodeOK = 0
+	// Http сервер не смог запуститься или упал
+	ExitCodeServerError = 1
+	// Неверная конфигурация или флаги
+	ExitCodeConfigError = 2
+	// Не удалось подключиться к хранилищу
+	ExitCodeStorageError = 3
+	// Не уложились в таймаут корректного завершения
+	ExitCodeShutdownError = 4
+)
+
 type Config struct {
 	ServiceName string
 	Listen      string
 	SecretKey   string
-	MigrDirName string
 	RateLimit   int
+	RateBurst   int
+	// Секрет проверки подписи входящих вебхуков
+	WebhookSecret string
+	// Токен служебных маршрутов, пусто - маршруты отключены
+	AdminToken string
 }
 
 type Server struct {
-	Config Config
-	Router *echo.Echo
+	Config       Config
+	Router       *echo.Echo
+	healthChecks []healthCheck
 }
 
 func NewServer(Config Config) *Server {
@@ -35,18 +57,24 @@ func NewServer(Config Config) *Server {
 	}
 }
 
-func (s *Server) Start() {
+// Start запускает http сервер и блокируется до его остановки.
+// После штатного Shutdown возвращает nil
+func (s *Server) Start() error {
 	s.Configure()
-	if err := s.Router.Start(s.Config.Listen); err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
+	if err := s.Router.Start(s.Config.Listen); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
 
-func (s *Server) Shutdown() {
-	slog.Debug("http server stopped")
-	// ...
-	os.Exit(0)
+// Shutdown перестает принимать новые соединения и ждет завершения
+// текущих запросов, но не дольше чем позволяет ctx
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.Router.Shutdown(ctx); err != nil {
+		return err
+	}
+	slog.Debug("http server stopped", slog.String("service", s.Config.ServiceName))
+	return nil
 }
 
 func (s *Server) Configure() {
@@ -61,14 +89,56 @@ func (s *Server) Configure() {
 func (s *Server) setDefaultRoutes() {
 	// swagger
 	s.Router.GET("/swagger/*", echoSwagger.WrapHandler)
+	// health
+	s.Router.GET("/healthz", s.livenessHandler)
+	s.Router.GET("/readyz", s.readinessHandler)
+	// prometheus
+	s.Router.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 }
 
 func (s *Server) setMiddlewares() {
+	s.setRequestID()
+	s.setTracing()
 	s.setLogger()
+	s.Router.Use(MetricsMiddleware(s.Config.ServiceName))
 	// s.Router.Use(middleware.Logger())
 
 }
 
+// Модуль логов http запросов для уровней из -lm
+const logModule = "http"
+
+// setRequestID берет X-Request-ID из запроса или генерирует новый,
+// возвращает его в ответе и кладет в контекст для логов
+func (s *Server) setRequestID() {
+	s.Router.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			ctx := logger.WithRequestID(c.Request().Context(), id)
+			ctx = logger.WithModule(ctx, logModule)
+			c.SetRequest(c.Request().WithContext(ctx))
+		},
+	}))
+}
+
+// SetLogOrder добавляет номер заказа в контекст запроса для логов
+func SetLogOrder(c echo.Context, number string) {
+	ctx := logger.WithOrder(c.Request().Context(), number)
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+// setTracing создает спан на каждый запрос и продолжает трассировку из заголовка traceparent
+func (s *Server) setTracing() {
+	s.Router.Use(otelecho.Middleware(s.Config.ServiceName,
+		otelecho.WithSkipper(func(c echo.Context) bool {
+			switch c.Path() {
+			case "/metrics", "/healthz", "/readyz", "/swagger/*":
+				return true
+			}
+			return false
+		}),
+	))
+}
+
 func (s *Server) setLogger() {
 	s.Router.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogStatus:   true,
@@ -78,14 +148,14 @@ func (s *Server) setLogger() {
 		HandleError: true, // forwards error to the global error handler, so it can decide appropriate status code
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
 			if v.Error == nil {
-				slog.LogAttrs(context.Background(), slog.LevelInfo, "REQUEST",
+				slog.LogAttrs(c.Request().Context(), slog.LevelInfo, "REQUEST",
 					slog.String("service", s.Config.ServiceName),
 					slog.String("uri", v.URI),
 					slog.String("method", v.Method),
 					slog.Int("status", v.Status),
 				)
 			} else {
-				slog.LogAttrs(context.Background(), slog.LevelError, "REQUEST_ERROR",
+				slog.LogAttrs(c.Request().Context(), slog.LevelError, "REQUEST_ERROR",
 					slog.String("service", s.Config.ServiceName),
 					slog.String("uri", v.URI),
 					slog.String("method", v.Method),
@@ -1,5 +1,10 @@
 package storageaccrual
 
+import (
+	"net/url"
+	"time"
+)
+
 const (
 	RewardTypePt      RewardType = "pt"
 	RewardTypePercent RewardType = "%"
@@ -23,6 +28,33 @@ type Reward struct {
 	RewardType RewardType `json:"reward_type"`
 } // @name Reward
 
+// Webhook - подписка на события о завершении расчета заказов
+type Webhook struct {
+	ID     int64  `json:"id"`
+	URL    string `json:"url" example:"http://gophermart:8080/api/accrual/webhook"`
+	Secret string `json:"secret,omitempty"`
+} // @name Webhook
+
+// WebhookDelivery - одна попытка доставки события конкретному подписчику
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	URL       string
+	Secret    string
+	EventID   string
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+}
+
+func (w *Webhook) IsValid() bool {
+	u, err := url.ParseRequestURI(w.URL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && w.Secret != ""
+}
+
 func (r *Reward) IsEmptyMatch() bool {
 	return r.Match == ""
 }
@@ -1,10 +0,0 @@
-BEGIN;
-
-DROP TABLE orders;
-DROP TABLE users;
-DROP TABLE order_goods;
-DROP TABLE user_orders;
-DROP TABLE goods;
-DROP TABLE rewards;
-
-COMMIT;
@@ -1,6 +1,10 @@
 package storagedefault
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type OrderStatus string
 
@@ -12,14 +16,41 @@ const (
 	StatusProcessed  OrderStatus = "PROCESSED"
 )
 
+const (
+	EventOrderProcessed = "order.processed"
+	EventOrderInvalid   = "order.invalid"
+)
+
+// IsFinal - расчет по заказу завершен и статус больше не изменится
+func (s OrderStatus) IsFinal() bool {
+	return s == StatusProcessed || s == StatusInvalid
+}
+
 type Order struct {
 	Number  string      `json:"number" example:"12345678903"`
 	Status  OrderStatus `json:"status"`
 	Accrual float64     `json:"accrual,omitempty"`
 }
 
-type WithdrownOrder struct {
-	Order       string    `json:"order" example:"12345678903"`
-	Sum         float64   `json:"sum,omitempty"`
-	ProcessedAt time.Time `json:"processed_at,omitempty"`
+// WebhookEvent - событие, которое Accrual System отправляет подписчикам
+type WebhookEvent struct {
+	ID        string    `json:"id" example:"order-12345678903-processed"`
+	Type      string    `json:"type" example:"order.processed"`
+	CreatedAt time.Time `json:"created_at"`
+	Order     Order     `json:"order"`
+} // @name WebhookEvent
+
+// NewWebhookEvent создает событие о завершении расчета по заказу.
+// ID стабилен для пары заказ/статус, чтобы получатель мог отбрасывать повторы.
+func NewWebhookEvent(order Order) WebhookEvent {
+	eventType := EventOrderProcessed
+	if order.Status == StatusInvalid {
+		eventType = EventOrderInvalid
+	}
+	return WebhookEvent{
+		ID:        fmt.Sprintf("order-%s-%s", order.Number, strings.ToLower(string(order.Status))),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Order:     order,
+	}
 }
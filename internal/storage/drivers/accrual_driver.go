@@ -0,0 +1,229 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+)
+
+// pgxAccrualDriver - хранилище Accrual System в схеме accrual
+type pgxAccrualDriver struct {
+	*pgxDriver
+}
+
+func NewAccrualDriver(path string) *pgxAccrualDriver {
+	return &pgxAccrualDriver{
+		pgxDriver: newPgxDriver(path, migrations.Accrual),
+	}
+}
+
+func (d *pgxAccrualDriver) RewardCreate(ctx context.Context, r storageaccrual.Reward) error {
+	_, err := d.exec(ctx, `
+	INSERT INTO rewards (match, reward, reward_type)
+	VALUES ($1, $2, $3)
+	`, r.Match, r.Reward, r.RewardType,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *pgxAccrualDriver) RewardReadAll(ctx context.Context) ([]storageaccrual.Reward, error) {
+	var rewards []storageaccrual.Reward
+	rows, err := d.queryRows(ctx, "SELECT match, reward, reward_type FROM rewards")
+	if err != nil {
+		return rewards, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r storageaccrual.Reward
+		if err := rows.Scan(
+			&r.Match, &r.Reward, &r.RewardType,
+		); err != nil {
+			slog.Error("scan error", slog.String("err", err.Error()))
+			return rewards, err
+		}
+		rewards = append(rewards, r)
+	}
+	return rewards, nil
+}
+
+func (d *pgxAccrualDriver) OrderRegCreate(ctx context.Context, o storageaccrual.Order) error {
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	var orderID int64
+	defer tx.Rollback(ctx)
+	if err := tx.QueryRow(ctx, `
+	INSERT INTO orders (order_number, status) VALUES ($1, $2) RETURNING id`, o.Order, storagedefault.StatusRegistered).Scan(&orderID); err != nil {
+		return err
+	}
+	slog.Debug("order id is fetch", slog.Int64("id", orderID), slog.String("order", o.Order))
+
+	sqlScriptCreateGoods := `INSERT INTO goods (description, price) VALUES ($1, $2) RETURNING id`
+	sqlScriptGoodInOrder := `INSERT INTO order_goods (order_id, good_id) VALUES ($1, $2)`
+
+	for _, good := range o.Goods {
+		slog.Debug("add good of order",
+			slog.String("description", good.Description),
+			slog.Float64("price", good.Price),
+		)
+		var goodID int64
+		if err := tx.QueryRow(
+			ctx, sqlScriptCreateGoods, good.Description, good.Price).
+			Scan(&goodID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			ctx, sqlScriptGoodInOrder, orderID, goodID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (d *pgxAccrualDriver) OrderRegReadOne(ctx context.Context, number string) (storagedefault.Order, error) {
+	var o storagedefault.Order
+	if err := d.queryRow(ctx, `
+	SELECT order_number, status, accrual
+	FROM orders
+		WHERE order_number = $1
+		LIMIT 1
+	`, number).Scan(
+		&o.Number, &o.Status, &o.Accrual,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return o, errNotFoundOrder
+		}
+		return o, err
+	}
+	return o, nil
+}
+
+func (d *pgxAccrualDriver) OrderRegUpdateStatus(ctx context.Context, status storagedefault.OrderStatus, number string) error {
+	if _, err := d.exec(ctx, `
+	UPDATE orders SET status=$1 WHERE order_number=$2
+	`, status, number); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *pgxAccrualDriver) OrderRegUpdateOne(ctx context.Context, order storagedefault.Order) error {
+	if _, err := d.exec(ctx, `
+	UPDATE orders SET status=$1, accrual=$2 WHERE order_number=$3
+	`, order.Status, order.Accrual, order.Number); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *pgxAccrualDriver) WebhookCreate(ctx context.Context, w storageaccrual.Webhook) (int64, error) {
+	var id int64
+	// Повторная подписка того же адреса обновляет секрет
+	if err := d.queryRow(ctx, `
+	INSERT INTO webhooks (url, secret) VALUES ($1, $2)
+		ON CONFLICT (url) DO UPDATE SET secret = EXCLUDED.secret
+	RETURNING id`, w.URL, w.Secret).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (d *pgxAccrualDriver) WebhookDelete(ctx context.Context, id int64) error {
+	tag, err := d.exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (d *pgxAccrualDriver) WebhookEventCreate(ctx context.Context, event storagedefault.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = d.exec(ctx, `
+	INSERT INTO webhook_deliveries (webhook_id, event_id, payload)
+		SELECT id, $1, $2 FROM webhooks
+	ON CONFLICT (webhook_id, event_id) DO NOTHING`, event.ID, payload)
+	return err
+}
+
+func (d *pgxAccrualDriver) WebhookDeliveriesReadDue(ctx context.Context, limit int) ([]storageaccrual.WebhookDelivery, error) {
+	var deliveries []storageaccrual.WebhookDelivery
+	rows, err := d.queryRows(ctx, `
+	SELECT wd.id, wd.webhook_id, w.url, w.secret, wd.event_id, wd.payload, wd.attempts, wd.created_at
+	FROM webhook_deliveries wd
+		JOIN webhooks w ON w.id = wd.webhook_id
+		WHERE wd.next_attempt_at <= NOW()
+		ORDER BY wd.next_attempt_at ASC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wd storageaccrual.WebhookDelivery
+		if err := rows.Scan(
+			&wd.ID, &wd.WebhookID, &wd.URL, &wd.Secret,
+			&wd.EventID, &wd.Payload, &wd.Attempts, &wd.CreatedAt,
+		); err != nil {
+			slog.Error("scan error", slog.String("err", err.Error()))
+			return deliveries, err
+		}
+		deliveries = append(deliveries, wd)
+	}
+	return deliveries, rows.Err()
+}
+
+func (d *pgxAccrualDriver) WebhookDeliveryDone(ctx context.Context, id int64) error {
+	_, err := d.exec(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, id)
+	return err
+}
+
+func (d *pgxAccrualDriver) WebhookDeliveryRetry(ctx context.Context, id int64, nextAttemptAt time.Time, lastErr string) error {
+	_, err := d.exec(ctx, `
+	UPDATE webhook_deliveries
+		SET attempts = attempts + 1, next_attempt_at = $1, last_error = $2
+		WHERE id = $3`, nextAttemptAt, lastErr, id)
+	return err
+}
+
+func (d *pgxAccrualDriver) WebhookDeliveryDeadLetter(ctx context.Context, id int64, lastErr string) error {
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+	INSERT INTO webhook_dead_letters (webhook_id, url, event_id, payload, attempts, last_error, created_at)
+		SELECT wd.webhook_id, w.url, wd.event_id, wd.payload, wd.attempts + 1, $1, wd.created_at
+		FROM webhook_deliveries wd
+			JOIN webhooks w ON w.id = wd.webhook_id
+			WHERE wd.id = $2`, lastErr, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
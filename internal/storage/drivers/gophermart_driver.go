@@ -0,0 +1,373 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mi4r/gophermart/internal/metrics"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
+)
+
+// pgxGophermartDriver - хранилище Gophermart в схеме gophermart
+type pgxGophermartDriver struct {
+	*pgxDriver
+	// Срок жизни начисленных баллов, 0 - не сгорают
+	pointsTTL time.Duration
+	// Уровни программы лояльности для надбавки к начислению
+	tiers storagemart.Tiers
+	// Бонусы за приглашения
+	referrals storagemart.ReferralProgram
+}
+
+func NewGophermartDriver(path string) *pgxGophermartDriver {
+	return &pgxGophermartDriver{
+		pgxDriver: newPgxDriver(path, migrations.Gophermart),
+	}
+}
+
+// UserCreate заводит пользователя. Код приглашения, если не задан, генерируется
+func (d *pgxGophermartDriver) UserCreate(ctx context.Context, user storagemart.User) error {
+	if user.ReferralCode == "" {
+		code, err := storagemart.NewReferralCode()
+		if err != nil {
+			return err
+		}
+		user.ReferralCode = code
+	}
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+	INSERT INTO users (login, password, referral_code, referred_by)
+	VALUES ($1, $2, $3, NULLIF($4, ''))
+	`, user.Login, user.Password, user.ReferralCode, user.ReferredBy,
+	)
+	if err != nil {
+		return err
+	}
+	if err := addOutboxEvent(ctx, tx, storagemart.OutboxUserRegistered, storagemart.OutboxUser{Login: user.Login}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *pgxGophermartDriver) UserReadOne(ctx context.Context, login string) (storagemart.User, error) {
+	var user storagemart.User
+	if err := d.queryRow(ctx, `
+		SELECT login, password, current, reserved, withdrawn, tier, tier_score, locked, referral_code, COALESCE(referred_by, '')
+		FROM users WHERE login=$1
+	`, login).Scan(&user.Login, &user.Password, &user.Current, &user.Reserved, &user.Withdrawn, &user.Tier, &user.TierScore,
+		&user.Locked, &user.ReferralCode, &user.ReferredBy); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+func (d *pgxGophermartDriver) UserOrderCreate(ctx context.Context, login, number string) error {
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+	INSERT INTO user_orders (number, user_login)
+	VALUES ($1, $2)
+	`, number, login,
+	)
+	if err != nil {
+		return err
+	}
+	if err := addOutboxEvent(ctx, tx, storagemart.OutboxOrderUploaded, storagemart.OutboxOrder{Login: login, Number: number}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (d *pgxGophermartDriver) UserOrderReadOne(ctx context.Context, number string) (storagemart.Order, error) {
+	var o storagemart.Order
+	if err := d.queryRow(ctx, `
+	SELECT number, status, accrual, bonus, uploaded_at, user_login
+	FROM user_orders
+		WHERE number = $1
+		LIMIT 1
+	`, number).Scan(
+		&o.Number, &o.Status, &o.Accrual, &o.Bonus,
+		&o.UploadedAt, &o.UserLogin,
+	); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+func (d *pgxGophermartDriver) UserOrdersReadByLogin(ctx context.Context, login string) ([]storagemart.Order, error) {
+	return d.UserOrdersList(ctx, login, storagemart.ListQuery{})
+}
+
+// UserOrdersList возвращает страницу заказов пользователя по параметрам q
+func (d *pgxGophermartDriver) UserOrdersList(ctx context.Context, login string, q storagemart.ListQuery) ([]storagemart.Order, error) {
+	var orders []storagemart.Order
+	clause, args := listClause(q, "uploaded_at", []any{login})
+	rows, err := d.queryRows(ctx, `
+	SELECT number, status, accrual, bonus, uploaded_at, user_login
+	FROM user_orders
+		WHERE user_login = $1`+clause, args...)
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o storagemart.Order
+		if err := rows.Scan(
+			&o.Number, &o.Status, &o.Accrual, &o.Bonus,
+			&o.UploadedAt, &o.UserLogin,
+		); err != nil {
+			slog.Error("scan error", slog.String("err", err.Error()))
+			return []storagemart.Order{}, err
+		}
+		orders = append(orders, o)
+	}
+
+	return orders, rows.Err()
+}
+
+func (d *pgxGophermartDriver) UserOrderReadAllNumbers(ctx context.Context) ([]string, error) {
+	var orders []string
+	rows, err := d.queryRows(ctx, `
+	SELECT number FROM user_orders
+		WHERE status != 'INVALID' AND status != 'PROCESSED'`)
+	if err != nil {
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o string
+		if err := rows.Scan(
+			&o,
+		); err != nil {
+			slog.Error("scan error", slog.String("err", err.Error()))
+			return []string{}, err
+		}
+		orders = append(orders, o)
+	}
+
+	return orders, nil
+}
+
+func (d *pgxGophermartDriver) UserOrderCountPending(ctx context.Context) (int, error) {
+	var count int
+	if err := d.queryRow(ctx, `
+	SELECT COUNT(*) FROM user_orders
+		WHERE status != 'INVALID' AND status != 'PROCESSED'`).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Payload события order.status, общий для всех мест, где меняется статус заказа
+const orderStatusPayload = `json_build_object('number', number, 'status', status, 'accrual', accrual)`
+
+// UserOrderUpdateStatus меняет статус заказа и пишет событие order.status, если статус стал другим
+func (d *pgxGophermartDriver) UserOrderUpdateStatus(ctx context.Context, number string, status storagedefault.OrderStatus) error {
+	if _, err := d.exec(ctx, `
+	WITH o AS (
+		UPDATE user_orders SET status = $1
+			WHERE number = $2 AND status IS DISTINCT FROM $1
+		RETURNING number, status, accrual, user_login
+	)
+	INSERT INTO user_events (user_login, type, payload)
+	SELECT user_login, $3, `+orderStatusPayload+`
+	FROM o`, status, number, storagemart.EventOrderStatus); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *pgxGophermartDriver) UserOrderUpdateAll(ctx context.Context, orders []storagedefault.Order) error {
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var accrued float64
+	// Итоги приглашений для метрик
+	var referrals []string
+	for _, o := range orders {
+		var userLogin string
+		// Заказ в финальном статусе уже начислен - повторно не трогаем.
+		// Это защищает от двойного начисления при повторной доставке вебхука.
+		// Заказ, статус которого не изменился, тоже не трогаем, чтобы не плодить события
+		if err := tx.QueryRow(ctx, `
+		WITH o AS (
+			UPDATE user_orders SET status = $1, accrual = $2,
+				processed_at = CASE WHEN $1 IN ('INVALID', 'PROCESSED') THEN NOW() ELSE processed_at END
+				WHERE number = $3 AND status NOT IN ('INVALID', 'PROCESSED') AND status IS DISTINCT FROM $1
+			RETURNING number, status, accrual, user_login
+		), e AS (
+			INSERT INTO user_events (user_login, type, payload)
+			SELECT user_login, $4, `+orderStatusPayload+`
+			FROM o
+		)
+		SELECT user_login FROM o`, o.Status, o.Accrual, o.Number, storagemart.EventOrderStatus).Scan(&userLogin); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.Debug("order status unchanged, already finalized or not found", slog.String("number", o.Number))
+				continue
+			}
+			return err
+		}
+		if o.Status == storagedefault.StatusProcessed {
+			status, issued, err := d.rewardReferral(ctx, tx, userLogin, o.Number, o.Accrual)
+			if err != nil {
+				return err
+			}
+			// Бонусы за приглашение - тоже выпущенные баллы
+			accrued += issued
+			if status != "" {
+				referrals = append(referrals, status)
+			}
+		}
+		if o.Accrual == 0 {
+			continue
+		}
+		// Надбавка считается по уровню на момент начисления
+		var tier storagemart.Tier
+		if err := tx.QueryRow(ctx, `SELECT tier FROM users WHERE login = $1 FOR UPDATE`, userLogin).Scan(&tier); err != nil {
+			return err
+		}
+		bonus := d.tiers.Bonus(tier, o.Accrual)
+		if bonus != 0 {
+			if _, err := tx.Exec(ctx, `UPDATE user_orders SET bonus = $1 WHERE number = $2`, bonus, o.Number); err != nil {
+				return err
+			}
+		}
+		credited := o.Accrual + bonus
+		if _, err = tx.Exec(ctx, `UPDATE users SET current = current + $1 WHERE login = $2;`, credited, userLogin); err != nil {
+			return err
+		}
+		if err := d.addLot(ctx, tx, userLogin, o.Number, storagemart.LedgerAccrued, o.Number, credited); err != nil {
+			return err
+		}
+		if err := addBalanceEvent(ctx, tx, userLogin); err != nil {
+			return err
+		}
+		if err := addOutboxEvent(ctx, tx, storagemart.OutboxPointsAccrued, storagemart.OutboxOrder{
+			Login: userLogin, Number: o.Number, Accrual: credited, Bonus: bonus,
+		}); err != nil {
+			return err
+		}
+		accrued += credited
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	metrics.PointsAccruedTotal.Add(accrued)
+	for _, status := range referrals {
+		metrics.ReferralRewardsTotal.WithLabelValues(status).Inc()
+	}
+	return nil
+}
+
+// WithdrawBalance сразу списывает sum в счет заказа order. Перед списанием его проверяет check,
+// пометки сохраняются вместе со списанием
+func (d *pgxGophermartDriver) WithdrawBalance(
+	ctx context.Context,
+	login, order string,
+	sum, curBalance float64,
+	check storagemart.SpendingCheck,
+) error {
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	flags, err := checkSpending(ctx, tx, login, withdrawalStats, check)
+	if err != nil {
+		return err
+	}
+
+	// Баланс мог уменьшиться после проверки в хендлере, поэтому проверяем еще раз под блокировкой строки
+	queryUpdate := `UPDATE users SET current = current - $1, withdrawn = withdrawn + $1 WHERE login = $2 AND current >= $1;`
+	tag, err := tx.Exec(ctx, queryUpdate, sum, login)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storagemart.ErrInsufficientFunds
+	}
+	if err := consumeLots(ctx, tx, login, order, sum); err != nil {
+		return err
+	}
+
+	if _, err := addWithdrawal(ctx, tx, login, order, sum, storagemart.WithdrawalProcessed, 0); err != nil {
+		return err
+	}
+	if err := addWithdrawalFlags(ctx, tx, login, order, sum, flags); err != nil {
+		return err
+	}
+	if err := addBalanceEvent(ctx, tx, login); err != nil {
+		return err
+	}
+	if err := addOutboxEvent(ctx, tx, storagemart.OutboxPointsWithdrawn, storagemart.OutboxWithdrawal{
+		Login: login, Order: order, Sum: sum,
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	metrics.PointsWithdrawnTotal.Add(sum)
+	return nil
+}
+
+func (d *pgxGophermartDriver) GetUserWithdrawals(ctx context.Context, login string) ([]storagemart.Withdrawal, error) {
+	return d.UserWithdrawalsList(ctx, login, storagemart.ListQuery{})
+}
+
+// UserWithdrawalsList возвращает страницу истории списаний пользователя по параметрам q.
+// Исходящие и входящие переводы идут в ней же со статусом PROCESSED и номером T<id>
+func (d *pgxGophermartDriver) UserWithdrawalsList(ctx context.Context, login string, q storagemart.ListQuery) ([]storagemart.Withdrawal, error) {
+	clause, args := listClause(q, "processed_at", []any{login})
+	rows, err := d.queryRows(ctx, `SELECT type, number, sum, status, processed_at, expires_at, counterparty, user_login
+		FROM (
+			SELECT 'WITHDRAWAL' AS type, number, sum, status::text AS status, processed_at, expires_at,
+				'' AS counterparty, user_login
+			FROM withdrawals
+				WHERE user_login = $1
+			UNION ALL
+			SELECT
+				CASE WHEN sender_login = $1 THEN 'TRANSFER_OUT' ELSE 'TRANSFER_IN' END,
+				'T' || id, sum, 'PROCESSED', created_at, NULL,
+				CASE WHEN sender_login = $1 THEN recipient_login ELSE sender_login END, $1
+			FROM transfers
+				WHERE sender_login = $1 OR recipient_login = $1
+		) history
+		WHERE TRUE`+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var withdrawals []storagemart.Withdrawal
+	for rows.Next() {
+		var w storagemart.Withdrawal
+		if err := rows.Scan(&w.Type, &w.Order, &w.Sum, &w.Status, &w.ProcessedAt, &w.ExpiresAt, &w.Counterparty, &w.UserLogin); err != nil {
+			return nil, err
+		}
+
+		withdrawals = append(withdrawals, w)
+	}
+	return withdrawals, rows.Err()
+}
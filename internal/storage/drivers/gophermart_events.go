@@ -0,0 +1,96 @@
+package drivers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// Канал NOTIFY, в который триггер user_events пишет логин пользователя
+const eventsChannel = "user_events"
+
+// addBalanceEvent записывает баланс пользователя, каким он стал в транзакции tx
+func addBalanceEvent(ctx context.Context, tx pgx.Tx, login string) error {
+	_, err := tx.Exec(ctx, `
+	INSERT INTO user_events (user_login, type, payload)
+	SELECT login, $2, json_build_object('current', current, 'reserved', reserved, 'withdrawn', withdrawn)
+	FROM users
+		WHERE login = $1`, login, storagemart.EventBalance)
+	return err
+}
+
+// UserEventsList возвращает до limit событий пользователя с id больше afterID по возрастанию id
+func (d *pgxGophermartDriver) UserEventsList(ctx context.Context, login string, afterID int64, limit int) ([]storagemart.Event, error) {
+	rows, err := d.queryRows(ctx, `
+	SELECT id, type, payload, created_at
+	FROM user_events
+		WHERE user_login = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`, login, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []storagemart.Event
+	for rows.Next() {
+		var e storagemart.Event
+		if err := rows.Scan(&e.ID, &e.Type, &e.Data, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// UserEventLastID возвращает id последнего события пользователя, 0 - событий нет
+func (d *pgxGophermartDriver) UserEventLastID(ctx context.Context, login string) (int64, error) {
+	var id int64
+	if err := d.queryRow(ctx, `
+	SELECT COALESCE(MAX(id), 0) FROM user_events
+		WHERE user_login = $1`, login).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UserEventsDeleteOlder удаляет события старше age. Продолжить поток с них уже нельзя
+func (d *pgxGophermartDriver) UserEventsDeleteOlder(ctx context.Context, age time.Duration) (int64, error) {
+	tag, err := d.exec(ctx, `
+	DELETE FROM user_events
+		WHERE created_at < NOW() - $1 * INTERVAL '1 second'`, age.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// UserEventsListen держит отдельное соединение с LISTEN user_events и вызывает notify
+// с логином пользователя на каждое новое событие. Сразу после подписки notify вызывается
+// с пустым логином: уведомления, пришедшие до нее, потеряны и проверить нужно всех.
+// Блокируется до отмены ctx или обрыва соединения
+func (d *pgxGophermartDriver) UserEventsListen(ctx context.Context, notify func(login string)) error {
+	conn, err := d.connPool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// Соединение с подпиской не возвращаем в пул: закрытое пул просто выбросит
+	defer func() {
+		conn.Conn().Close(context.Background())
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel); err != nil {
+		return err
+	}
+	notify("")
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		notify(n.Payload)
+	}
+}
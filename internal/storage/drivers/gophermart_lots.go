@@ -0,0 +1,179 @@
+package drivers
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// SetPointsTTL задает срок жизни новых начислений, 0 - баллы не сгорают.
+// Уже начисленные партии сохраняют свой срок
+func (d *pgxGophermartDriver) SetPointsTTL(ttl time.Duration) {
+	d.pointsTTL = ttl
+}
+
+// addLot заводит партию баллов в транзакции tx и пишет ее движение typ с reference.
+// number - заказ, по которому начислены баллы, пустой - партия не из своего заказа
+func (d *pgxGophermartDriver) addLot(ctx context.Context, tx pgx.Tx, login, number, typ, reference string, amount float64) error {
+	_, err := tx.Exec(ctx, `
+	WITH lot AS (
+		INSERT INTO accrual_lots (user_login, order_number, amount, remaining, expires_at)
+		VALUES ($1, NULLIF($2, ''), $3, $3, CASE WHEN $4::float8 > 0 THEN NOW() + $4::float8 * INTERVAL '1 second' END)
+		RETURNING id, amount
+	)
+	INSERT INTO points_ledger (user_login, lot_id, type, amount, reference)
+	SELECT $1, id, $5, amount, $6 FROM lot`,
+		login, number, amount, d.pointsTTL.Seconds(), typ, reference)
+	return err
+}
+
+// consumeLots списывает sum с партий пользователя в транзакции tx: сначала те, что сгорают раньше,
+// партии без срока - последними. Партии из переводов новее, но сохраняют срок отправителя,
+// поэтому порядок по id не годится. Строка пользователя к этому моменту уже заблокирована изменением баланса
+func consumeLots(ctx context.Context, tx pgx.Tx, login, reference string, sum float64) error {
+	_, err := tx.Exec(ctx, `
+	WITH lots AS (
+		SELECT id, LEAST(remaining, GREATEST($2::numeric - (SUM(remaining) OVER (ORDER BY expires_at NULLS LAST, id) - remaining), 0)) AS take
+		FROM accrual_lots
+			WHERE user_login = $1 AND remaining > 0
+	), spent AS (
+		UPDATE accrual_lots l SET remaining = l.remaining - lots.take
+			FROM lots WHERE l.id = lots.id AND lots.take > 0
+		RETURNING l.id, lots.take
+	)
+	INSERT INTO points_ledger (user_login, lot_id, type, amount, reference)
+	SELECT $1, id, $4, -take, $3 FROM spent`,
+		login, sum, reference, storagemart.LedgerSpent)
+	return err
+}
+
+// restoreLots возвращает sum, списанные по reference, в те же партии в транзакции tx.
+// Если партии сгорели, баллы сгорят со следующим проходом воркера.
+// То, что списано до появления партий, возвращается новой партией без срока
+func restoreLots(ctx context.Context, tx pgx.Tx, login, reference string, sum float64) error {
+	_, err := tx.Exec(ctx, `
+	WITH spent AS (
+		SELECT lot_id, -SUM(amount) AS amount
+		FROM points_ledger
+			WHERE user_login = $1 AND reference = $2 AND type IN ($4, $5)
+			GROUP BY lot_id
+			HAVING SUM(amount) < 0
+	), returned AS (
+		UPDATE accrual_lots l SET remaining = l.remaining + spent.amount
+			FROM spent WHERE l.id = spent.lot_id
+		RETURNING l.id, spent.amount
+	), returned_ledger AS (
+		INSERT INTO points_ledger (user_login, lot_id, type, amount, reference)
+		SELECT $1, id, $5, amount, $2 FROM returned
+	), rest AS (
+		INSERT INTO accrual_lots (user_login, amount, remaining)
+		SELECT $1, r.amount, r.amount
+		FROM (SELECT $3::numeric - COALESCE(SUM(amount), 0) AS amount FROM returned) r
+			WHERE r.amount > 0
+		RETURNING id, amount
+	)
+	INSERT INTO points_ledger (user_login, lot_id, type, amount, reference)
+	SELECT $1, id, $5, amount, $2 FROM rest`,
+		login, reference, sum, storagemart.LedgerSpent, storagemart.LedgerReturned)
+	return err
+}
+
+// PointsExpire сжигает остатки партий с истекшим сроком: списывает их с баланса,
+// пишет движения EXPIRED и события. Обрабатывает не больше limit партий за вызов,
+// возвращает число сгоревших партий
+func (d *pgxGophermartDriver) PointsExpire(ctx context.Context, limit int) (int, error) {
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Пользователей блокируем раньше партий, в том же порядке, что и списания
+	var logins []string
+	rows, err := tx.Query(ctx, `
+	SELECT login FROM users
+		WHERE login IN (
+			SELECT user_login FROM accrual_lots
+				WHERE remaining > 0 AND expires_at <= NOW()
+				ORDER BY expires_at NULLS LAST, id
+				LIMIT $1
+		)
+		ORDER BY login
+		FOR UPDATE`, limit)
+	if err != nil {
+		return 0, err
+	}
+	logins, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+	if len(logins) == 0 {
+		return 0, nil
+	}
+
+	var count int
+	var expired []storagemart.OutboxPoints
+	rows, err = tx.Query(ctx, `
+	WITH due AS (
+		SELECT id, user_login, remaining FROM accrual_lots
+			WHERE user_login = ANY($1) AND remaining > 0 AND expires_at <= NOW()
+			FOR UPDATE
+	), burned AS (
+		UPDATE accrual_lots l SET remaining = 0
+			FROM due WHERE l.id = due.id
+		RETURNING l.id, l.user_login, due.remaining AS amount
+	), ledger AS (
+		INSERT INTO points_ledger (user_login, lot_id, type, amount)
+		SELECT user_login, id, $2, -amount FROM burned
+	), totals AS (
+		SELECT user_login, SUM(amount) AS amount, COUNT(*) AS lots FROM burned GROUP BY user_login
+	)
+	UPDATE users u SET current = u.current - t.amount
+		FROM totals t WHERE u.login = t.user_login
+	RETURNING u.login, t.amount, t.lots`, logins, storagemart.LedgerExpired)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var e storagemart.OutboxPoints
+		var lots int
+		if err := rows.Scan(&e.Login, &e.Sum, &lots); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, e)
+		count += lots
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range expired {
+		if err := addBalanceEvent(ctx, tx, e.Login); err != nil {
+			return 0, err
+		}
+		if err := addOutboxEvent(ctx, tx, storagemart.OutboxPointsExpired, e); err != nil {
+			return 0, err
+		}
+	}
+	return count, tx.Commit(ctx)
+}
+
+// UserPointsExpiring возвращает, сколько баллов пользователя сгорит в течение within,
+// и срок ближайшей из этих партий. nil - в этот период ничего не сгорает
+func (d *pgxGophermartDriver) UserPointsExpiring(ctx context.Context, login string, within time.Duration) (float64, *time.Time, error) {
+	var sum float64
+	var at *time.Time
+	if err := d.queryRow(ctx, `
+	SELECT COALESCE(SUM(remaining), 0), MIN(expires_at)
+	FROM accrual_lots
+		WHERE user_login = $1 AND remaining > 0
+			AND expires_at <= NOW() + $2::float8 * INTERVAL '1 second'`,
+		login, within.Seconds()).Scan(&sum, &at); err != nil {
+		return 0, nil, err
+	}
+	return sum, at, nil
+}
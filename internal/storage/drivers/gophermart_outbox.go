@@ -0,0 +1,72 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// addOutboxEvent записывает доменное событие в outbox в транзакции tx.
+// ID события назначается здесь и не меняется при повторных доставках
+func addOutboxEvent(ctx context.Context, tx pgx.Tx, typ string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO outbox (event_id, type, payload)
+	VALUES ($1, $2, $3)`, uuid.NewString(), typ, payload)
+	return err
+}
+
+// OutboxReadPending возвращает до limit неотправленных событий в порядке записи
+func (d *pgxGophermartDriver) OutboxReadPending(ctx context.Context, limit int) ([]storagemart.OutboxEvent, error) {
+	rows, err := d.queryRows(ctx, `
+	SELECT id, event_id::text, type, payload, created_at, attempts
+	FROM outbox
+		ORDER BY id
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []storagemart.OutboxEvent
+	for rows.Next() {
+		var e storagemart.OutboxEvent
+		if err := rows.Scan(&e.Seq, &e.ID, &e.Type, &e.Data, &e.OccurredAt, &e.Attempts); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// OutboxDone удаляет опубликованное событие
+func (d *pgxGophermartDriver) OutboxDone(ctx context.Context, seq int64) error {
+	_, err := d.exec(ctx, `DELETE FROM outbox WHERE id = $1`, seq)
+	return err
+}
+
+// OutboxDeleteOlder удаляет события старше age, не дождавшиеся доставки
+func (d *pgxGophermartDriver) OutboxDeleteOlder(ctx context.Context, age time.Duration) (int64, error) {
+	tag, err := d.exec(ctx, `
+	DELETE FROM outbox
+		WHERE created_at < NOW() - $1 * INTERVAL '1 second'`, age.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// OutboxFailed запоминает неудачную попытку доставки
+func (d *pgxGophermartDriver) OutboxFailed(ctx context.Context, seq int64, lastErr string) error {
+	_, err := d.exec(ctx, `
+	UPDATE outbox SET attempts = attempts + 1, last_error = $1
+		WHERE id = $2`, lastErr, seq)
+	return err
+}
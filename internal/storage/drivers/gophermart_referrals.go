@@ -0,0 +1,150 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// SetReferralProgram задает бонусы за приглашения
+func (d *pgxGophermartDriver) SetReferralProgram(p storagemart.ReferralProgram) {
+	d.referrals = p
+}
+
+// UserLoginByReferralCode возвращает логин владельца кода приглашения
+func (d *pgxGophermartDriver) UserLoginByReferralCode(ctx context.Context, code string) (string, error) {
+	var login string
+	err := d.queryRow(ctx, `SELECT login FROM users WHERE referral_code = $1`, code).Scan(&login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", storagemart.ErrUnknownReferralCode
+	}
+	return login, err
+}
+
+// rewardReferral подводит итог приглашения, когда первый заказ приглашенного login
+// перешел в PROCESSED в транзакции tx. Строка в referral_rewards на приглашенного одна,
+// поэтому бонус начисляется ровно один раз, даже при повторной доставке начисления.
+// Возвращает статус итога или пустую строку, если подводить нечего, и сколько бонусов начислено обоим
+func (d *pgxGophermartDriver) rewardReferral(ctx context.Context, tx pgx.Tx, login, number string, accrual float64) (string, float64, error) {
+	if !d.referrals.Enabled() {
+		return "", 0, nil
+	}
+	var referrer string
+	err := tx.QueryRow(ctx, `
+	SELECT u.referred_by FROM users u
+		WHERE u.login = $1 AND u.referred_by IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM user_orders o
+					WHERE o.user_login = u.login AND o.status = 'PROCESSED' AND o.number != $2
+			)
+			AND NOT EXISTS (SELECT 1 FROM referral_rewards r WHERE r.referred_login = u.login)`,
+		login, number).Scan(&referrer)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Обоих блокируем по порядку логинов, как при переводе
+	rows, err := tx.Query(ctx, `
+	SELECT locked FROM users
+		WHERE login = ANY($1)
+		ORDER BY login
+		FOR UPDATE`, []string{login, referrer})
+	if err != nil {
+		return "", 0, err
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		return "", 0, err
+	}
+	var anyLocked bool
+	for _, l := range locked {
+		anyLocked = anyLocked || l
+	}
+	var rewarded int
+	if d.referrals.MaxRewards > 0 {
+		if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM referral_rewards WHERE referrer_login = $1 AND status = $2`,
+			referrer, storagemart.ReferralRewarded).Scan(&rewarded); err != nil {
+			return "", 0, err
+		}
+	}
+
+	status, reason := storagemart.ReferralRewarded, ""
+	switch {
+	case accrual < d.referrals.MinAccrual:
+		reason = storagemart.ReferralReasonMinAccrual
+	case anyLocked:
+		reason = storagemart.ReferralReasonLocked
+	case d.referrals.MaxRewards > 0 && rewarded >= d.referrals.MaxRewards:
+		reason = storagemart.ReferralReasonCap
+	}
+	referrerBonus, referredBonus := d.referrals.ReferrerBonus, d.referrals.ReferredBonus
+	if reason != "" {
+		status, referrerBonus, referredBonus = storagemart.ReferralRejected, 0, 0
+	}
+
+	tag, err := tx.Exec(ctx, `
+	INSERT INTO referral_rewards (referred_login, referrer_login, order_number, status, reason, referrer_bonus, referred_bonus)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+		ON CONFLICT (referred_login) DO NOTHING`,
+		login, referrer, number, status, reason, referrerBonus, referredBonus)
+	if err != nil {
+		return "", 0, err
+	}
+	if tag.RowsAffected() == 0 || status == storagemart.ReferralRejected {
+		return status, 0, nil
+	}
+
+	// Заказ принадлежит только приглашенному, у партии пригласившего его нет
+	reference := storagemart.ReferralReference(login)
+	for _, b := range []struct {
+		login  string
+		number string
+		bonus  float64
+	}{{referrer, "", referrerBonus}, {login, number, referredBonus}} {
+		if b.bonus <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET current = current + $1 WHERE login = $2`, b.bonus, b.login); err != nil {
+			return "", 0, err
+		}
+		if err := d.addLot(ctx, tx, b.login, b.number, storagemart.LedgerReferral, reference, b.bonus); err != nil {
+			return "", 0, err
+		}
+		if err := addBalanceEvent(ctx, tx, b.login); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := addOutboxEvent(ctx, tx, storagemart.OutboxReferralRewarded, storagemart.OutboxReferral{
+		Referrer: referrer, Referred: login, Order: number,
+		ReferrerBonus: referrerBonus, ReferredBonus: referredBonus,
+	}); err != nil {
+		return "", 0, err
+	}
+	return status, referrerBonus + referredBonus, nil
+}
+
+// UserReferralStats возвращает код приглашения пользователя и итоги его приглашений
+func (d *pgxGophermartDriver) UserReferralStats(ctx context.Context, login string) (storagemart.ReferralStats, error) {
+	var stats storagemart.ReferralStats
+	err := d.queryRow(ctx, `
+	SELECT
+		u.referral_code,
+		(SELECT COUNT(*) FROM users r WHERE r.referred_by = u.login),
+		COUNT(rr.referred_login) FILTER (WHERE rr.status = $2),
+		COUNT(rr.referred_login) FILTER (WHERE rr.status = $3),
+		COALESCE(SUM(rr.referrer_bonus), 0)
+	FROM users u
+		LEFT JOIN referral_rewards rr ON rr.referrer_login = u.login
+		WHERE u.login = $1
+		GROUP BY u.login, u.referral_code`,
+		login, storagemart.ReferralRewarded, storagemart.ReferralRejected,
+	).Scan(&stats.Code, &stats.Invited, &stats.Rewarded, &stats.Rejected, &stats.Earned)
+	stats.Pending = stats.Invited - stats.Rewarded - stats.Rejected
+	return stats, err
+}
@@ -0,0 +1,87 @@
+package drivers
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// UserWithdrawalStats возвращает суммы списаний пользователя за текущие сутки и месяц,
+// их число за последний час и время последней смены пароля. Удержанные резервы
+// учитываются наравне с подтвержденными, отмененные и возвращенные - нет
+func (d *pgxGophermartDriver) UserWithdrawalStats(ctx context.Context, login string) (storagemart.SpendingStats, error) {
+	return withdrawalStats(ctx, d.connPool, login)
+}
+
+// rowQuerier - пул соединений или транзакция
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func withdrawalStats(ctx context.Context, q rowQuerier, login string) (storagemart.SpendingStats, error) {
+	var stats storagemart.SpendingStats
+	err := q.QueryRow(ctx, `
+	SELECT
+		COALESCE(SUM(w.sum) FILTER (WHERE w.processed_at >= date_trunc('day', NOW())), 0),
+		COALESCE(SUM(w.sum) FILTER (WHERE w.processed_at >= date_trunc('month', NOW())), 0),
+		COUNT(w.number) FILTER (WHERE w.processed_at >= NOW() - INTERVAL '1 hour'),
+		u.password_changed_at
+	FROM users u
+		LEFT JOIN withdrawals w ON w.user_login = u.login
+			AND w.status IN ($2, $3)
+			AND w.processed_at >= LEAST(date_trunc('month', NOW()), NOW() - INTERVAL '1 hour')
+		WHERE u.login = $1
+		GROUP BY u.login, u.password_changed_at`,
+		login, storagemart.WithdrawalPending, storagemart.WithdrawalProcessed,
+	).Scan(&stats.Day, &stats.Month, &stats.LastHour, &stats.PasswordChangedAt)
+	return stats, err
+}
+
+// UserUpdatePassword меняет хеш пароля и запоминает время смены
+func (d *pgxGophermartDriver) UserUpdatePassword(ctx context.Context, login, hash string) error {
+	_, err := d.exec(ctx, `
+	UPDATE users SET password = $1, password_changed_at = NOW() WHERE login = $2`, hash, login)
+	return err
+}
+
+// checkSpending блокирует строку пользователя до конца транзакции tx и прогоняет трату через check
+// по статистике stats, прочитанной уже под блокировкой. Параллельные траты пользователя ждут
+// друг друга и видят друг друга в статистике, поэтому лимиты не обойти одновременными запросами
+func checkSpending(
+	ctx context.Context,
+	tx pgx.Tx,
+	login string,
+	stats func(ctx context.Context, q rowQuerier, login string) (storagemart.SpendingStats, error),
+	check storagemart.SpendingCheck,
+) ([]storagemart.WithdrawalFlag, error) {
+	if check == nil {
+		return nil, nil
+	}
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE login = $1 FOR UPDATE`, login); err != nil {
+		return nil, err
+	}
+	st, err := stats(ctx, tx, login)
+	if err != nil {
+		return nil, err
+	}
+	return check(st)
+}
+
+// addWithdrawalFlags помечает списание для проверки администратором
+// и пишет событие withdrawal.flagged в транзакции списания tx
+func addWithdrawalFlags(ctx context.Context, tx pgx.Tx, login, order string, sum float64, flags []storagemart.WithdrawalFlag) error {
+	if len(flags) == 0 {
+		return nil
+	}
+	for _, f := range flags {
+		if _, err := tx.Exec(ctx, `
+		INSERT INTO withdrawal_flags (withdrawal_number, user_login, rule, reason)
+			VALUES ($1, $2, $3, $4)`, order, login, f.Rule, f.Reason); err != nil {
+			return err
+		}
+	}
+	return addOutboxEvent(ctx, tx, storagemart.OutboxWithdrawalFlagged, storagemart.OutboxWithdrawalFlag{
+		Login: login, Order: order, Sum: sum, Flags: flags,
+	})
+}
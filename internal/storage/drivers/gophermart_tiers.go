@@ -0,0 +1,90 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// Суммы пользователей за период для пересчета уровня. $1 - длина периода в секундах
+var tierScoreSQL = map[string]string{
+	storagemart.TierBasisAccrued: `
+		SELECT user_login, SUM(accrual + bonus) AS score FROM user_orders
+			WHERE status = 'PROCESSED' AND processed_at >= NOW() - $1::float8 * INTERVAL '1 second'
+			GROUP BY user_login`,
+	storagemart.TierBasisSpent: `
+		SELECT user_login, SUM(sum) AS score FROM withdrawals
+			WHERE status = 'PROCESSED' AND processed_at >= NOW() - $1::float8 * INTERVAL '1 second'
+			GROUP BY user_login`,
+}
+
+// SetTiers задает уровни, по которым начисляется надбавка
+func (d *pgxGophermartDriver) SetTiers(tiers storagemart.Tiers) {
+	d.tiers = tiers
+}
+
+// TiersRecalculate пересчитывает уровни всех пользователей по сумме basis за последние window.
+// О каждом изменении уровня пишет событие tier.changed, возвращает число таких пользователей
+func (d *pgxGophermartDriver) TiersRecalculate(ctx context.Context, basis string, window time.Duration) (int, error) {
+	scoreSQL, ok := tierScoreSQL[basis]
+	if !ok {
+		return 0, fmt.Errorf("unknown tier basis %q", basis)
+	}
+	names := make([]string, len(d.tiers))
+	thresholds := make([]float64, len(d.tiers))
+	for i, l := range d.tiers {
+		names[i], thresholds[i] = string(l.Tier), l.Threshold
+	}
+
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	WITH scores AS (
+		SELECT u.login, u.tier AS old_tier, COALESCE(a.score, 0) AS score
+		FROM users u
+			LEFT JOIN (`+scoreSQL+`) a ON a.user_login = u.login
+	), levels AS (
+		SELECT s.login, s.old_tier, s.score, COALESCE((
+			SELECT t.name FROM unnest($2::text[], $3::numeric[]) AS t(name, threshold)
+				WHERE s.score >= t.threshold
+				ORDER BY t.threshold DESC
+				LIMIT 1
+		), $2[1]) AS tier
+		FROM scores s
+	)
+	UPDATE users u SET tier = l.tier, tier_score = l.score
+		FROM levels l
+		WHERE u.login = l.login AND (u.tier != l.tier OR u.tier_score != l.score)
+	RETURNING u.login, l.old_tier, l.tier`, window.Seconds(), names, thresholds)
+	if err != nil {
+		return 0, err
+	}
+	var changed []storagemart.OutboxTier
+	for rows.Next() {
+		var e storagemart.OutboxTier
+		if err := rows.Scan(&e.Login, &e.From, &e.To); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if e.From != e.To {
+			changed = append(changed, e)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range changed {
+		if err := addOutboxEvent(ctx, tx, storagemart.OutboxTierChanged, e); err != nil {
+			return 0, err
+		}
+	}
+	return len(changed), tx.Commit(ctx)
+}
@@ -0,0 +1,160 @@
+package drivers
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mi4r/gophermart/internal/metrics"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// Transfer переводит sum с баланса from на баланс to в одной транзакции.
+// Строки обоих пользователей блокируются по порядку логинов, чтобы встречные переводы
+// не взаимоблокировались. Под блокировкой перевод проверяет check
+func (d *pgxGophermartDriver) Transfer(ctx context.Context, from, to string, sum float64, check storagemart.SpendingCheck) (storagemart.Transfer, error) {
+	t := storagemart.Transfer{From: from, To: to, Sum: sum}
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return t, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT login, current, locked FROM users
+		WHERE login = ANY($1)
+		ORDER BY login
+		FOR UPDATE`, []string{from, to})
+	if err != nil {
+		return t, err
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowToStructByPos[struct {
+		Login   string
+		Current float64
+		Locked  bool
+	}])
+	if err != nil {
+		return t, err
+	}
+	var senderFound, recipientFound bool
+	for _, u := range locked {
+		switch u.Login {
+		case from:
+			senderFound = true
+			if u.Locked {
+				return t, storagemart.ErrUserLocked
+			}
+			if u.Current < sum {
+				return t, storagemart.ErrInsufficientFunds
+			}
+		case to:
+			recipientFound = true
+			if u.Locked {
+				return t, storagemart.ErrRecipientLocked
+			}
+		}
+	}
+	if !senderFound {
+		return t, pgx.ErrNoRows
+	}
+	if !recipientFound {
+		return t, storagemart.ErrRecipientNotFound
+	}
+	if check != nil {
+		stats, err := transferStats(ctx, tx, from)
+		if err != nil {
+			return t, err
+		}
+		// Правила переводов ничего не помечают, пометки не сохраняются
+		if _, err := check(stats); err != nil {
+			return t, err
+		}
+	}
+
+	if err := tx.QueryRow(ctx, `
+	INSERT INTO transfers (sender_login, recipient_login, sum)
+		VALUES ($1, $2, $3)
+	RETURNING id, created_at`, from, to, sum,
+	).Scan(&t.ID, &t.CreatedAt); err != nil {
+		return t, err
+	}
+	if _, err := tx.Exec(ctx, `
+	UPDATE users SET current = current - $1 WHERE login = $2`, sum, from); err != nil {
+		return t, err
+	}
+	if _, err := tx.Exec(ctx, `
+	UPDATE users SET current = current + $1 WHERE login = $2`, sum, to); err != nil {
+		return t, err
+	}
+	reference := t.HistoryNumber()
+	if err := consumeLots(ctx, tx, from, reference, sum); err != nil {
+		return t, err
+	}
+	if err := moveLots(ctx, tx, from, to, reference, sum); err != nil {
+		return t, err
+	}
+	for _, login := range []string{from, to} {
+		if err := addBalanceEvent(ctx, tx, login); err != nil {
+			return t, err
+		}
+	}
+	if err := addOutboxEvent(ctx, tx, storagemart.OutboxPointsTransferred, storagemart.OutboxTransfer{
+		ID: t.ID, From: from, To: to, Sum: sum,
+	}); err != nil {
+		return t, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return t, err
+	}
+	metrics.PointsTransferredTotal.Add(sum)
+	return t, nil
+}
+
+// moveLots заводит получателю партии с теми же сроками, из которых consumeLots
+// забрал баллы отправителя по reference, чтобы перевод не продлевал жизнь баллов.
+// То, что списано не из партий, приходит партией без срока
+func moveLots(ctx context.Context, tx pgx.Tx, from, to, reference string, sum float64) error {
+	_, err := tx.Exec(ctx, `
+	WITH moved AS (
+		SELECT -p.amount AS amount, l.expires_at
+		FROM points_ledger p
+			JOIN accrual_lots l ON l.id = p.lot_id
+			WHERE p.user_login = $1 AND p.reference = $3 AND p.type = $5
+	), src AS (
+		SELECT amount, expires_at FROM moved
+		UNION ALL
+		SELECT $4::numeric - COALESCE((SELECT SUM(amount) FROM moved), 0), NULL::timestamp
+	), lots AS (
+		INSERT INTO accrual_lots (user_login, amount, remaining, expires_at)
+		SELECT $2, amount, amount, expires_at FROM src
+			WHERE amount > 0
+		RETURNING id, amount
+	)
+	INSERT INTO points_ledger (user_login, lot_id, type, amount, reference)
+	SELECT $2, id, $6, amount, $3 FROM lots`,
+		from, to, reference, sum, storagemart.LedgerSpent, storagemart.LedgerReceived)
+	return err
+}
+
+// UserTransferStats возвращает суммы исходящих переводов пользователя за текущие сутки и месяц,
+// их число за последний час и время последней смены пароля
+func (d *pgxGophermartDriver) UserTransferStats(ctx context.Context, login string) (storagemart.SpendingStats, error) {
+	return transferStats(ctx, d.connPool, login)
+}
+
+func transferStats(ctx context.Context, q rowQuerier, login string) (storagemart.SpendingStats, error) {
+	var stats storagemart.SpendingStats
+	err := q.QueryRow(ctx, `
+	SELECT
+		COALESCE(SUM(t.sum) FILTER (WHERE t.created_at >= date_trunc('day', NOW())), 0),
+		COALESCE(SUM(t.sum) FILTER (WHERE t.created_at >= date_trunc('month', NOW())), 0),
+		COUNT(t.id) FILTER (WHERE t.created_at >= NOW() - INTERVAL '1 hour'),
+		u.password_changed_at
+	FROM users u
+		LEFT JOIN transfers t ON t.sender_login = u.login
+			AND t.created_at >= LEAST(date_trunc('month', NOW()), NOW() - INTERVAL '1 hour')
+		WHERE u.login = $1
+		GROUP BY u.login, u.password_changed_at`, login,
+	).Scan(&stats.Day, &stats.Month, &stats.LastHour, &stats.PasswordChangedAt)
+	return stats, err
+}
@@ -0,0 +1,228 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mi4r/gophermart/internal/metrics"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// WithdrawalReserve удерживает sum с доступного баланса под списание в статусе PENDING.
+// Резерв действует ttl, потом его снимает WithdrawalsExpire. Перед резервом его проверяет check,
+// пометки сохраняются вместе с резервом
+func (d *pgxGophermartDriver) WithdrawalReserve(
+	ctx context.Context,
+	login, order string,
+	sum float64,
+	ttl time.Duration,
+	check storagemart.SpendingCheck,
+) (storagemart.Withdrawal, error) {
+	var w storagemart.Withdrawal
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return w, err
+	}
+	defer tx.Rollback(ctx)
+
+	flags, err := checkSpending(ctx, tx, login, withdrawalStats, check)
+	if err != nil {
+		return w, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+	UPDATE users SET current = current - $1, reserved = reserved + $1
+		WHERE login = $2 AND current >= $1`, sum, login)
+	if err != nil {
+		return w, err
+	}
+	if tag.RowsAffected() == 0 {
+		return w, storagemart.ErrInsufficientFunds
+	}
+	if err := consumeLots(ctx, tx, login, order, sum); err != nil {
+		return w, err
+	}
+
+	if w, err = addWithdrawal(ctx, tx, login, order, sum, storagemart.WithdrawalPending, ttl); err != nil {
+		return w, err
+	}
+	if err := addWithdrawalFlags(ctx, tx, login, order, sum, flags); err != nil {
+		return w, err
+	}
+	if err := addBalanceEvent(ctx, tx, login); err != nil {
+		return w, err
+	}
+
+	return w, tx.Commit(ctx)
+}
+
+// addWithdrawal записывает списание в статусе status в транзакции tx. При ненулевом ttl
+// списание живет ttl. Номер снятого резерва (CANCELLED, EXPIRED) того же пользователя используется повторно,
+// иначе вставляется новая строка - на занятом номере она упадет с нарушением уникальности
+func addWithdrawal(
+	ctx context.Context,
+	tx pgx.Tx,
+	login, order string,
+	sum float64,
+	status storagemart.WithdrawalStatus,
+	ttl time.Duration,
+) (storagemart.Withdrawal, error) {
+	var w storagemart.Withdrawal
+	// NULL дает бессрочное списание: NOW() + NULL = NULL
+	var ttlSeconds *float64
+	if ttl != 0 {
+		seconds := ttl.Seconds()
+		ttlSeconds = &seconds
+	}
+	err := tx.QueryRow(ctx, `
+	UPDATE withdrawals
+		SET sum = $3, status = $4, processed_at = CURRENT_TIMESTAMP,
+			expires_at = NOW() + $5::float8 * INTERVAL '1 second'
+		WHERE number = $1 AND user_login = $2 AND status IN ($6, $7)
+	RETURNING number, sum, status, processed_at, expires_at, user_login`,
+		order, login, sum, status, ttlSeconds, storagemart.WithdrawalCancelled, storagemart.WithdrawalExpired,
+	).Scan(&w.Order, &w.Sum, &w.Status, &w.ProcessedAt, &w.ExpiresAt, &w.UserLogin)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return w, err
+	}
+	err = tx.QueryRow(ctx, `
+	INSERT INTO withdrawals (number, user_login, sum, status, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + $5::float8 * INTERVAL '1 second')
+	RETURNING number, sum, status, processed_at, expires_at, user_login`,
+		order, login, sum, status, ttlSeconds,
+	).Scan(&w.Order, &w.Sum, &w.Status, &w.ProcessedAt, &w.ExpiresAt, &w.UserLogin)
+	return w, err
+}
+
+// WithdrawalConfirm списывает удержанные баллы: PENDING -> PROCESSED
+func (d *pgxGophermartDriver) WithdrawalConfirm(ctx context.Context, login, order string) (storagemart.Withdrawal, error) {
+	w, err := d.withdrawalTransition(ctx, login, order,
+		storagemart.WithdrawalPending, storagemart.WithdrawalProcessed, storagemart.OutboxPointsWithdrawn, `
+	UPDATE users SET reserved = reserved - $1, withdrawn = withdrawn + $1 WHERE login = $2`)
+	if err != nil {
+		return w, err
+	}
+	metrics.PointsWithdrawnTotal.Add(w.Sum)
+	return w, nil
+}
+
+// releaseReservedSQL возвращает удержанные баллы на доступный баланс
+const releaseReservedSQL = `
+	UPDATE users SET reserved = reserved - $1, current = current + $1 WHERE login = $2`
+
+// WithdrawalCancel возвращает удержанные баллы на доступный баланс: PENDING -> CANCELLED
+func (d *pgxGophermartDriver) WithdrawalCancel(ctx context.Context, login, order string) (storagemart.Withdrawal, error) {
+	return d.withdrawalTransition(ctx, login, order,
+		storagemart.WithdrawalPending, storagemart.WithdrawalCancelled, "", releaseReservedSQL)
+}
+
+// WithdrawalRefund возвращает списанные баллы при возврате заказа: PROCESSED -> REFUNDED
+func (d *pgxGophermartDriver) WithdrawalRefund(ctx context.Context, login, order string) (storagemart.Withdrawal, error) {
+	w, err := d.withdrawalTransition(ctx, login, order,
+		storagemart.WithdrawalProcessed, storagemart.WithdrawalRefunded, storagemart.OutboxPointsRefunded, `
+	UPDATE users SET withdrawn = withdrawn - $1, current = current + $1 WHERE login = $2`)
+	if err != nil {
+		return w, err
+	}
+	metrics.PointsRefundedTotal.Add(w.Sum)
+	return w, nil
+}
+
+// withdrawalTransition переводит списание пользователя из статуса from в to
+// и правит баланс запросом balanceSQL с параметрами (sum, login) в одной транзакции.
+// Если outboxType не пуст, туда же пишется доменное событие
+func (d *pgxGophermartDriver) withdrawalTransition(
+	ctx context.Context,
+	login, order string,
+	from, to storagemart.WithdrawalStatus,
+	outboxType string,
+	balanceSQL string,
+) (storagemart.Withdrawal, error) {
+	var w storagemart.Withdrawal
+	tx, err := d.connPool.Begin(ctx)
+	if err != nil {
+		return w, err
+	}
+	defer tx.Rollback(ctx)
+
+	var expired bool
+	err = tx.QueryRow(ctx, `
+	SELECT number, sum, status, processed_at, expires_at, user_login, COALESCE(expires_at <= NOW(), false)
+	FROM withdrawals
+		WHERE number = $1 AND user_login = $2
+		FOR UPDATE`, order, login,
+	).Scan(&w.Order, &w.Sum, &w.Status, &w.ProcessedAt, &w.ExpiresAt, &w.UserLogin, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return w, storagemart.ErrWithdrawalNotFound
+	}
+	if err != nil {
+		return w, err
+	}
+	// Просроченный резерв уже не подтвердить, даже если воркер его еще не снял
+	if w.Status != from || (to == storagemart.WithdrawalProcessed && expired) {
+		return w, storagemart.ErrWithdrawalStatusChange
+	}
+
+	if _, err := tx.Exec(ctx, `
+	UPDATE withdrawals SET status = $1, expires_at = NULL
+		WHERE number = $2`, to, order); err != nil {
+		return w, err
+	}
+	if _, err := tx.Exec(ctx, balanceSQL, w.Sum, login); err != nil {
+		return w, err
+	}
+	// Кроме подтверждения, все переходы возвращают баллы на доступный баланс - и в их партии
+	if to != storagemart.WithdrawalProcessed {
+		if err := restoreLots(ctx, tx, login, order, w.Sum); err != nil {
+			return w, err
+		}
+	}
+	if err := addBalanceEvent(ctx, tx, login); err != nil {
+		return w, err
+	}
+	if outboxType != "" {
+		if err := addOutboxEvent(ctx, tx, outboxType, storagemart.OutboxWithdrawal{
+			Login: login, Order: order, Sum: w.Sum,
+		}); err != nil {
+			return w, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return w, err
+	}
+	w.Status, w.ExpiresAt = to, nil
+	return w, nil
+}
+
+// WithdrawalsExpire снимает просроченные резервы и возвращает баллы на доступный баланс.
+// Каждый резерв снимается своей транзакцией, как при отмене. Возвращает число снятых резервов
+func (d *pgxGophermartDriver) WithdrawalsExpire(ctx context.Context) (int, error) {
+	rows, err := d.queryRows(ctx, `
+	SELECT number, user_login FROM withdrawals
+		WHERE status = $1 AND expires_at <= NOW()
+		ORDER BY expires_at`, storagemart.WithdrawalPending)
+	if err != nil {
+		return 0, err
+	}
+	due, err := pgx.CollectRows(rows, pgx.RowToStructByPos[struct{ Order, Login string }])
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, w := range due {
+		_, err := d.withdrawalTransition(ctx, w.Login, w.Order,
+			storagemart.WithdrawalPending, storagemart.WithdrawalExpired, "", releaseReservedSQL)
+		// Резерв успели подтвердить или отменить - уже не наш
+		if errors.Is(err, storagemart.ErrWithdrawalStatusChange) {
+			continue
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,49 @@
+package drivers
+
+import (
+	"fmt"
+	"strings"
+
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// listClause дописывает к запросу условия, сортировку и лимит из q.
+// timeCol - колонка времени, по которой идут страницы; вторым ключом служит number.
+// args - уже занятые параметры запроса, новые добавляются после них.
+// Колонки времени - TIMESTAMP в часовом поясе сессии, поэтому границы from/to
+// передаются как timestamptz и переводятся в этот пояс
+func listClause(q storagemart.ListQuery, timeCol string, args []any) (string, []any) {
+	var sb strings.Builder
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(q.Statuses) != 0 {
+		fmt.Fprintf(&sb, " AND status::text = ANY(%s)", arg(q.Statuses))
+	}
+	if !q.From.IsZero() {
+		fmt.Fprintf(&sb, " AND %s >= %s", timeCol, sessionTime(arg(q.From)))
+	}
+	if !q.To.IsZero() {
+		fmt.Fprintf(&sb, " AND %s < %s", timeCol, sessionTime(arg(q.To)))
+	}
+
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After != nil {
+		fmt.Fprintf(&sb, " AND (%s, number) %s (%s, %s)", timeCol, cmp, arg(q.After.Time), arg(q.After.Number))
+	}
+	fmt.Fprintf(&sb, " ORDER BY %s %s, number %s", timeCol, dir, dir)
+	if q.Limit > 0 {
+		fmt.Fprintf(&sb, " LIMIT %s", arg(q.Limit))
+	}
+	return sb.String(), args
+}
+
+// sessionTime переводит параметр-момент времени в TIMESTAMP часового пояса сессии
+func sessionTime(param string) string {
+	return fmt.Sprintf("(%s::timestamptz AT TIME ZONE current_setting('TimeZone'))", param)
+}
@@ -2,20 +2,21 @@ package drivers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
 	"time"
 
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgconn"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
 	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
 	"github.com/mi4r/gophermart/lib/logger"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
 )
 
-var storage *pgxDriver
+var storage *pgxGophermartDriver
 
 func TestMain(m *testing.M) {
 
@@ -58,19 +59,22 @@ func TestMain(m *testing.M) {
 
 	pool.MaxWait = 120 * time.Second
 	if err = pool.Retry(func() error {
-		storage = NewPgxDriver(databaseURL)
+		storage = NewGophermartDriver(databaseURL)
 		storage.isTest = true
 		ctx := context.Background()
 		if err := storage.Open(ctx); err != nil {
 			return err
 		}
-		return storage.Ping()
+		return storage.Ping(ctx)
 	}); err != nil {
 		pool.Purge(resource)
 		log.Fatalf("Could not connect to docker: %s", err)
 	}
 
-	storage.Migrate("default")
+	if err := storage.Migrate(context.Background()); err != nil {
+		pool.Purge(resource)
+		log.Fatalf("Could not migrate: %s", err)
+	}
 
 	defer func() {
 		if err := pool.Purge(resource); err != nil {
@@ -85,7 +89,7 @@ func TestMain(m *testing.M) {
 
 func TestDatabaseConnection(t *testing.T) {
 	// Пример теста: проверка соединения с базой данных
-	err := storage.Ping()
+	err := storage.Ping(context.Background())
 	if err != nil {
 		t.Fatalf("Could not ping database: %s", err)
 	}
@@ -311,3 +315,517 @@ func TestOrderReadAllByUser(t *testing.T) {
 		})
 	}
 }
+
+func TestWithdrawBalance(t *testing.T) {
+	ctx := context.Background()
+	if err := storage.WithdrawBalance(ctx, "admin", "2377225624", 0, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Номер списания не занимает номер заказа
+	if err := storage.UserOrderCreate(ctx, "admin", "2377225624"); err != nil {
+		t.Errorf("order with withdrawal number not created: %s", err)
+	}
+	if err := storage.WithdrawBalance(ctx, "admin", "2377225624", 0, 0, nil); err == nil {
+		t.Error("want error on second withdrawal for the same order")
+	}
+
+	withdrawals, err := storage.GetUserWithdrawals(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(withdrawals) != 1 || withdrawals[0].Order != "2377225624" || withdrawals[0].Status != storagemart.WithdrawalProcessed {
+		t.Errorf("unexpected withdrawals %+v", withdrawals)
+	}
+}
+
+func TestWithdrawalReservation(t *testing.T) {
+	ctx := context.Background()
+	w, err := storage.WithdrawalReserve(ctx, "admin", "4561261212345467", 0, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Status != storagemart.WithdrawalPending || w.ExpiresAt == nil {
+		t.Errorf("unexpected reservation %+v", w)
+	}
+	if _, err := storage.WithdrawalRefund(ctx, "admin", w.Order); !errors.Is(err, storagemart.ErrWithdrawalStatusChange) {
+		t.Errorf("refund of pending: want ErrWithdrawalStatusChange, got %v", err)
+	}
+	if w, err = storage.WithdrawalConfirm(ctx, "admin", w.Order); err != nil || w.Status != storagemart.WithdrawalProcessed {
+		t.Fatalf("confirm: %+v, %v", w, err)
+	}
+	if w, err = storage.WithdrawalRefund(ctx, "admin", w.Order); err != nil || w.Status != storagemart.WithdrawalRefunded {
+		t.Fatalf("refund: %+v, %v", w, err)
+	}
+	if _, err := storage.WithdrawalCancel(ctx, "user1", w.Order); !errors.Is(err, storagemart.ErrWithdrawalNotFound) {
+		t.Errorf("cancel of another user: want ErrWithdrawalNotFound, got %v", err)
+	}
+
+	// Резерв с истекшим сроком нельзя подтвердить, его снимает WithdrawalsExpire
+	w, err = storage.WithdrawalReserve(ctx, "admin", "79927398713", 0, -time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.WithdrawalConfirm(ctx, "admin", w.Order); !errors.Is(err, storagemart.ErrWithdrawalStatusChange) {
+		t.Errorf("confirm of expired: want ErrWithdrawalStatusChange, got %v", err)
+	}
+	if count, err := storage.WithdrawalsExpire(ctx); err != nil || count != 1 {
+		t.Errorf("WithdrawalsExpire() = %d, %v, want 1", count, err)
+	}
+
+	// Номер снятого резерва можно зарезервировать снова, а активного - нет
+	if w, err = storage.WithdrawalReserve(ctx, "admin", "79927398713", 0, time.Minute, nil); err != nil || w.Status != storagemart.WithdrawalPending {
+		t.Fatalf("reserve after expire: %+v, %v", w, err)
+	}
+	var pgErr *pgconn.PgError
+	if _, err := storage.WithdrawalReserve(ctx, "admin", "79927398713", 0, time.Minute, nil); !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		t.Errorf("reserve of pending: want unique violation, got %v", err)
+	}
+	if _, err := storage.WithdrawalReserve(ctx, "user1", "4561261212345467", 0, time.Minute, nil); !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		t.Errorf("reserve of another user's refunded: want unique violation, got %v", err)
+	}
+	if _, err := storage.WithdrawalCancel(ctx, "admin", "79927398713"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserEvents(t *testing.T) {
+	ctx := context.Background()
+	user := storagemart.User{Creds: storagemart.Creds{Login: "events", Password: "events"}}
+	if err := storage.UserCreate(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	start, err := storage.UserEventLastID(ctx, user.Login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UserOrderCreate(ctx, user.Login, "920001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UserOrderUpdateAll(ctx, []storagedefault.Order{{Number: "920001", Status: storagedefault.StatusProcessed, Accrual: 50}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.WithdrawBalance(ctx, user.Login, "920002", 30, 50, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := storage.UserEventsList(ctx, user.Login, start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []storagemart.EventType{storagemart.EventOrderStatus, storagemart.EventBalance, storagemart.EventBalance}
+	if len(events) != len(want) {
+		t.Fatalf("events = %+v, want %v", events, want)
+	}
+	for i, e := range events {
+		if e.Type != want[i] {
+			t.Errorf("event %d type = %q, want %q", e.ID, e.Type, want[i])
+		}
+		if e.ID <= start || i > 0 && e.ID <= events[i-1].ID {
+			t.Errorf("event ids are not increasing: %d", e.ID)
+		}
+	}
+
+	last := events[len(events)-1].ID
+	if id, err := storage.UserEventLastID(ctx, user.Login); err != nil || id != last {
+		t.Errorf("UserEventLastID() = %d, %v, want %d", id, err, last)
+	}
+	if rest, err := storage.UserEventsList(ctx, user.Login, last, 100); err != nil || len(rest) != 0 {
+		t.Errorf("events after last = %v, %v, want none", rest, err)
+	}
+	if count, err := storage.UserEventsDeleteOlder(ctx, time.Hour); err != nil || count != 0 {
+		t.Errorf("UserEventsDeleteOlder() = %d, %v, want 0", count, err)
+	}
+}
+
+func TestUserOrderUpdateAllUnchanged(t *testing.T) {
+	ctx := context.Background()
+	user := storagemart.User{Creds: storagemart.Creds{Login: "pending", Password: "pending"}}
+	if err := storage.UserCreate(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UserOrderCreate(ctx, user.Login, "920003"); err != nil {
+		t.Fatal(err)
+	}
+	start, err := storage.UserEventLastID(ctx, user.Login)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Воркер на каждом тике передает заказы, которые еще считаются
+	processing := []storagedefault.Order{{Number: "920003", Status: storagedefault.StatusProcessing}}
+	for i := 0; i < 2; i++ {
+		if err := storage.UserOrderUpdateAll(ctx, processing); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := storage.UserEventsList(ctx, user.Login, start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != storagemart.EventOrderStatus {
+		t.Errorf("events = %+v, want one %s", events, storagemart.EventOrderStatus)
+	}
+	var status storagedefault.OrderStatus
+	var processedAt *time.Time
+	if err := storage.connPool.QueryRow(ctx, `
+	SELECT status, processed_at FROM user_orders WHERE number = $1`, "920003").Scan(&status, &processedAt); err != nil {
+		t.Fatal(err)
+	}
+	if status != storagedefault.StatusProcessing || processedAt != nil {
+		t.Errorf("order = %s, %v, want PROCESSING without processed_at", status, processedAt)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	// Регистрации, загрузки заказов и списания из предыдущих тестов записаны в outbox
+	events, err := storage.OutboxReadPending(ctx, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make(map[string]bool)
+	for i, e := range events {
+		types[e.Type] = true
+		if e.ID == "" {
+			t.Errorf("event %d has no id", e.Seq)
+		}
+		if i > 0 && e.Seq <= events[i-1].Seq {
+			t.Errorf("events are not ordered: %d after %d", e.Seq, events[i-1].Seq)
+		}
+	}
+	for _, typ := range []string{storagemart.OutboxUserRegistered, storagemart.OutboxOrderUploaded, storagemart.OutboxPointsWithdrawn} {
+		if !types[typ] {
+			t.Errorf("no %s events in outbox", typ)
+		}
+	}
+
+	first := events[0]
+	if err := storage.OutboxFailed(ctx, first.Seq, "receiver is down"); err != nil {
+		t.Fatal(err)
+	}
+	retry, err := storage.OutboxReadPending(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Повторная доставка идет с тем же id
+	if len(retry) != 1 || retry[0].ID != first.ID || retry[0].Attempts != first.Attempts+1 {
+		t.Errorf("retry = %+v, want %s with one more attempt", retry, first.ID)
+	}
+	if err := storage.OutboxDone(ctx, first.Seq); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := storage.OutboxReadPending(ctx, 1000)
+	if err != nil || len(rest) != len(events)-1 {
+		t.Errorf("pending after done = %d, %v, want %d", len(rest), err, len(events)-1)
+	}
+	// Свежие события не удаляются
+	if count, err := storage.OutboxDeleteOlder(ctx, time.Hour); err != nil || count != 0 {
+		t.Errorf("OutboxDeleteOlder() = %d, %v, want 0", count, err)
+	}
+}
+
+func TestPointsExpiry(t *testing.T) {
+	ctx := context.Background()
+	defer storage.SetPointsTTL(0)
+	user := storagemart.User{Creds: storagemart.Creds{Login: "expiry", Password: "expiry"}}
+	if err := storage.UserCreate(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range []string{"900001", "900002"} {
+		if err := storage.UserOrderCreate(ctx, user.Login, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Старая партия живет час, новая сгорает сразу
+	storage.SetPointsTTL(time.Hour)
+	if err := storage.UserOrderUpdateAll(ctx, []storagedefault.Order{{Number: "900001", Status: storagedefault.StatusProcessed, Accrual: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	storage.SetPointsTTL(time.Millisecond)
+	if err := storage.UserOrderUpdateAll(ctx, []storagedefault.Order{{Number: "900002", Status: storagedefault.StatusProcessed, Accrual: 50}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Списание берет баллы из партии, которая сгорает раньше, хоть она и новее.
+	// Ее остаток сгорает, старая партия остается целиком
+	if err := storage.WithdrawBalance(ctx, user.Login, "900003", 30, 150, nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if count, err := storage.PointsExpire(ctx, 100); err != nil || count != 1 {
+		t.Fatalf("PointsExpire() = %d, %v, want 1", count, err)
+	}
+	got, err := storage.UserReadOne(ctx, user.Login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Current != 100 {
+		t.Errorf("current after expiry = %v, want 100", got.Current)
+	}
+	sum, at, err := storage.UserPointsExpiring(ctx, user.Login, 2*time.Hour)
+	if err != nil || sum != 100 || at == nil {
+		t.Errorf("UserPointsExpiring() = %v, %v, %v, want 100 within an hour", sum, at, err)
+	}
+	if sum, at, err := storage.UserPointsExpiring(ctx, user.Login, time.Minute); err != nil || sum != 0 || at != nil {
+		t.Errorf("UserPointsExpiring(minute) = %v, %v, %v, want nothing", sum, at, err)
+	}
+
+	// Возврат кладет баллы обратно в сгоревшую партию, и они сгорают со следующим проходом
+	if _, err := storage.WithdrawalRefund(ctx, user.Login, "900003"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := storage.PointsExpire(ctx, 100); err != nil || count != 1 {
+		t.Fatalf("PointsExpire() after refund = %d, %v, want 1", count, err)
+	}
+	if got, err := storage.UserReadOne(ctx, user.Login); err != nil || got.Current != 100 {
+		t.Errorf("current after refund = %v, %v, want 100", got.Current, err)
+	}
+}
+
+func TestTiers(t *testing.T) {
+	ctx := context.Background()
+	storage.SetTiers(storagemart.Tiers{
+		{Tier: storagemart.TierBronze, Threshold: 0, Multiplier: 1},
+		{Tier: storagemart.TierSilver, Threshold: 100, Multiplier: 1.1},
+		{Tier: storagemart.TierGold, Threshold: 1000, Multiplier: 1.25},
+	})
+	defer storage.SetTiers(nil)
+
+	// У expiry начислено 150 из TestPointsExpiry
+	if changed, err := storage.TiersRecalculate(ctx, storagemart.TierBasisAccrued, time.Hour); err != nil || changed != 1 {
+		t.Fatalf("TiersRecalculate() = %d, %v, want 1", changed, err)
+	}
+	before, err := storage.UserReadOne(ctx, "expiry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Tier != storagemart.TierSilver || before.TierScore != 150 {
+		t.Errorf("tier = %s, score = %v, want SILVER, 150", before.Tier, before.TierScore)
+	}
+	if changed, err := storage.TiersRecalculate(ctx, storagemart.TierBasisAccrued, time.Hour); err != nil || changed != 0 {
+		t.Errorf("repeated TiersRecalculate() = %d, %v, want 0", changed, err)
+	}
+
+	// Начисление Silver получает надбавку 10%
+	if err := storage.UserOrderCreate(ctx, "expiry", "900004"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UserOrderUpdateAll(ctx, []storagedefault.Order{{Number: "900004", Status: storagedefault.StatusProcessed, Accrual: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := storage.UserReadOne(ctx, "expiry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Current-before.Current != 110 {
+		t.Errorf("credited = %v, want 110", after.Current-before.Current)
+	}
+	order, err := storage.UserOrderReadOne(ctx, "900004")
+	if err != nil || order.Accrual != 100 || order.Bonus != 10 {
+		t.Errorf("order = %+v, %v, want accrual 100 and bonus 10", order, err)
+	}
+}
+
+func TestWithdrawalRules(t *testing.T) {
+	ctx := context.Background()
+	// У admin из TestWithdrawBalance и TestWithdrawalReservation одно списание PROCESSED на 0,
+	// возвращенное и просроченное не считаются
+	stats, err := storage.UserWithdrawalStats(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Day != 0 || stats.Month != 0 || stats.LastHour != 1 || stats.PasswordChangedAt != nil {
+		t.Errorf("stats = %+v, want one withdrawal in the last hour", stats)
+	}
+
+	user, err := storage.UserReadOne(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.UserUpdatePassword(ctx, "admin", user.Password); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = storage.UserWithdrawalStats(ctx, "admin"); err != nil || stats.PasswordChangedAt == nil {
+		t.Errorf("stats = %+v, %v, want password change time", stats, err)
+	}
+
+	// Проверка получает статистику из транзакции списания, запрет отменяет списание
+	errDenied := errors.New("denied")
+	deny := func(stats storagemart.SpendingStats) ([]storagemart.WithdrawalFlag, error) {
+		if stats.LastHour != 1 || stats.PasswordChangedAt == nil {
+			t.Errorf("check stats = %+v, want one withdrawal and password change time", stats)
+		}
+		return nil, errDenied
+	}
+	if err := storage.WithdrawBalance(ctx, "admin", "5062821234567892", 0, 0, deny); !errors.Is(err, errDenied) {
+		t.Fatalf("denied withdrawal: want errDenied, got %v", err)
+	}
+
+	// Пометки сохраняются вместе со списанием
+	flags := []storagemart.WithdrawalFlag{{Rule: "velocity", Reason: "6 withdrawals in the last hour"}}
+	flag := func(storagemart.SpendingStats) ([]storagemart.WithdrawalFlag, error) {
+		return flags, nil
+	}
+	if err := storage.WithdrawBalance(ctx, "admin", "5062821234567892", 0, 0, flag); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := storage.connPool.QueryRow(ctx, `
+	SELECT COUNT(*) FROM withdrawal_flags WHERE withdrawal_number = $1`, "5062821234567892",
+	).Scan(&count); err != nil || count != 1 {
+		t.Errorf("withdrawal flags = %d, %v, want 1", count, err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+	// У expiry 210: 100 в партии со сроком час из TestPointsExpiry и 110 без срока из TestTiers
+	before, err := storage.UserReadOne(ctx, "user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := storage.Transfer(ctx, "expiry", "user1", 150, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.ID == 0 || tr.From != "expiry" || tr.To != "user1" || tr.Sum != 150 {
+		t.Errorf("unexpected transfer %+v", tr)
+	}
+	sender, err := storage.UserReadOne(ctx, "expiry")
+	if err != nil || sender.Current != 60 {
+		t.Errorf("sender current = %v, %v, want 60", sender.Current, err)
+	}
+	recipient, err := storage.UserReadOne(ctx, "user1")
+	if err != nil || recipient.Current-before.Current != 150 {
+		t.Errorf("recipient credited = %v, %v, want 150", recipient.Current-before.Current, err)
+	}
+	// Получатель получает баллы с теми же сроками
+	if sum, _, err := storage.UserPointsExpiring(ctx, "user1", 2*time.Hour); err != nil || sum != 100 {
+		t.Errorf("recipient expiring = %v, %v, want 100", sum, err)
+	}
+
+	if _, err := storage.Transfer(ctx, "expiry", "user1", 1000, nil); !errors.Is(err, storagemart.ErrInsufficientFunds) {
+		t.Errorf("want ErrInsufficientFunds, got %v", err)
+	}
+	if _, err := storage.Transfer(ctx, "expiry", "nobody", 1, nil); !errors.Is(err, storagemart.ErrRecipientNotFound) {
+		t.Errorf("want ErrRecipientNotFound, got %v", err)
+	}
+	// Проверка видит уже сделанный перевод, запрет отменяет перевод
+	errDenied := errors.New("denied")
+	deny := func(stats storagemart.SpendingStats) ([]storagemart.WithdrawalFlag, error) {
+		if stats.Day != 150 {
+			t.Errorf("check stats = %+v, want 150 today", stats)
+		}
+		return nil, errDenied
+	}
+	if _, err := storage.Transfer(ctx, "expiry", "user1", 1, deny); !errors.Is(err, errDenied) {
+		t.Errorf("want errDenied, got %v", err)
+	}
+	if _, err := storage.exec(ctx, `UPDATE users SET locked = true WHERE login = $1`, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Transfer(ctx, "expiry", "user1", 1, nil); !errors.Is(err, storagemart.ErrRecipientLocked) {
+		t.Errorf("want ErrRecipientLocked, got %v", err)
+	}
+	if _, err := storage.Transfer(ctx, "user1", "expiry", 1, nil); !errors.Is(err, storagemart.ErrUserLocked) {
+		t.Errorf("want ErrUserLocked, got %v", err)
+	}
+	if _, err := storage.exec(ctx, `UPDATE users SET locked = false WHERE login = $1`, "user1"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := storage.UserTransferStats(ctx, "expiry")
+	if err != nil || stats.Day != 150 || stats.Month != 150 || stats.LastHour != 1 {
+		t.Errorf("UserTransferStats() = %+v, %v, want 150 today", stats, err)
+	}
+
+	// Перевод виден обоим в истории списаний
+	for login, want := range map[string]storagemart.Withdrawal{
+		"expiry": {Type: storagemart.HistoryTransferOut, Counterparty: "user1"},
+		"user1":  {Type: storagemart.HistoryTransferIn, Counterparty: "expiry"},
+	} {
+		history, err := storage.UserWithdrawalsList(ctx, login, storagemart.ListQuery{Desc: true, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Type != want.Type || history[0].Counterparty != want.Counterparty ||
+			history[0].Order != tr.HistoryNumber() || history[0].Sum != 150 || history[0].Status != storagemart.WithdrawalProcessed {
+			t.Errorf("%s history = %+v, want %s", login, history, want.Type)
+		}
+	}
+}
+
+func TestReferrals(t *testing.T) {
+	ctx := context.Background()
+	storage.SetReferralProgram(storagemart.ReferralProgram{ReferrerBonus: 100, ReferredBonus: 50, MinAccrual: 10, MaxRewards: 1})
+	defer storage.SetReferralProgram(storagemart.ReferralProgram{})
+
+	referrer, err := storage.UserReadOne(ctx, "expiry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login, err := storage.UserLoginByReferralCode(ctx, referrer.ReferralCode); err != nil || login != "expiry" {
+		t.Fatalf("UserLoginByReferralCode() = %q, %v, want expiry", login, err)
+	}
+	if _, err := storage.UserLoginByReferralCode(ctx, "NOSUCHCODE"); !errors.Is(err, storagemart.ErrUnknownReferralCode) {
+		t.Errorf("want ErrUnknownReferralCode, got %v", err)
+	}
+
+	for _, login := range []string{"invited1", "invited2", "invited3"} {
+		if err := storage.UserCreate(ctx, storagemart.User{Creds: storagemart.Creds{Login: login, Password: login}, ReferredBy: "expiry"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	process := func(login, number string, accrual float64) {
+		t.Helper()
+		if err := storage.UserOrderCreate(ctx, login, number); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.UserOrderUpdateAll(ctx, []storagedefault.Order{{Number: number, Status: storagedefault.StatusProcessed, Accrual: accrual}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Первый заказ меньше минимума - бонуса нет и уже не будет
+	process("invited1", "910001", 5)
+	process("invited1", "910002", 100)
+	// Бонус обоим, повторная доставка начисления ничего не меняет
+	process("invited2", "910003", 100)
+	if err := storage.UserOrderUpdateAll(ctx, []storagedefault.Order{{Number: "910003", Status: storagedefault.StatusProcessed, Accrual: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	// Пригласивший уже получил предельное число бонусов
+	process("invited3", "910004", 100)
+
+	after, err := storage.UserReadOne(ctx, "expiry")
+	if err != nil || after.Current-referrer.Current != 100 {
+		t.Errorf("referrer credited = %v, %v, want 100", after.Current-referrer.Current, err)
+	}
+	for login, want := range map[string]float64{"invited1": 105, "invited2": 150, "invited3": 100} {
+		if u, err := storage.UserReadOne(ctx, login); err != nil || u.Current != want {
+			t.Errorf("%s current = %v, %v, want %v", login, u.Current, err, want)
+		}
+	}
+
+	// Бонус пригласившего не ссылается на чужой заказ
+	var reference string
+	var orderNumber *string
+	if err := storage.connPool.QueryRow(ctx, `
+	SELECT p.reference, l.order_number FROM points_ledger p
+		JOIN accrual_lots l ON l.id = p.lot_id
+		WHERE p.user_login = $1 AND p.type = $2`, "expiry", storagemart.LedgerReferral).Scan(&reference, &orderNumber); err != nil {
+		t.Fatal(err)
+	}
+	if reference != storagemart.ReferralReference("invited2") || orderNumber != nil {
+		t.Errorf("referrer ledger = %q, order %v, want %q without order", reference, orderNumber, storagemart.ReferralReference("invited2"))
+	}
+
+	stats, err := storage.UserReferralStats(ctx, "expiry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := storagemart.ReferralStats{Code: referrer.ReferralCode, Invited: 3, Rewarded: 1, Rejected: 2, Earned: 100}
+	if stats != want {
+		t.Errorf("UserReferralStats() = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,24 @@
+package storagemart
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	// Заказ перешел в новый статус, данные - заказ с номером, статусом и начислением
+	EventOrderStatus EventType = "order.status"
+	// Изменился баланс пользователя, данные - Balance
+	EventBalance EventType = "balance"
+)
+
+// Event - событие пользователя для потока /api/user/events.
+// ID растет монотонно, по нему клиент продолжает поток после переподключения
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      EventType       `json:"type"`
+	Data      json.RawMessage `json:"data" swaggertype:"object"`
+	CreatedAt time.Time       `json:"created_at" format:"date-time"`
+} //@name Event
@@ -0,0 +1,59 @@
+package storagemart
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxListLimit - наибольший размер страницы списка
+const MaxListLimit = 1000
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Cursor - позиция в списке: время и номер последней отданной записи.
+// Номер заказа уникален, поэтому пара однозначно задает место даже при одинаковом времени
+type Cursor struct {
+	Time   time.Time
+	Number string
+}
+
+// Encode возвращает непрозрачную строку для параметра cursor
+func (c Cursor) Encode() string {
+	raw := c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.Number
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor разбирает строку, полученную из Cursor.Encode
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+	ts, number, ok := strings.Cut(string(raw), "|")
+	if !ok || number == "" {
+		return Cursor{}, errInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return Cursor{}, errInvalidCursor
+	}
+	return Cursor{Time: t, Number: number}, nil
+}
+
+// ListQuery - параметры выборки заказов и списаний пользователя.
+// Нулевое значение - весь список от старых к новым, как раньше
+type ListQuery struct {
+	// Сколько записей вернуть, 0 - без ограничения
+	Limit int
+	// Вернуть записи после этой позиции
+	After *Cursor
+	// Только записи с этими статусами, пусто - любые
+	Statuses []string
+	// Полуинтервал [From, To) по времени загрузки заказа или списания
+	From time.Time
+	To   time.Time
+	// От новых к старым
+	Desc bool
+}
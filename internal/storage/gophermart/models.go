@@ -1,6 +1,8 @@
 package storagemart
 
 import (
+	"errors"
+	"strconv"
 	"time"
 
 	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
@@ -9,26 +11,116 @@ import (
 
 type Order struct {
 	storagedefault.Order
-	Sum         float64   `json:"sum,omitempty"`
+	// Надбавка уровня лояльности сверх accrual
+	Bonus       float64   `json:"bonus,omitempty"`
 	UploadedAt  time.Time `json:"uploaded_at" format:"date-time" example:"2020-12-10T15:15:45+03:00"`
 	ProcessedAt time.Time `json:"processed_at" format:"date-time" example:"2020-12-10T15:15:45+03:00"`
 	UserLogin   string    `json:"-"`
-	IsWithdrawn bool      `json:"is_withdrawn"`
 } //@name Order
 
+type WithdrawalStatus string
+
+// Жизненный цикл списания: PENDING -> PROCESSED -> REFUNDED,
+// либо PENDING -> CANCELLED или EXPIRED, если резерв не подтвердили вовремя
+const (
+	WithdrawalPending   WithdrawalStatus = "PENDING"
+	WithdrawalProcessed WithdrawalStatus = "PROCESSED"
+	WithdrawalCancelled WithdrawalStatus = "CANCELLED"
+	WithdrawalExpired   WithdrawalStatus = "EXPIRED"
+	WithdrawalRefunded  WithdrawalStatus = "REFUNDED"
+)
+
+// Движения баллов по партиям начислений в points_ledger
+const (
+	LedgerAccrued  = "ACCRUED"
+	LedgerSpent    = "SPENT"
+	LedgerReturned = "RETURNED"
+	LedgerExpired  = "EXPIRED"
+	// Баллы, полученные переводом от другого пользователя
+	LedgerReceived = "RECEIVED"
+	// Бонус за приглашение, reference - ReferralReference приглашенного
+	LedgerReferral = "REFERRAL"
+)
+
+// ReferralReference - reference движений бонусов за приглашение referred.
+// Номер заказа приглашенного не подходит: пригласившему этот заказ не принадлежит
+func ReferralReference(referred string) string {
+	return "referral:" + referred
+}
+
+var (
+	ErrInsufficientFunds      = errors.New("insufficient funds")
+	ErrWithdrawalNotFound     = errors.New("withdrawal not found")
+	ErrWithdrawalStatusChange = errors.New("withdrawal status does not allow this operation")
+	ErrUserLocked             = errors.New("user account is locked")
+	ErrRecipientNotFound      = errors.New("recipient not found")
+	ErrRecipientLocked        = errors.New("recipient account is locked")
+)
+
+// HistoryType - вид записи в истории списаний
+type HistoryType string
+
+const (
+	HistoryWithdrawal  HistoryType = "WITHDRAWAL"
+	HistoryTransferOut HistoryType = "TRANSFER_OUT"
+	HistoryTransferIn  HistoryType = "TRANSFER_IN"
+)
+
+// Withdrawal - списание баллов в счет оплаты заказа. Номер заказа списания
+// не связан с загруженными заказами пользователя.
+// В истории рядом со списаниями идут переводы: order у них - номер перевода вида T42
+type Withdrawal struct {
+	Type        HistoryType      `json:"type,omitempty" example:"WITHDRAWAL"`
+	Order       string           `json:"order" example:"12345678903"`
+	Sum         float64          `json:"sum"`
+	Status      WithdrawalStatus `json:"status"`
+	ProcessedAt time.Time        `json:"processed_at" format:"date-time" example:"2020-12-10T15:15:45+03:00"`
+	// До какого момента действует резерв, только для PENDING
+	ExpiresAt *time.Time `json:"expires_at,omitempty" format:"date-time" example:"2020-12-10T15:30:45+03:00"`
+	// Второй участник перевода
+	Counterparty string `json:"counterparty,omitempty" example:"family"`
+	UserLogin    string `json:"-"`
+} //@name Withdrawal
+
+// Transfer - перевод баллов другому пользователю
+type Transfer struct {
+	ID        int64     `json:"id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Sum       float64   `json:"sum"`
+	CreatedAt time.Time `json:"created_at" format:"date-time" example:"2020-12-10T15:15:45+03:00"`
+} //@name Transfer
+
+// HistoryNumber - номер перевода в истории списаний
+func (t Transfer) HistoryNumber() string {
+	return "T" + strconv.FormatInt(t.ID, 10)
+}
+
 type Creds struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
 } // @name Creds
 
+// Balance: current - доступно к списанию, reserved - удержано под неподтвержденные списания.
+// expiring_soon - сколько из current сгорит в ближайшее время, expiring_at - когда сгорит первая партия
 type Balance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current      float64    `json:"current"`
+	Reserved     float64    `json:"reserved"`
+	Withdrawn    float64    `json:"withdrawn"`
+	ExpiringSoon float64    `json:"expiring_soon,omitempty"`
+	ExpiringAt   *time.Time `json:"expiring_at,omitempty" format:"date-time" example:"2021-12-10T15:15:45+03:00"`
 } //@name Balance
 
 type User struct {
 	Creds
 	Balance
+	Tier      Tier    `json:"-"`
+	TierScore float64 `json:"-"`
+	// Заблокированный пользователь не может переводить и получать переводы
+	Locked bool `json:"-"`
+	// Собственный код приглашения и логин пригласившего
+	ReferralCode string `json:"-"`
+	ReferredBy   string `json:"-"`
 } //@name User
 
 func NewUserFromCreds(creds Creds) (User, error) {
@@ -72,3 +164,23 @@ func (c *Creds) PasswordCompare(creds Creds) bool {
 	}
 	return true
 }
+
+// SpendingStats - траты пользователя одного вида (списания или исходящие переводы)
+// за текущие сутки и календарный месяц и их число за последний час
+type SpendingStats struct {
+	Day      float64
+	Month    float64
+	LastHour int
+	// Когда пользователь последний раз менял пароль, nil - не менял
+	PasswordChangedAt *time.Time
+}
+
+// WithdrawalFlag - пометка списания для проверки администратором
+type WithdrawalFlag struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// SpendingCheck проверяет трату по статистике, прочитанной в транзакции траты
+// под блокировкой строки пользователя. Ошибка отменяет трату, пометки сохраняются вместе с ней
+type SpendingCheck func(stats SpendingStats) ([]WithdrawalFlag, error)
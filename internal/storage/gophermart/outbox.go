@@ -0,0 +1,92 @@
+package storagemart
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Типы доменных событий для внешних систем
+const (
+	OutboxUserRegistered    = "user.registered"
+	OutboxOrderUploaded     = "order.uploaded"
+	OutboxPointsAccrued     = "points.accrued"
+	OutboxPointsWithdrawn   = "points.withdrawn"
+	OutboxPointsRefunded    = "points.refunded"
+	OutboxPointsExpired     = "points.expired"
+	OutboxTierChanged       = "tier.changed"
+	OutboxWithdrawalFlagged = "withdrawal.flagged"
+	OutboxPointsTransferred = "points.transferred"
+	OutboxReferralRewarded  = "referral.rewarded"
+)
+
+// OutboxEvent - доменное событие из outbox. Пишется в одной транзакции с изменением,
+// доставляется relay как минимум один раз. Получатель убирает дубли по ID
+type OutboxEvent struct {
+	// Номер строки outbox, задает порядок доставки
+	Seq        int64           `json:"-"`
+	ID         string          `json:"id" example:"5f0c6c1e-3a7e-4c5e-9d0e-3c1f1b2a4d5e"`
+	Type       string          `json:"type" example:"points.accrued"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+	// Число неудачных попыток доставки
+	Attempts int `json:"-"`
+}
+
+// OutboxUser - данные user.registered
+type OutboxUser struct {
+	Login string `json:"login"`
+}
+
+// OutboxOrder - данные order.uploaded и points.accrued.
+// Accrual - зачислено всего, Bonus - из них надбавка уровня
+type OutboxOrder struct {
+	Login   string  `json:"login"`
+	Number  string  `json:"number"`
+	Accrual float64 `json:"accrual,omitempty"`
+	Bonus   float64 `json:"bonus,omitempty"`
+}
+
+// OutboxWithdrawal - данные points.withdrawn и points.refunded
+type OutboxWithdrawal struct {
+	Login string  `json:"login"`
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
+
+// OutboxPoints - данные points.expired
+type OutboxPoints struct {
+	Login string  `json:"login"`
+	Sum   float64 `json:"sum"`
+}
+
+// OutboxTier - данные tier.changed
+type OutboxTier struct {
+	Login string `json:"login"`
+	From  Tier   `json:"from"`
+	To    Tier   `json:"to"`
+}
+
+// OutboxWithdrawalFlag - данные withdrawal.flagged
+type OutboxWithdrawalFlag struct {
+	Login string           `json:"login"`
+	Order string           `json:"order"`
+	Sum   float64          `json:"sum"`
+	Flags []WithdrawalFlag `json:"flags"`
+}
+
+// OutboxTransfer - данные points.transferred
+type OutboxTransfer struct {
+	ID   int64   `json:"id"`
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Sum  float64 `json:"sum"`
+}
+
+// OutboxReferral - данные referral.rewarded
+type OutboxReferral struct {
+	Referrer      string  `json:"referrer"`
+	Referred      string  `json:"referred"`
+	Order         string  `json:"order"`
+	ReferrerBonus float64 `json:"referrer_bonus"`
+	ReferredBonus float64 `json:"referred_bonus"`
+}
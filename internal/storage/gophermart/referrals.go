@@ -0,0 +1,66 @@
+package storagemart
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+// Итог приглашения после первого обработанного заказа приглашенного пользователя
+const (
+	ReferralRewarded = "REWARDED"
+	ReferralRejected = "REJECTED"
+)
+
+// Причины, по которым бонус за приглашение не начислен
+const (
+	ReferralReasonMinAccrual = "min_accrual"
+	ReferralReasonLocked     = "locked"
+	ReferralReasonCap        = "referrer_cap"
+)
+
+// referralCodeLen - длина кода приглашения, 50 бит случайности
+const referralCodeLen = 10
+
+var ErrUnknownReferralCode = errors.New("unknown referral code")
+
+// ReferralProgram - бонусы за приглашение и защита от накруток
+type ReferralProgram struct {
+	// Бонус пригласившему и приглашенному
+	ReferrerBonus float64
+	ReferredBonus float64
+	// Первый заказ с меньшим начислением бонус не дает
+	MinAccrual float64
+	// Сколько бонусов может получить один пригласивший, 0 - без ограничения
+	MaxRewards int
+}
+
+// Enabled сообщает, начисляется ли за приглашения хоть что-то
+func (p ReferralProgram) Enabled() bool {
+	return p.ReferrerBonus > 0 || p.ReferredBonus > 0
+}
+
+// ReferralStats - приглашения пользователя. pending - приглашенные без обработанного заказа
+type ReferralStats struct {
+	Code     string  `json:"code" example:"K3QF7ZR2XA"`
+	Invited  int     `json:"invited"`
+	Rewarded int     `json:"rewarded"`
+	Rejected int     `json:"rejected"`
+	Pending  int     `json:"pending"`
+	Earned   float64 `json:"earned"`
+} //@name ReferralStats
+
+// NewReferralCode возвращает случайный код приглашения
+func NewReferralCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b)[:referralCodeLen], nil
+}
+
+// NormalizeReferralCode приводит введенный пользователем код к виду из базы
+func NormalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,35 @@
+package storagemart
+
+import "testing"
+
+func TestNewReferralCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		code, err := NewReferralCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != referralCodeLen || NormalizeReferralCode(code) != code {
+			t.Fatalf("code %q: want %d upper case characters", code, referralCodeLen)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeReferralCode(t *testing.T) {
+	if got := NormalizeReferralCode("  k3qf7zr2xa\n"); got != "K3QF7ZR2XA" {
+		t.Errorf("NormalizeReferralCode() = %q, want K3QF7ZR2XA", got)
+	}
+}
+
+func TestReferralProgram_Enabled(t *testing.T) {
+	if (ReferralProgram{MinAccrual: 10, MaxRewards: 5}).Enabled() {
+		t.Error("program without bonuses must be disabled")
+	}
+	if !(ReferralProgram{ReferredBonus: 50}).Enabled() {
+		t.Error("program with bonus must be enabled")
+	}
+}
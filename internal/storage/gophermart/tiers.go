@@ -0,0 +1,96 @@
+package storagemart
+
+import "math"
+
+type Tier string
+
+const (
+	TierBronze Tier = "BRONZE"
+	TierSilver Tier = "SILVER"
+	TierGold   Tier = "GOLD"
+)
+
+// По какой сумме за период считается уровень
+const (
+	TierBasisAccrued = "accrued"
+	TierBasisSpent   = "spent"
+)
+
+// TierLevel - уровень программы лояльности: с какой суммы за период он дается
+// и во сколько раз увеличивается начисление по заказу
+type TierLevel struct {
+	Tier       Tier
+	Threshold  float64
+	Multiplier float64
+}
+
+// Tiers - уровни по возрастанию порога. Первый уровень - базовый, его порог 0
+type Tiers []TierLevel
+
+// Level возвращает наибольший уровень, порог которого набран
+func (t Tiers) Level(score float64) TierLevel {
+	level := t[0]
+	for _, l := range t[1:] {
+		if score >= l.Threshold {
+			level = l
+		}
+	}
+	return level
+}
+
+// Find возвращает уровень по имени и следующий за ним, если он есть
+func (t Tiers) Find(tier Tier) (TierLevel, *TierLevel) {
+	for i, l := range t {
+		if l.Tier != tier {
+			continue
+		}
+		if i+1 < len(t) {
+			return l, &t[i+1]
+		}
+		return l, nil
+	}
+	// Уровня больше нет в настройках - считаем базовым
+	if len(t) > 1 {
+		return t[0], &t[1]
+	}
+	return t[0], nil
+}
+
+// Bonus возвращает надбавку уровня tier к начислению accrual, с точностью до копейки
+func (t Tiers) Bonus(tier Tier, accrual float64) float64 {
+	if len(t) == 0 {
+		return 0
+	}
+	level, _ := t.Find(tier)
+	return math.Round(accrual*(level.Multiplier-1)*100) / 100
+}
+
+// Profile - уровень пользователя и прогресс до следующего
+type Profile struct {
+	Login      string  `json:"login"`
+	Tier       Tier    `json:"tier" example:"SILVER"`
+	Multiplier float64 `json:"multiplier" example:"1.1"`
+	// Сумма за скользящий период, по которой считается уровень
+	Score float64 `json:"score" example:"1500"`
+	// Следующий уровень, его порог и сколько осталось набрать. Нет на высшем уровне
+	NextTier      *Tier   `json:"next_tier,omitempty" example:"GOLD"`
+	NextThreshold float64 `json:"next_threshold,omitempty" example:"5000"`
+	ToNext        float64 `json:"to_next,omitempty" example:"3500"`
+} //@name Profile
+
+// NewProfile собирает профиль по сохраненному уровню и сумме пользователя
+func (t Tiers) NewProfile(login string, tier Tier, score float64) Profile {
+	level, next := t.Find(tier)
+	p := Profile{
+		Login:      login,
+		Tier:       level.Tier,
+		Multiplier: level.Multiplier,
+		Score:      score,
+	}
+	if next != nil {
+		p.NextTier = &next.Tier
+		p.NextThreshold = next.Threshold
+		p.ToNext = math.Max(0, math.Round((next.Threshold-score)*100)/100)
+	}
+	return p
+}
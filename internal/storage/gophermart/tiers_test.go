@@ -0,0 +1,69 @@
+package storagemart
+
+import "testing"
+
+var testTiers = Tiers{
+	{Tier: TierBronze, Threshold: 0, Multiplier: 1},
+	{Tier: TierSilver, Threshold: 1000, Multiplier: 1.1},
+	{Tier: TierGold, Threshold: 5000, Multiplier: 1.25},
+}
+
+func TestTiers_Level(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  Tier
+	}{
+		{0, TierBronze},
+		{999.99, TierBronze},
+		{1000, TierSilver},
+		{4999, TierSilver},
+		{5000, TierGold},
+		{1e6, TierGold},
+	}
+	for _, tt := range tests {
+		if got := testTiers.Level(tt.score).Tier; got != tt.want {
+			t.Errorf("Level(%v) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestTiers_Bonus(t *testing.T) {
+	tests := []struct {
+		tier    Tier
+		accrual float64
+		want    float64
+	}{
+		{TierBronze, 500, 0},
+		{TierSilver, 500, 50},
+		{TierGold, 729.98, 182.5},
+		// Уровня нет в настройках - надбавки нет
+		{Tier("PLATINUM"), 500, 0},
+	}
+	for _, tt := range tests {
+		if got := testTiers.Bonus(tt.tier, tt.accrual); got != tt.want {
+			t.Errorf("Bonus(%s, %v) = %v, want %v", tt.tier, tt.accrual, got, tt.want)
+		}
+	}
+	if got := Tiers(nil).Bonus(TierGold, 500); got != 0 {
+		t.Errorf("Bonus without tiers = %v, want 0", got)
+	}
+}
+
+func TestTiers_NewProfile(t *testing.T) {
+	p := testTiers.NewProfile("user", TierSilver, 1500)
+	if p.Tier != TierSilver || p.Multiplier != 1.1 || p.NextTier == nil || *p.NextTier != TierGold ||
+		p.NextThreshold != 5000 || p.ToNext != 3500 {
+		t.Errorf("silver profile = %+v", p)
+	}
+
+	// Уровень пересчитывается воркером, сумма могла уже превысить порог
+	p = testTiers.NewProfile("user", TierSilver, 6000)
+	if p.ToNext != 0 {
+		t.Errorf("to_next = %v, want 0", p.ToNext)
+	}
+
+	p = testTiers.NewProfile("user", TierGold, 6000)
+	if p.NextTier != nil || p.ToNext != 0 {
+		t.Errorf("gold profile = %+v, want no next tier", p)
+	}
+}
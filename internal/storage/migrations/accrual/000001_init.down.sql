@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE IF EXISTS order_goods;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS goods;
+DROP TABLE IF EXISTS rewards;
+DROP TYPE IF EXISTS reward_type_enum;
+DROP TYPE IF EXISTS status_enum;
+
+COMMIT;
@@ -0,0 +1,94 @@
+BEGIN;
+
+-- Миграции выполняются с search_path = accrual, объекты без схемы создаются в ней.
+-- Базы, созданные общей миграцией 000001_init_all_in_one, хранили таблицы в public:
+-- переносим их вместе с данными, последовательностями и индексами
+
+DO $$
+BEGIN
+    IF to_regtype('accrual.status_enum') IS NULL THEN
+        CREATE TYPE accrual.status_enum AS ENUM ('NEW', 'REGISTERED', 'PROCESSING', 'INVALID', 'PROCESSED');
+    END IF;
+    IF to_regtype('accrual.reward_type_enum') IS NULL THEN
+        CREATE TYPE accrual.reward_type_enum AS ENUM ('%', 'pt');
+    END IF;
+END
+$$;
+
+ALTER TABLE IF EXISTS public.rewards SET SCHEMA accrual;
+ALTER TABLE IF EXISTS public.goods SET SCHEMA accrual;
+ALTER TABLE IF EXISTS public.orders SET SCHEMA accrual;
+ALTER TABLE IF EXISTS public.order_goods SET SCHEMA accrual;
+ALTER TABLE IF EXISTS public.webhooks SET SCHEMA accrual;
+ALTER TABLE IF EXISTS public.webhook_deliveries SET SCHEMA accrual;
+ALTER TABLE IF EXISTS public.webhook_dead_letters SET SCHEMA accrual;
+
+-- Таблица версий из промежуточной раскладки, когда наборы жили в public
+DROP TABLE IF EXISTS public.accrual_schema_migrations;
+
+-- Перенесенные таблицы ссылаются на общие типы из public, переводим их на свои
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'accrual' AND table_name = 'orders'
+            AND column_name = 'status' AND udt_schema = 'public'
+    ) THEN
+        ALTER TABLE accrual.orders
+            ALTER COLUMN status DROP DEFAULT,
+            ALTER COLUMN status TYPE accrual.status_enum USING status::text::accrual.status_enum,
+            ALTER COLUMN status SET DEFAULT 'REGISTERED';
+    END IF;
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'accrual' AND table_name = 'rewards'
+            AND column_name = 'reward_type' AND udt_schema = 'public'
+    ) THEN
+        ALTER TABLE accrual.rewards
+            ALTER COLUMN reward_type DROP DEFAULT,
+            ALTER COLUMN reward_type TYPE accrual.reward_type_enum USING reward_type::text::accrual.reward_type_enum,
+            ALTER COLUMN reward_type SET DEFAULT '%';
+    END IF;
+END
+$$;
+
+-- Общий тип удаляется последним из сервисов, пока он нужен другому - остается
+DO $$
+BEGIN
+    DROP TYPE IF EXISTS public.status_enum;
+EXCEPTION
+    WHEN dependent_objects_still_exist THEN NULL;
+END
+$$;
+
+DROP TYPE IF EXISTS public.reward_type_enum;
+
+CREATE TABLE IF NOT EXISTS rewards (
+    id SERIAL PRIMARY KEY,
+    match VARCHAR(255) UNIQUE NOT NULL,
+    reward NUMERIC(10,2) NOT NULL,
+    reward_type reward_type_enum DEFAULT '%' NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS goods (
+    id SERIAL PRIMARY KEY,
+    description VARCHAR(255) UNIQUE NOT NULL,
+    price NUMERIC(10,2) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    order_number VARCHAR(255) UNIQUE NOT NULL,
+    status status_enum DEFAULT 'REGISTERED' NOT NULL,
+    accrual NUMERIC(10,2)
+);
+
+CREATE TABLE IF NOT EXISTS order_goods (
+    order_id INT,
+    good_id INT,
+    PRIMARY KEY (order_id, good_id),
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (good_id) REFERENCES goods(id)
+);
+
+COMMIT;
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const usage = `Usage: %[1]s migrate [-d DATABASE_URI] <command>
+
+Commands:
+  up          apply all pending migrations
+  down [N]    roll back N migrations, 1 by default
+  status      print current and latest versions
+  force V     set version V and clear the dirty flag without running migrations
+`
+
+// ErrUsage - неверные аргументы подкоманды migrate
+var ErrUsage = errors.New("invalid migrate command")
+
+// Command выполняет подкоманду migrate. Адрес базы берется из -d или DATABASE_URI
+func Command(set Set, args []string, getenv func(string) string, out io.Writer) error {
+	fs := flag.NewFlagSet(set.Name+" migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprintf(out, usage, set.Name) }
+	dbURL := fs.String("d", getenv("DATABASE_URI"), "Database URI")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+	if *dbURL == "" {
+		return fmt.Errorf("%w: database uri is required, set -d or DATABASE_URI", ErrUsage)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	m, err := New(context.Background(), set, *dbURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch {
+	case cmd == "up" && len(cmdArgs) == 0:
+		err = m.Up()
+	case cmd == "down" && len(cmdArgs) <= 1:
+		steps := 1
+		if len(cmdArgs) == 1 {
+			if steps, err = strconv.Atoi(cmdArgs[0]); err != nil {
+				return fmt.Errorf("%w: invalid steps %q", ErrUsage, cmdArgs[0])
+			}
+		}
+		err = m.Down(steps)
+	case cmd == "force" && len(cmdArgs) == 1:
+		version, convErr := strconv.Atoi(cmdArgs[0])
+		if convErr != nil {
+			return fmt.Errorf("%w: invalid version %q", ErrUsage, cmdArgs[0])
+		}
+		err = m.Force(version)
+	case cmd == "status" && len(cmdArgs) == 0:
+	default:
+		fs.Usage()
+		return ErrUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: version %d, latest %d, dirty %t\n", set.Name, status.Version, status.Latest, status.Dirty)
+	return nil
+}
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS user_orders;
+DROP TABLE IF EXISTS users;
+DROP TYPE IF EXISTS status_enum;
+
+COMMIT;
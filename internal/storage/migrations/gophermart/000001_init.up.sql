@@ -0,0 +1,67 @@
+BEGIN;
+
+-- Миграции выполняются с search_path = gophermart, объекты без схемы создаются в ней.
+-- Базы, созданные общей миграцией 000001_init_all_in_one, хранили таблицы в public:
+-- переносим их вместе с данными, последовательностями и индексами
+
+DO $$
+BEGIN
+    IF to_regtype('gophermart.status_enum') IS NULL THEN
+        CREATE TYPE gophermart.status_enum AS ENUM ('NEW', 'REGISTERED', 'PROCESSING', 'INVALID', 'PROCESSED');
+    END IF;
+END
+$$;
+
+ALTER TABLE IF EXISTS public.users SET SCHEMA gophermart;
+ALTER TABLE IF EXISTS public.user_orders SET SCHEMA gophermart;
+
+-- Таблица версий из промежуточной раскладки, когда наборы жили в public
+DROP TABLE IF EXISTS public.gophermart_schema_migrations;
+
+-- Перенесенная таблица ссылается на общий тип из public, переводим ее на свой
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'gophermart' AND table_name = 'user_orders'
+            AND column_name = 'status' AND udt_schema = 'public'
+    ) THEN
+        ALTER TABLE gophermart.user_orders
+            ALTER COLUMN status DROP DEFAULT,
+            ALTER COLUMN status TYPE gophermart.status_enum USING status::text::gophermart.status_enum,
+            ALTER COLUMN status SET DEFAULT 'NEW';
+    END IF;
+END
+$$;
+
+-- Общий тип удаляется последним из сервисов, пока он нужен другому - остается
+DO $$
+BEGIN
+    DROP TYPE IF EXISTS public.status_enum;
+EXCEPTION
+    WHEN dependent_objects_still_exist THEN NULL;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    login VARCHAR(255) UNIQUE NOT NULL,
+    password VARCHAR(64) NOT NULL,
+    current NUMERIC(10,2) DEFAULT 0 NOT NULL,
+    withdrawn NUMERIC(10,2) DEFAULT 0 NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_orders (
+    id SERIAL PRIMARY KEY,
+    number VARCHAR(255) UNIQUE NOT NULL,
+    status status_enum DEFAULT 'NEW' NOT NULL,
+    sum NUMERIC(10,2) DEFAULT 0 NOT NULL,
+    is_withdrawn BOOLEAN DEFAULT false NOT NULL,
+    accrual NUMERIC(10,2) DEFAULT 0 NOT NULL,
+    uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP,
+    user_login VARCHAR(255) NOT NULL,
+    FOREIGN KEY (user_login) REFERENCES users(login)
+);
+
+COMMIT;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS user_orders_withdrawals_idx;
+DROP INDEX IF EXISTS user_orders_user_login_uploaded_at_idx;
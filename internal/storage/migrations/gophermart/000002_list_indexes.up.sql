@@ -0,0 +1,3 @@
+-- Страницы заказов и списаний пользователя идут по времени, вторым ключом - номер
+CREATE INDEX IF NOT EXISTS user_orders_user_login_uploaded_at_idx ON user_orders (user_login, uploaded_at, number);
+CREATE INDEX IF NOT EXISTS user_orders_withdrawals_idx ON user_orders (user_login, processed_at, number) WHERE is_withdrawn;
@@ -0,0 +1,18 @@
+BEGIN;
+
+ALTER TABLE user_orders
+    ADD COLUMN sum NUMERIC(10,2) DEFAULT 0 NOT NULL,
+    ADD COLUMN is_withdrawn BOOLEAN DEFAULT false NOT NULL;
+
+-- Если номер списания совпал с загруженным позже заказом, откат упадет:
+-- такие строки в одной таблице не уживаются, их нужно разобрать вручную
+INSERT INTO user_orders (number, user_login, sum, is_withdrawn, uploaded_at, processed_at)
+SELECT number, user_login, sum, true, processed_at, processed_at
+FROM withdrawals;
+
+CREATE INDEX IF NOT EXISTS user_orders_withdrawals_idx ON user_orders (user_login, processed_at, number) WHERE is_withdrawn;
+
+DROP TABLE IF EXISTS withdrawals;
+DROP TYPE IF EXISTS withdrawal_status_enum;
+
+COMMIT;
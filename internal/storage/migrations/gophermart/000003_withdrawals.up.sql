@@ -0,0 +1,28 @@
+BEGIN;
+
+CREATE TYPE withdrawal_status_enum AS ENUM ('PROCESSED');
+
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id BIGSERIAL PRIMARY KEY,
+    number VARCHAR(255) UNIQUE NOT NULL,
+    user_login VARCHAR(255) NOT NULL,
+    sum NUMERIC(10,2) NOT NULL,
+    status withdrawal_status_enum DEFAULT 'PROCESSED' NOT NULL,
+    processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_login) REFERENCES users(login)
+);
+
+CREATE INDEX IF NOT EXISTS withdrawals_user_login_processed_at_idx ON withdrawals (user_login, processed_at, number);
+
+-- Списания раньше хранились строками user_orders с is_withdrawn = true
+INSERT INTO withdrawals (number, user_login, sum, status, processed_at)
+SELECT number, user_login, sum, 'PROCESSED', COALESCE(processed_at, uploaded_at, CURRENT_TIMESTAMP)
+FROM user_orders
+WHERE is_withdrawn;
+
+DELETE FROM user_orders WHERE is_withdrawn;
+
+DROP INDEX IF EXISTS user_orders_withdrawals_idx;
+ALTER TABLE user_orders DROP COLUMN is_withdrawn, DROP COLUMN sum;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+-- Открытые резервы возвращаются на доступный баланс
+UPDATE users SET current = current + reserved;
+ALTER TABLE users DROP COLUMN IF EXISTS reserved;
+
+DROP INDEX IF EXISTS withdrawals_pending_expires_at_idx;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS expires_at;
+
+-- Значения из перечисления не удалить, тип пересоздается. В балансе учтены только
+-- подтвержденные списания, остальные удаляются из истории
+DELETE FROM withdrawals WHERE status <> 'PROCESSED';
+
+ALTER TABLE withdrawals ALTER COLUMN status DROP DEFAULT;
+ALTER TYPE withdrawal_status_enum RENAME TO withdrawal_status_enum_old;
+CREATE TYPE withdrawal_status_enum AS ENUM ('PROCESSED');
+ALTER TABLE withdrawals ALTER COLUMN status TYPE withdrawal_status_enum USING 'PROCESSED';
+ALTER TABLE withdrawals ALTER COLUMN status SET DEFAULT 'PROCESSED';
+DROP TYPE withdrawal_status_enum_old;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- golang-migrate отправляет файл одним Exec, и Postgres выполняет его в одной неявной транзакции.
+-- Новые значения перечисления нельзя использовать в той же транзакции, где они добавлены,
+-- поэтому в этом файле их нигде не упоминать: данные с ними - только в следующих миграциях
+ALTER TYPE withdrawal_status_enum ADD VALUE IF NOT EXISTS 'PENDING';
+ALTER TYPE withdrawal_status_enum ADD VALUE IF NOT EXISTS 'CANCELLED';
+ALTER TYPE withdrawal_status_enum ADD VALUE IF NOT EXISTS 'EXPIRED';
+ALTER TYPE withdrawal_status_enum ADD VALUE IF NOT EXISTS 'REFUNDED';
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reserved NUMERIC(10,2) DEFAULT 0 NOT NULL;
+
+CREATE INDEX IF NOT EXISTS withdrawals_pending_expires_at_idx ON withdrawals (expires_at) WHERE expires_at IS NOT NULL;
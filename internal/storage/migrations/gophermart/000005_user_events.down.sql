@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS user_events_notify ON user_events;
+DROP FUNCTION IF EXISTS user_events_notify();
+DROP TABLE IF EXISTS user_events;
+
+COMMIT;
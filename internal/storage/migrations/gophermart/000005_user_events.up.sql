@@ -0,0 +1,27 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS user_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_login VARCHAR(255) NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_login) REFERENCES users(login)
+);
+
+CREATE INDEX IF NOT EXISTS user_events_user_login_id_idx ON user_events (user_login, id);
+CREATE INDEX IF NOT EXISTS user_events_created_at_idx ON user_events (created_at);
+
+-- Уведомление уходит только после коммита транзакции, в которой записано событие
+CREATE OR REPLACE FUNCTION user_events_notify() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('user_events', NEW.user_login);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_events_notify ON user_events;
+CREATE TRIGGER user_events_notify AFTER INSERT ON user_events
+    FOR EACH ROW EXECUTE FUNCTION user_events_notify();
+
+COMMIT;
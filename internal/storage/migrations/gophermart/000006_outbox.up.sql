@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Доменные события ждут здесь доставки во внешние системы.
+-- Строка удаляется после успешной публикации, порядок доставки - по id
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID UNIQUE NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    attempts INT DEFAULT 0 NOT NULL,
+    last_error TEXT
+);
+
+COMMIT;
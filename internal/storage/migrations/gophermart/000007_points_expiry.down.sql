@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Сгоревшие баллы уже списаны с users.current, баланс остается как есть
+DROP TABLE IF EXISTS points_ledger;
+DROP TABLE IF EXISTS accrual_lots;
+
+COMMIT;
@@ -0,0 +1,44 @@
+BEGIN;
+
+-- Каждое начисление - отдельная партия баллов со своим сроком.
+-- Сумма remaining по партиям пользователя равна users.current
+CREATE TABLE IF NOT EXISTS accrual_lots (
+    id BIGSERIAL PRIMARY KEY,
+    user_login VARCHAR(255) NOT NULL,
+    -- Заказ начисления, NULL - остаток баланса, перенесенный при миграции
+    order_number VARCHAR(255),
+    amount NUMERIC(10,2) NOT NULL,
+    remaining NUMERIC(10,2) NOT NULL,
+    accrued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    -- NULL - баллы не сгорают
+    expires_at TIMESTAMP,
+    FOREIGN KEY (user_login) REFERENCES users(login)
+);
+
+CREATE INDEX IF NOT EXISTS accrual_lots_user_login_id_idx ON accrual_lots (user_login, id) WHERE remaining > 0;
+CREATE INDEX IF NOT EXISTS accrual_lots_expires_at_idx ON accrual_lots (expires_at) WHERE remaining > 0 AND expires_at IS NOT NULL;
+
+-- Движения баллов по партиям: ACCRUED и RETURNED с плюсом, SPENT и EXPIRED с минусом.
+-- reference - номер заказа начисления или списания
+CREATE TABLE IF NOT EXISTS points_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    user_login VARCHAR(255) NOT NULL,
+    lot_id BIGINT NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    amount NUMERIC(10,2) NOT NULL,
+    reference VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_login) REFERENCES users(login),
+    FOREIGN KEY (lot_id) REFERENCES accrual_lots(id)
+);
+
+CREATE INDEX IF NOT EXISTS points_ledger_reference_idx ON points_ledger (user_login, reference) WHERE reference IS NOT NULL;
+
+-- Накопленный до миграции баланс становится одной партией без срока
+INSERT INTO accrual_lots (user_login, amount, remaining)
+SELECT login, current, current FROM users WHERE current > 0;
+
+INSERT INTO points_ledger (user_login, lot_id, type, amount)
+SELECT user_login, id, 'ACCRUED', amount FROM accrual_lots;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS user_orders_processed_at_idx;
+ALTER TABLE user_orders DROP COLUMN IF EXISTS bonus;
+ALTER TABLE users DROP COLUMN IF EXISTS tier_score;
+ALTER TABLE users DROP COLUMN IF EXISTS tier;
+
+COMMIT;
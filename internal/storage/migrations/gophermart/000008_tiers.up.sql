@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Уровень пересчитывает воркер по сумме за скользящий период, tier_score - эта сумма
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier VARCHAR(16) DEFAULT 'BRONZE' NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier_score NUMERIC(12,2) DEFAULT 0 NOT NULL;
+
+-- Надбавка уровня к начислению Accrual System, на баланс зачисляется accrual + bonus
+ALTER TABLE user_orders ADD COLUMN IF NOT EXISTS bonus NUMERIC(10,2) DEFAULT 0 NOT NULL;
+
+CREATE INDEX IF NOT EXISTS user_orders_processed_at_idx ON user_orders (processed_at) WHERE status = 'PROCESSED';
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS withdrawal_flags;
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
+
+COMMIT;
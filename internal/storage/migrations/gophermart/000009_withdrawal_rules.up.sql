@@ -0,0 +1,19 @@
+BEGIN;
+
+-- После смены пароля списания на время запрещены
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP;
+
+-- Пометки подозрительных списаний. reviewed_at проставляет администратор после проверки
+CREATE TABLE IF NOT EXISTS withdrawal_flags (
+    id BIGSERIAL PRIMARY KEY,
+    withdrawal_number VARCHAR(255) NOT NULL REFERENCES withdrawals(number) ON DELETE CASCADE,
+    user_login VARCHAR(255) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+    rule VARCHAR(64) NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS withdrawal_flags_unreviewed_idx ON withdrawal_flags (created_at) WHERE reviewed_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS transfers;
+ALTER TABLE users DROP COLUMN IF EXISTS locked;
+
+COMMIT;
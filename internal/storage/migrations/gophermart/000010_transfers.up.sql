@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Заблокированный пользователь не может переводить и получать переводы
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked BOOLEAN DEFAULT false NOT NULL;
+
+-- Переводы баллов между пользователями. В истории номер перевода выглядит как T<id>
+CREATE TABLE IF NOT EXISTS transfers (
+    id BIGSERIAL PRIMARY KEY,
+    sender_login VARCHAR(255) NOT NULL REFERENCES users(login),
+    recipient_login VARCHAR(255) NOT NULL REFERENCES users(login),
+    sum NUMERIC(10,2) NOT NULL CHECK (sum > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CHECK (sender_login != recipient_login)
+);
+
+CREATE INDEX IF NOT EXISTS transfers_sender_login_created_at_idx ON transfers (sender_login, created_at);
+CREATE INDEX IF NOT EXISTS transfers_recipient_login_created_at_idx ON transfers (recipient_login, created_at);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP TABLE IF EXISTS referral_rewards;
+DROP INDEX IF EXISTS users_referred_by_idx;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_referral_code_key;
+ALTER TABLE users DROP COLUMN IF EXISTS referred_by;
+ALTER TABLE users DROP COLUMN IF EXISTS referral_code;
+
+COMMIT;
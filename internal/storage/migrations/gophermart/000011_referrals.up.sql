@@ -0,0 +1,29 @@
+BEGIN;
+
+-- Код приглашения пользователя и логин пригласившего
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code VARCHAR(16);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referred_by VARCHAR(255) REFERENCES users(login);
+
+UPDATE users SET referral_code = upper(substr(md5(random()::text || login), 1, 10)) WHERE referral_code IS NULL;
+
+ALTER TABLE users ALTER COLUMN referral_code SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_referral_code_key UNIQUE (referral_code);
+
+CREATE INDEX IF NOT EXISTS users_referred_by_idx ON users (referred_by) WHERE referred_by IS NOT NULL;
+
+-- Итог приглашения: по одной строке на приглашенного, так бонус начисляется ровно один раз.
+-- REJECTED - бонус не положен, причина в reason
+CREATE TABLE IF NOT EXISTS referral_rewards (
+    referred_login VARCHAR(255) PRIMARY KEY REFERENCES users(login),
+    referrer_login VARCHAR(255) NOT NULL REFERENCES users(login),
+    order_number VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    reason VARCHAR(64),
+    referrer_bonus NUMERIC(10,2) DEFAULT 0 NOT NULL,
+    referred_bonus NUMERIC(10,2) DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS referral_rewards_referrer_login_idx ON referral_rewards (referrer_login, status);
+
+COMMIT;
@@ -0,0 +1,205 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed gophermart/*.sql accrual/*.sql
+var files embed.FS
+
+// ErrSchemaBehind - в базе применены не все миграции сервиса
+var ErrSchemaBehind = errors.New("database schema is behind, run migrate up")
+
+// ErrSchemaDirty - последняя миграция упала на середине, нужен migrate force
+var ErrSchemaDirty = errors.New("database schema is dirty, fix it and run migrate force")
+
+// Set - набор миграций одного сервиса. Каждый сервис владеет своей схемой
+// в базе, таблица версий лежит в ней же, поэтому сервисы мигрируют независимо
+type Set struct {
+	Name   string
+	Dir    string
+	Schema string
+	Table  string
+}
+
+var (
+	Gophermart = Set{Name: "gophermart", Dir: "gophermart", Schema: "gophermart", Table: "gophermart_schema_migrations"}
+	Accrual    = Set{Name: "accrual", Dir: "accrual", Schema: "accrual", Table: "accrual_schema_migrations"}
+)
+
+// Status - состояние схемы относительно встроенных миграций
+type Status struct {
+	Version uint `json:"version"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+// Check возвращает ошибку, если схема отстает или грязная
+func (s Status) Check() error {
+	if s.Dirty {
+		return ErrSchemaDirty
+	}
+	if s.Version < s.Latest {
+		return fmt.Errorf("%w: version %d, latest %d", ErrSchemaBehind, s.Version, s.Latest)
+	}
+	return nil
+}
+
+// Schema - хранилище, которое умеет мигрировать свою схему
+type Schema interface {
+	Migrate(ctx context.Context) error
+	MigrationStatus(ctx context.Context) (Status, error)
+}
+
+// Prepare при autoMigrate применяет новые миграции и проверяет,
+// что схема не отстает от встроенных миграций и не осталась грязной
+func Prepare(ctx context.Context, s Schema, autoMigrate bool) error {
+	if autoMigrate {
+		if err := s.Migrate(ctx); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+	status, err := s.MigrationStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+	return status.Check()
+}
+
+// Latest возвращает последнюю встроенную версию набора
+func (s Set) Latest() (uint, error) {
+	src, err := iofs.New(files, s.Dir)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
+
+// Migrator применяет миграции набора к базе
+type Migrator struct {
+	set Set
+	m   *migrate.Migrate
+}
+
+// New создает схему сервиса, если ее еще нет, и открывает соединение для миграций
+// с search_path на эту схему. dbURL - адрес postgres://
+func New(ctx context.Context, set Set, dbURL string) (*Migrator, error) {
+	if err := createSchema(ctx, set.Schema, dbURL); err != nil {
+		return nil, err
+	}
+	src, err := iofs.New(files, set.Dir)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("search_path", set.Schema)
+	q.Set("x-migrations-table", set.Table)
+	u.RawQuery = q.Encode()
+
+	m, err := migrate.NewWithSourceInstance("iofs", src, u.String())
+	if err != nil {
+		return nil, err
+	}
+	m.Log = migrateLogger{set: set.Name}
+	return &Migrator{set: set, m: m}, nil
+}
+
+// createSchema нужна до golang-migrate: он создает таблицу версий в текущей схеме
+func createSchema(ctx context.Context, schema, dbURL string) error {
+	conn, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{schema}.Sanitize())
+	return err
+}
+
+// Up применяет все новые миграции. Если применять нечего, это не ошибка
+func (m *Migrator) Up() error {
+	if err := m.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Down откатывает steps миграций
+func (m *Migrator) Down(steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	if err := m.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// Force записывает версию без применения миграций, снимая признак dirty
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+// Status возвращает текущую и последнюю версии
+func (m *Migrator) Status() (Status, error) {
+	latest, err := m.set.Latest()
+	if err != nil {
+		return Status{}, err
+	}
+	version, dirty, err := m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return Status{Latest: latest}, nil
+	}
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{Version: version, Latest: latest, Dirty: dirty}, nil
+}
+
+// Close закрывает источник и соединение с базой
+func (m *Migrator) Close() error {
+	srcErr, dbErr := m.m.Close()
+	return errors.Join(srcErr, dbErr)
+}
+
+// migrateLogger пишет журнал golang-migrate в slog
+type migrateLogger struct {
+	set string
+}
+
+func (l migrateLogger) Printf(format string, v ...any) {
+	slog.Debug(fmt.Sprintf(format, v...), slog.String("migrations", l.set))
+}
+
+func (l migrateLogger) Verbose() bool {
+	return false
+}
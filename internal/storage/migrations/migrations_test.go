@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSet_Latest(t *testing.T) {
+	tests := []struct {
+		set  Set
+		want uint
+	}{
+		{set: Gophermart, want: 11},
+		{set: Accrual, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.set.Name, func(t *testing.T) {
+			got, err := tt.set.Latest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Latest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus_Check(t *testing.T) {
+	if err := (Status{Version: 2, Latest: 2}).Check(); err != nil {
+		t.Errorf("up to date: %v", err)
+	}
+	if err := (Status{Version: 1, Latest: 2}).Check(); !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("behind: %v", err)
+	}
+	if err := (Status{Version: 2, Latest: 2, Dirty: true}).Check(); !errors.Is(err, ErrSchemaDirty) {
+		t.Errorf("dirty: %v", err)
+	}
+}
+
+func TestCommand_Usage(t *testing.T) {
+	getenv := func(string) string { return "" }
+	var out bytes.Buffer
+
+	if err := Command(Gophermart, []string{"up"}, getenv, &out); !errors.Is(err, ErrUsage) {
+		t.Error("expected error without database uri")
+	}
+	// До подключения к базе проверяется только наличие подкоманды
+	if err := Command(Gophermart, []string{"-d", "postgres://db"}, getenv, &out); !errors.Is(err, ErrUsage) {
+		t.Errorf("Command() error = %v, want usage error", err)
+	}
+}
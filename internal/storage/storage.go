@@ -2,40 +2,96 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
 	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
 	"github.com/mi4r/gophermart/internal/storage/drivers"
 	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	"github.com/mi4r/gophermart/internal/storage/migrations"
 )
 
 type Storage interface {
 	Open(ctx context.Context) error
 	Close()
-	Ping() error
-	Migrate(path string)
+	Ping(ctx context.Context) error
+	// Применяет встроенные миграции сервиса
+	Migrate(ctx context.Context) error
+	// Текущая и последняя версии схемы и признак незавершенной миграции
+	MigrationStatus(ctx context.Context) (migrations.Status, error)
 }
 
 type StorageGophermart interface {
 	Storage
 	UserCreate(ctx context.Context, user storagemart.User) error
 	UserReadOne(ctx context.Context, login string) (storagemart.User, error)
+	// Меняет хеш пароля, время смены включает запрет списаний
+	UserUpdatePassword(ctx context.Context, login, hash string) error
 
 	UserOrderCreate(ctx context.Context, login, number string) error
 	UserOrderReadOne(ctx context.Context, number string) (storagemart.Order, error)
 	UserOrdersReadByLogin(ctx context.Context, login string) ([]storagemart.Order, error)
+	// Страница заказов пользователя с фильтрами и сортировкой
+	UserOrdersList(ctx context.Context, login string, q storagemart.ListQuery) ([]storagemart.Order, error)
 
-	WithdrawBalance(ctx context.Context, login, order string, sum, curBalance float64) error
-	GetUserWithdrawals(ctx context.Context, login string) ([]storagedefault.WithdrownOrder, error)
+	// Списание и резерв под списание проверяет check в транзакции траты.
+	// Подтверждение, отмена и возврат резерва
+	WithdrawBalance(ctx context.Context, login, order string, sum, curBalance float64, check storagemart.SpendingCheck) error
+	WithdrawalReserve(ctx context.Context, login, order string, sum float64, ttl time.Duration, check storagemart.SpendingCheck) (storagemart.Withdrawal, error)
+	WithdrawalConfirm(ctx context.Context, login, order string) (storagemart.Withdrawal, error)
+	WithdrawalCancel(ctx context.Context, login, order string) (storagemart.Withdrawal, error)
+	WithdrawalRefund(ctx context.Context, login, order string) (storagemart.Withdrawal, error)
+	// Снимает просроченные резервы, возвращает их число
+	WithdrawalsExpire(ctx context.Context) (int, error)
+	// Перевод баллов другому пользователю, check проверяет его в транзакции перевода
+	Transfer(ctx context.Context, from, to string, sum float64, check storagemart.SpendingCheck) (storagemart.Transfer, error)
+	GetUserWithdrawals(ctx context.Context, login string) ([]storagemart.Withdrawal, error)
+	// Страница истории списаний и переводов пользователя с фильтрами и сортировкой
+	UserWithdrawalsList(ctx context.Context, login string, q storagemart.ListQuery) ([]storagemart.Withdrawal, error)
 	UserOrderReadAllNumbers(ctx context.Context) ([]string, error)
+	// Число заказов, ожидающих расчета в Accrual System
+	UserOrderCountPending(ctx context.Context) (int, error)
 	UserOrderUpdateStatus(ctx context.Context, number string, status storagedefault.OrderStatus) error
 	UserOrderUpdateAll(ctx context.Context, orders []storagedefault.Order) error
+
+	// События пользователя после afterID по возрастанию id
+	UserEventsList(ctx context.Context, login string, afterID int64, limit int) ([]storagemart.Event, error)
+	UserEventLastID(ctx context.Context, login string) (int64, error)
+	// Удаляет события старше age, возвращает их число
+	UserEventsDeleteOlder(ctx context.Context, age time.Duration) (int64, error)
+	// Вызывает notify с логином пользователя на каждое новое событие до отмены ctx или обрыва соединения
+	UserEventsListen(ctx context.Context, notify func(login string)) error
+
+	// Срок жизни новых начислений, 0 - баллы не сгорают
+	SetPointsTTL(ttl time.Duration)
+	// Сжигает до limit партий с истекшим сроком, возвращает их число
+	PointsExpire(ctx context.Context, limit int) (int, error)
+	// Сколько баллов сгорит в течение within и когда сгорит первая из этих партий
+	UserPointsExpiring(ctx context.Context, login string, within time.Duration) (float64, *time.Time, error)
+
+	// Бонусы за приглашения, начисляются за первый обработанный заказ приглашенного
+	SetReferralProgram(p storagemart.ReferralProgram)
+	// Логин владельца кода приглашения или ErrUnknownReferralCode
+	UserLoginByReferralCode(ctx context.Context, code string) (string, error)
+	UserReferralStats(ctx context.Context, login string) (storagemart.ReferralStats, error)
+
+	// Уровни лояльности для надбавки к начислению
+	SetTiers(tiers storagemart.Tiers)
+	// Пересчитывает уровни по сумме basis за window, возвращает число сменивших уровень
+	TiersRecalculate(ctx context.Context, basis string, window time.Duration) (int, error)
+
+	// Доменные события outbox в порядке записи
+	OutboxReadPending(ctx context.Context, limit int) ([]storagemart.OutboxEvent, error)
+	OutboxDone(ctx context.Context, seq int64) error
+	OutboxFailed(ctx context.Context, seq int64, lastErr string) error
+	// Удаляет недоставленные события старше age, возвращает их число
+	OutboxDeleteOlder(ctx context.Context, age time.Duration) (int64, error)
 }
 
 func NewStorageGophermart(driverType, path string) StorageGophermart {
 	switch driverType {
 	default:
-		return drivers.NewPgxDriver(path)
+		return drivers.NewGophermartDriver(path)
 	}
 }
 
@@ -48,11 +104,21 @@ type StorageAccrualSystem interface {
 	OrderRegUpdateOne(ctx context.Context, order storagedefault.Order) error
 	// Для безопасности и неизменности Accrual
 	OrderRegUpdateStatus(ctx context.Context, status storagedefault.OrderStatus, number string) error
+
+	WebhookCreate(ctx context.Context, webhook storageaccrual.Webhook) (int64, error)
+	WebhookDelete(ctx context.Context, id int64) error
+	// Ставит событие в очередь доставки всем подписчикам
+	WebhookEventCreate(ctx context.Context, event storagedefault.WebhookEvent) error
+	WebhookDeliveriesReadDue(ctx context.Context, limit int) ([]storageaccrual.WebhookDelivery, error)
+	WebhookDeliveryDone(ctx context.Context, id int64) error
+	WebhookDeliveryRetry(ctx context.Context, id int64, nextAttemptAt time.Time, lastErr string) error
+	// Переносит доставку в таблицу недоставленных событий
+	WebhookDeliveryDeadLetter(ctx context.Context, id int64, lastErr string) error
 }
 
 func NewStorageAccrual(driverType, path string) StorageAccrualSystem {
 	switch driverType {
 	default:
-		return drivers.NewPgxDriver(path)
+		return drivers.NewAccrualDriver(path)
 	}
 }
@@ -0,0 +1,127 @@
+package workeraccrual
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/mi4r/gophermart/internal/storage"
+	"github.com/mi4r/gophermart/internal/worker"
+)
+
+// Pool - воркеры расчета начислений, читающие один канал задач.
+// Размер пула можно менять на лету
+type Pool struct {
+	TaskCh  chan Task
+	Storage storage.StorageAccrualSystem
+
+	mu      sync.Mutex
+	workers []*Worker
+	// Воркеры, которые получили Quit и дорабатывают текущую задачу
+	quitting []*Worker
+	nextID   int
+	started  bool
+}
+
+// NewPool создает пул из size воркеров
+func NewPool(taskCh chan Task, size int) *Pool {
+	p := &Pool{TaskCh: taskCh}
+	p.grow(size)
+	return p
+}
+
+// SetStorage задает уже открытое хранилище всем воркерам. Закрывает его вызывающий
+func (p *Pool) SetStorage(storage storage.StorageAccrualSystem) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Storage = storage
+	for _, w := range p.workers {
+		w.SetStorage(storage)
+	}
+}
+
+// Start запускает все воркеры пула
+func (p *Pool) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started = true
+	for _, w := range p.workers {
+		w.Start()
+	}
+}
+
+// Size возвращает число активных воркеров
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+// Resize меняет число воркеров. Лишние воркеры выходят после текущей задачи
+func (p *Pool) Resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case size > len(p.workers):
+		p.grow(size - len(p.workers))
+	case size < len(p.workers):
+		for _, w := range p.workers[size:] {
+			w.Quit()
+			p.quitting = append(p.quitting, w)
+		}
+		p.workers = p.workers[:size]
+	default:
+		return
+	}
+	slog.Info("accrual worker pool resized", slog.Int("size", size))
+}
+
+// grow добавляет n воркеров. Вызывается под мьютексом или до запуска
+func (p *Pool) grow(n int) {
+	for i := 0; i < n; i++ {
+		p.nextID++
+		w := NewWorker(p.nextID, p.TaskCh)
+		w.SetStorage(p.Storage)
+		if p.started {
+			w.Start()
+		}
+		p.workers = append(p.workers, w)
+	}
+}
+
+// Stop ждет завершения всех воркеров. Канал задач должен быть закрыт до вызова Stop
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	workers := append(append([]*Worker(nil), p.workers...), p.quitting...)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, w := range workers {
+		errs = append(errs, w.Stop(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Status объединяет состояние воркеров: пул работает, пока работает хотя бы один
+func (p *Pool) Status() worker.Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var status worker.Status
+	for _, w := range p.workers {
+		ws := w.status.Status()
+		status.Running = status.Running || ws.Running
+		if ws.LastRunAt != nil && (status.LastRunAt == nil || ws.LastRunAt.After(*status.LastRunAt)) {
+			status.LastRunAt = ws.LastRunAt
+			status.LastError = ws.LastError
+		}
+	}
+	status.QueueDepth = len(p.TaskCh)
+	status.Workers = len(p.workers)
+	return status
+}
@@ -0,0 +1,65 @@
+package workeraccrual
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool_Resize(t *testing.T) {
+	taskCh := make(chan Task)
+	pool := NewPool(taskCh, 2)
+	pool.Start()
+
+	pool.Resize(4)
+	if got := pool.Size(); got != 4 {
+		t.Fatalf("Size() = %d, want 4", got)
+	}
+	pool.Resize(1)
+	if got := pool.Size(); got != 1 {
+		t.Fatalf("Size() = %d, want 1", got)
+	}
+	// Размер пула не меньше одного
+	pool.Resize(0)
+	if got := pool.Size(); got != 1 {
+		t.Fatalf("Size() = %d, want 1", got)
+	}
+
+	status := pool.Status()
+	if !status.Running || status.Workers != 1 {
+		t.Errorf("Status() = %+v", status)
+	}
+
+	close(taskCh)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Остановка дожидается и активных воркеров, и тех, что вышли при уменьшении пула
+	if err := pool.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if pool.Status().Running {
+		t.Error("pool must be stopped")
+	}
+}
+
+func TestPool_StopTimeoutWithOpenChannel(t *testing.T) {
+	// Канал не закрыт: Shutdown сервера не дождался запросов
+	pool := NewPool(make(chan Task), 2)
+	pool.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error, 1)
+	go func() { done <- pool.Stop(ctx) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Stop() error = nil, want context error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stop() hangs with open task channel")
+	}
+	if pool.Status().Running {
+		t.Error("pool must be stopped")
+	}
+}
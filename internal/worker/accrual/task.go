@@ -1,20 +1,40 @@
 package workeraccrual
 
 import (
+	"context"
+
 	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
 	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/lib/logger"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Task struct {
 	Order storageaccrual.Order
+	// Контекст трассировки запроса, который поставил задачу
+	SpanContext trace.SpanContext
+	// X-Request-ID запроса, который поставил задачу
+	RequestID string
 }
 
 type TaskResult struct {
 	ResultOrder storagedefault.Order
 }
 
-func NewTask(order storageaccrual.Order) Task {
+func NewTask(ctx context.Context, order storageaccrual.Order) Task {
 	return Task{
-		Order: order,
+		Order:       order,
+		SpanContext: trace.SpanContextFromContext(ctx),
+		RequestID:   logger.RequestID(ctx),
+	}
+}
+
+// Context продолжает трассировку и логи запроса в контексте воркера
+func (t Task) Context(ctx context.Context) context.Context {
+	ctx = logger.WithRequestID(ctx, t.RequestID)
+	ctx = logger.WithOrder(ctx, t.Order.Order)
+	if !t.SpanContext.IsValid() {
+		return ctx
 	}
+	return trace.ContextWithRemoteSpanContext(ctx, t.SpanContext)
 }
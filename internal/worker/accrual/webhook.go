@@ -0,0 +1,196 @@
+package workeraccrual
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/metrics"
+	"github.com/mi4r/gophermart/internal/storage"
+	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
+	"github.com/mi4r/gophermart/internal/tracing"
+	"github.com/mi4r/gophermart/lib/logger"
+	"github.com/mi4r/gophermart/lib/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	webhookBatchSize   = 100
+	webhookTimeout     = 10 * time.Second
+	webhookBaseBackoff = 5 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// Модуль логов отправщика для уровней из -lm
+	webhookLogModule = "webhook"
+)
+
+// WebhookDispatcher доставляет события о расчете заказов подписчикам.
+// Доставка "как минимум один раз": событие удаляется только после ответа 2xx,
+// а после MaxAttempts неудачных попыток переносится в dead-letter таблицу.
+type WebhookDispatcher struct {
+	TickerCh    *time.Ticker
+	MaxAttempts int
+	Storage     storage.StorageAccrualSystem
+	client      *http.Client
+	ctx         context.Context
+	cancel      context.CancelFunc
+	quitCh      chan struct{}
+	doneCh      chan struct{}
+}
+
+// NewWebhookDispatcher создает новый экземпляр отправщика вебхуков
+func NewWebhookDispatcher(tickerCh *time.Ticker, maxAttempts int) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(logger.WithModule(context.Background(), webhookLogModule))
+	return &WebhookDispatcher{
+		TickerCh:    tickerCh,
+		MaxAttempts: maxAttempts,
+		client: &http.Client{
+			Timeout:   webhookTimeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		quitCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+}
+
+func (d *WebhookDispatcher) SetStorage(storage storage.StorageAccrualSystem) {
+	d.Storage = storage
+}
+
+// Start запускает отправку вебхуков по тикеру
+func (d *WebhookDispatcher) Start() {
+	go func() {
+		defer close(d.doneCh)
+		for {
+			select {
+			case <-d.TickerCh.C:
+				if err := d.Execute(d.ctx); err != nil {
+					slog.ErrorContext(d.ctx, "webhook dispatch error", slog.String("err", err.Error()))
+				}
+			case <-d.quitCh:
+				slog.DebugContext(d.ctx, "webhook dispatcher stopped")
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает отправку вебхуков и ждет завершения текущей пачки.
+// Если ctx истек раньше, отправка прерывается: недоставленное уйдет после рестарта
+func (d *WebhookDispatcher) Stop(ctx context.Context) error {
+	d.TickerCh.Stop()
+	close(d.quitCh)
+
+	select {
+	case <-d.doneCh:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-d.doneCh
+		return ctx.Err()
+	}
+}
+
+// Execute отправляет все события, время доставки которых наступило
+func (d *WebhookDispatcher) Execute(ctx context.Context) error {
+	deliveries, err := d.Storage.WebhookDeliveriesReadDue(ctx, webhookBatchSize)
+	if err != nil {
+		return err
+	}
+	metrics.WorkerQueueDepth.WithLabelValues(metrics.WorkerWebhook).Set(float64(len(deliveries)))
+
+	for _, delivery := range deliveries {
+		sendErr := d.deliver(ctx, delivery)
+		if sendErr == nil {
+			metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerWebhook, metrics.ResultSuccess).Inc()
+			if err := d.Storage.WebhookDeliveryDone(ctx, delivery.ID); err != nil {
+				return err
+			}
+			slog.DebugContext(ctx, "webhook delivered",
+				slog.String("event", delivery.EventID),
+				slog.String("url", delivery.URL),
+			)
+			continue
+		}
+
+		metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerWebhook, metrics.ResultFailure).Inc()
+		attempt := delivery.Attempts + 1
+		slog.WarnContext(ctx, "webhook delivery failed",
+			slog.String("event", delivery.EventID),
+			slog.String("url", delivery.URL),
+			slog.Int("attempt", attempt),
+			slog.String("err", sendErr.Error()),
+		)
+		if attempt >= d.MaxAttempts {
+			if err := d.Storage.WebhookDeliveryDeadLetter(ctx, delivery.ID, sendErr.Error()); err != nil {
+				return err
+			}
+			slog.ErrorContext(ctx, "webhook moved to dead letters",
+				slog.String("event", delivery.EventID),
+				slog.String("url", delivery.URL),
+			)
+			continue
+		}
+		nextAttemptAt := time.Now().Add(webhookBackoff(attempt))
+		if err := d.Storage.WebhookDeliveryRetry(ctx, delivery.ID, nextAttemptAt, sendErr.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver отправляет событие в отдельном спане
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery storageaccrual.WebhookDelivery) error {
+	ctx, span := tracing.Tracer().Start(ctx, "webhook.deliver", trace.WithAttributes(
+		attribute.String("webhook.event_id", delivery.EventID),
+		attribute.String("webhook.url", delivery.URL),
+		attribute.Int("webhook.attempt", delivery.Attempts+1),
+	))
+	defer span.End()
+
+	err := d.send(ctx, delivery)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, delivery storageaccrual.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	webhook.SetHeaders(req, delivery.Secret, delivery.EventID, time.Now(), delivery.Payload)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookBackoff - экспоненциальная задержка между попытками
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -3,75 +3,140 @@ package workeraccrual
 import (
 	"context"
 	"log/slog"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/mi4r/gophermart/internal/metrics"
 	"github.com/mi4r/gophermart/internal/storage"
 	storageaccrual "github.com/mi4r/gophermart/internal/storage/accrual"
 	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/internal/tracing"
+	"github.com/mi4r/gophermart/internal/worker"
+	"github.com/mi4r/gophermart/lib/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Думаю можно сделать пул воркеров
+// Worker считает начисления по задачам из общего канала. Воркеры объединяются в Pool
 type Worker struct {
-	ID      int           // ID воркера
-	TaskCh  chan Task     // Канал для получения задач
-	QuitCh  chan struct{} // Канал для завершения работы воркера
+	ID      int       // ID воркера
+	TaskCh  chan Task // Канал для получения задач
 	Storage storage.StorageAccrualSystem
+
+	ctx    context.Context    // Контекст текущей задачи
+	cancel context.CancelFunc // Прерывает текущую задачу, если не успели завершиться
+	quitCh chan struct{}      // Закрывается, чтобы воркер вышел, не дожидаясь закрытия канала задач
+	doneCh chan struct{}      // Закрывается после выхода из цикла
+	status worker.Tracker
 }
 
+// Модуль логов воркера для уровней из -lm
+const logModule = "worker"
+
 // NewWorker создает новый экземпляр воркера
 func NewWorker(id int, taskCh chan Task) *Worker {
+	ctx, cancel := context.WithCancel(logger.WithModule(context.Background(), logModule))
 	return &Worker{
 		ID:     id,
 		TaskCh: taskCh,
-		QuitCh: make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+		quitCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
 	}
 }
 
-// Start запускает воркера
+// Start запускает воркера. Воркер работает, пока открыт канал задач, не вызван Quit
+// и Stop не прервал его по истекшему ctx
 func (w *Worker) Start() {
+	w.status.SetRunning(true)
 	go func() {
+		defer close(w.doneCh)
+		defer w.status.SetRunning(false)
 		for {
+			var task Task
 			select {
-			case task := <-w.TaskCh:
-				// Выполнение задачи
-				if err := w.Execute(task); err != nil {
-					slog.Error(err.Error(), slog.Int("id", w.ID))
-				}
-				slog.Debug("worker executed", slog.Int("id", w.ID))
-			case <-w.QuitCh:
-				// Завершение работы воркера
-				slog.Debug("worker stopped", slog.Int("id", w.ID))
+			case <-w.quitCh:
+				slog.DebugContext(w.ctx, "worker stopped", slog.Int("id", w.ID))
 				return
+			case <-w.ctx.Done():
+				slog.DebugContext(w.ctx, "worker interrupted", slog.Int("id", w.ID))
+				return
+			case t, ok := <-w.TaskCh:
+				if !ok {
+					// Завершение работы воркера
+					slog.DebugContext(w.ctx, "worker stopped", slog.Int("id", w.ID))
+					return
+				}
+				task = t
 			}
+
+			metrics.WorkerQueueDepth.WithLabelValues(metrics.WorkerAccrual).Set(float64(len(w.TaskCh)))
+			// Выполнение задачи
+			start := time.Now()
+			err := w.Execute(w.ctx, task)
+			if err != nil {
+				slog.ErrorContext(task.Context(w.ctx), err.Error(), slog.Int("id", w.ID))
+				metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerAccrual, metrics.ResultFailure).Inc()
+			} else {
+				metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerAccrual, metrics.ResultSuccess).Inc()
+			}
+			metrics.WorkerTaskDuration.WithLabelValues(metrics.WorkerAccrual).Observe(time.Since(start).Seconds())
+			w.status.Done(err)
+			slog.DebugContext(w.ctx, "worker executed", slog.Int("id", w.ID))
 		}
 	}()
 }
 
-// Stop останавливает воркера
-func (w *Worker) Stop() {
-	w.Storage.Close()
-	go func() {
-		w.QuitCh <- struct{}{}
-	}()
+// Quit просит воркера выйти после текущей задачи. Оставшиеся задачи заберут другие воркеры
+func (w *Worker) Quit() {
+	close(w.quitCh)
 }
 
+// Stop ждет, пока воркер закончит текущую задачу.
+// Канал задач должен быть закрыт или вызван Quit до вызова Stop.
+// Если ctx истек раньше, текущая задача прерывается и воркер выходит, даже если канал открыт
+func (w *Worker) Stop(ctx context.Context) error {
+	select {
+	case <-w.doneCh:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.doneCh
+		return ctx.Err()
+	}
+}
+
+// Status возвращает состояние воркера и число задач в очереди
+func (w *Worker) Status() worker.Status {
+	status := w.status.Status()
+	status.QueueDepth = len(w.TaskCh)
+	return status
+}
+
+// SetStorage задает уже открытое хранилище. Закрывает его вызывающий
 func (w *Worker) SetStorage(storage storage.StorageAccrualSystem) {
 	w.Storage = storage
-	ctx := context.Background()
-	if err := w.Storage.Open(ctx); err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
-	}
 }
 
 func (w *Worker) AddTask(task Task) {
 	w.TaskCh <- task
 }
 
-func (w *Worker) Execute(task Task) error {
-	slog.Debug("worker calculating accrual...", slog.String("order", task.Order.Order))
-	ctx := context.Background()
+func (w *Worker) Execute(ctx context.Context, task Task) (err error) {
+	ctx, span := tracing.Tracer().Start(task.Context(ctx), "accrual.calculate",
+		trace.WithAttributes(attribute.String("order.number", task.Order.Order)),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	slog.DebugContext(ctx, "worker calculating accrual...")
 	if err := w.Storage.OrderRegUpdateStatus(ctx, storagedefault.StatusProcessing, task.Order.Order); err != nil {
 		return err
 	}
@@ -80,20 +145,22 @@ func (w *Worker) Execute(task Task) error {
 	if err != nil {
 		return err
 	}
-	slog.Debug("rewards", slog.Any("rewards", rewards))
+	slog.DebugContext(ctx, "rewards", slog.Any("rewards", rewards))
 
 	var accrual float64
 	for _, good := range task.Order.Goods {
 		for _, reward := range rewards {
 			var found bool
 			if strings.Contains(good.Description, reward.Match) {
-				slog.Debug("match one",
+				slog.DebugContext(ctx, "match one",
 					slog.String("description", good.Description),
 					slog.Float64("price", good.Price),
 					slog.Float64("reward", reward.Reward),
 					slog.String("type", string(reward.RewardType)),
 				)
 				accrual += calculateReward(good.Price, reward.Reward, reward.RewardType)
+				// Ключ совпадения задает клиент, в метку он не идет: число его значений не ограничено
+				metrics.AccrualRewardMatchesTotal.WithLabelValues(string(reward.RewardType)).Inc()
 				found = true
 			}
 			// Если найдено 1 совпадение, то не продолжаем поиск
@@ -113,12 +180,30 @@ func (w *Worker) Execute(task Task) error {
 		if err := w.Storage.OrderRegUpdateStatus(ctx, storagedefault.StatusInvalid, task.Order.Order); err != nil {
 			return err
 		}
+		order.Status = storagedefault.StatusInvalid
+		order.Accrual = 0
+		metrics.AccrualOrdersTotal.WithLabelValues(string(order.Status)).Inc()
+		w.notify(ctx, order)
 		return err
 	}
+	metrics.AccrualOrdersTotal.WithLabelValues(string(order.Status)).Inc()
+	w.notify(ctx, order)
 
 	return nil
 }
 
+// notify ставит в очередь вебхук о завершении расчета.
+// Ошибка не критична: подписчик все равно получит статус опросом
+func (w *Worker) notify(ctx context.Context, order storagedefault.Order) {
+	event := storagedefault.NewWebhookEvent(order)
+	if err := w.Storage.WebhookEventCreate(ctx, event); err != nil {
+		slog.WarnContext(ctx, "webhook event not created",
+			slog.String("event", event.ID),
+			slog.String("err", err.Error()),
+		)
+	}
+}
+
 func calculateReward(price, reward float64, rewardType storageaccrual.RewardType) float64 {
 	switch rewardType {
 	case storageaccrual.RewardTypePercent:
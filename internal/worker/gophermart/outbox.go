@@ -0,0 +1,173 @@
+package workermart
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/metrics"
+	"github.com/mi4r/gophermart/internal/outbox"
+	"github.com/mi4r/gophermart/internal/storage"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+	"github.com/mi4r/gophermart/internal/tracing"
+	"github.com/mi4r/gophermart/lib/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	outboxBatchSize   = 100
+	outboxBaseBackoff = time.Second
+	outboxMaxBackoff  = 5 * time.Minute
+	// Модуль логов relay для уровней из -lm
+	outboxLogModule = "outbox"
+)
+
+// OutboxRelay доставляет доменные события из outbox через Publisher.
+// Доставка "как минимум один раз": событие удаляется только после успешной публикации.
+// События уходят строго по порядку: при ошибке relay ждет и повторяет то же событие
+type OutboxRelay struct {
+	TickerCh  *time.Ticker
+	Storage   storage.StorageGophermart
+	Publisher outbox.Publisher
+
+	// Подряд идущие неудачи и время следующей попытки
+	failures int
+	retryAt  time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	quitCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewOutboxRelay создает relay доменных событий
+func NewOutboxRelay(tickerCh *time.Ticker, publisher outbox.Publisher) *OutboxRelay {
+	ctx, cancel := context.WithCancel(logger.WithModule(context.Background(), outboxLogModule))
+	return &OutboxRelay{
+		TickerCh:  tickerCh,
+		Publisher: publisher,
+		ctx:       ctx,
+		cancel:    cancel,
+		quitCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+func (r *OutboxRelay) SetStorage(storage storage.StorageGophermart) {
+	r.Storage = storage
+}
+
+// Start запускает доставку событий по тикеру
+func (r *OutboxRelay) Start() {
+	go func() {
+		defer close(r.doneCh)
+		for {
+			select {
+			case <-r.TickerCh.C:
+				if time.Now().Before(r.retryAt) {
+					continue
+				}
+				if err := r.Execute(r.ctx); err != nil {
+					slog.ErrorContext(r.ctx, "outbox relay error", slog.String("err", err.Error()))
+				}
+			case <-r.quitCh:
+				slog.DebugContext(r.ctx, "outbox relay stopped")
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает relay и ждет завершения текущей пачки, затем закрывает Publisher.
+// Если ctx истек раньше, доставка прерывается: неотправленное уйдет после рестарта
+func (r *OutboxRelay) Stop(ctx context.Context) error {
+	r.TickerCh.Stop()
+	close(r.quitCh)
+
+	var err error
+	select {
+	case <-r.doneCh:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.doneCh
+		err = ctx.Err()
+	}
+	if closeErr := r.Publisher.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Execute публикует накопившиеся события, пока они есть.
+// На первой ошибке останавливается, чтобы не нарушить порядок
+func (r *OutboxRelay) Execute(ctx context.Context) error {
+	for {
+		events, err := r.Storage.OutboxReadPending(ctx, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+		metrics.WorkerQueueDepth.WithLabelValues(metrics.WorkerOutbox).Set(float64(len(events)))
+
+		for _, event := range events {
+			pubErr := r.publish(ctx, event)
+			if pubErr != nil {
+				metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerOutbox, metrics.ResultFailure).Inc()
+				r.failures++
+				r.retryAt = time.Now().Add(outboxBackoff(r.failures))
+				slog.WarnContext(ctx, "outbox event publish failed",
+					slog.String("event", event.ID),
+					slog.String("type", event.Type),
+					slog.Int("attempt", event.Attempts+1),
+					slog.Time("retry_at", r.retryAt),
+					slog.String("err", pubErr.Error()),
+				)
+				return r.Storage.OutboxFailed(ctx, event.Seq, pubErr.Error())
+			}
+
+			metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerOutbox, metrics.ResultSuccess).Inc()
+			r.failures = 0
+			// Если удалить не вышло, событие уйдет повторно - получатель уберет дубль по id
+			if err := r.Storage.OutboxDone(ctx, event.Seq); err != nil {
+				return err
+			}
+			slog.DebugContext(ctx, "outbox event published",
+				slog.String("event", event.ID),
+				slog.String("type", event.Type),
+			)
+		}
+		if len(events) < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+// publish отправляет событие в отдельном спане
+func (r *OutboxRelay) publish(ctx context.Context, event storagemart.OutboxEvent) error {
+	ctx, span := tracing.Tracer().Start(ctx, "outbox.publish", trace.WithAttributes(
+		attribute.String("outbox.event_id", event.ID),
+		attribute.String("outbox.type", event.Type),
+		attribute.Int("outbox.attempt", event.Attempts+1),
+	))
+	defer span.End()
+
+	err := r.Publisher.Publish(ctx, event)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// outboxBackoff - экспоненциальная задержка после подряд идущих неудач
+func outboxBackoff(failures int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return backoff
+}
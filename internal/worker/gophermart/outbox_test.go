@@ -0,0 +1,121 @@
+package workermart
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mi4r/gophermart/internal/storage"
+	storagemart "github.com/mi4r/gophermart/internal/storage/gophermart"
+)
+
+// memOutbox - outbox в памяти. Нереализованные методы паникуют
+type memOutbox struct {
+	storage.StorageGophermart
+
+	mu     sync.Mutex
+	events []storagemart.OutboxEvent
+}
+
+func (m *memOutbox) OutboxReadPending(ctx context.Context, limit int) ([]storagemart.OutboxEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) < limit {
+		limit = len(m.events)
+	}
+	return append([]storagemart.OutboxEvent(nil), m.events[:limit]...), nil
+}
+
+func (m *memOutbox) OutboxDone(ctx context.Context, seq int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, e := range m.events {
+		if e.Seq == seq {
+			m.events = append(m.events[:i], m.events[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memOutbox) OutboxFailed(ctx context.Context, seq int64, lastErr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.events {
+		if m.events[i].Seq == seq {
+			m.events[i].Attempts++
+		}
+	}
+	return nil
+}
+
+// flakyPublisher не доставляет события из failOn, пока их не уберут из карты
+type flakyPublisher struct {
+	failOn    map[string]bool
+	published []string
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event storagemart.OutboxEvent) error {
+	if p.failOn[event.ID] {
+		return errors.New("receiver is down")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func (p *flakyPublisher) Close() error { return nil }
+
+func TestOutboxRelay_Execute(t *testing.T) {
+	st := &memOutbox{}
+	for i, id := range []string{"a", "b", "c"} {
+		st.events = append(st.events, storagemart.OutboxEvent{Seq: int64(i + 1), ID: id, Type: storagemart.OutboxOrderUploaded})
+	}
+	pub := &flakyPublisher{failOn: map[string]bool{"b": true}}
+	r := NewOutboxRelay(time.NewTicker(time.Hour), pub)
+	r.SetStorage(st)
+
+	// Ошибка на b останавливает пачку: c не уходит раньше b
+	if err := r.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(pub.published) != 1 || pub.published[0] != "a" {
+		t.Fatalf("published = %v, want [a]", pub.published)
+	}
+	if len(st.events) != 2 || st.events[0].Attempts != 1 {
+		t.Fatalf("outbox = %+v, want b with one attempt and c", st.events)
+	}
+	if r.failures != 1 || !r.retryAt.After(time.Now()) {
+		t.Errorf("failures = %d, retryAt = %v, want backoff", r.failures, r.retryAt)
+	}
+
+	// Получатель ожил - уходят b и c с теми же id
+	delete(pub.failOn, "b")
+	if err := r.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; len(pub.published) != 3 || pub.published[1] != "b" || pub.published[2] != "c" {
+		t.Errorf("published = %v, want %v", pub.published, want)
+	}
+	if len(st.events) != 0 || r.failures != 0 {
+		t.Errorf("outbox = %+v, failures = %d, want empty", st.events, r.failures)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{20, outboxMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.failures); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -2,113 +2,317 @@ package workermart
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"log/slog"
-	"net/http"
-	"os"
 	"time"
 
+	"github.com/google/uuid"
+	clientaccrual "github.com/mi4r/gophermart/internal/client/accrual"
+	"github.com/mi4r/gophermart/internal/metrics"
 	"github.com/mi4r/gophermart/internal/storage"
 	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/internal/tracing"
+	"github.com/mi4r/gophermart/internal/worker"
+	"github.com/mi4r/gophermart/lib/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Worker struct {
-	ID             int          // ID воркера
-	TickerCh       *time.Ticker // Канал для получения задач
-	AccrualAddress string
-	Storage        storage.StorageGophermart
+	ID       int          // ID воркера
+	TickerCh *time.Ticker // Канал для получения задач
+	Accrual  *clientaccrual.Client
+	Storage  storage.StorageGophermart
+	// Сколько хранить события пользователей, 0 - не удалять
+	EventsRetention time.Duration
+	// Сколько хранить недоставленные события outbox, 0 - не удалять
+	OutboxRetention time.Duration
+	// Пересчет уровней лояльности: по какой сумме, за какой период и как часто. 0 - не пересчитывать
+	TierBasis    string
+	TierWindow   time.Duration
+	TierInterval time.Duration
+	tiersDueAt   time.Time
+
+	ctx    context.Context    // Контекст текущей задачи
+	cancel context.CancelFunc // Прерывает текущую задачу, если не успели завершиться
+	quitCh chan struct{}      // Канал для завершения работы воркера
+	doneCh chan struct{}      // Закрывается после выхода из цикла
+	status worker.Tracker
 }
 
+// Модуль логов воркера для уровней из -lm
+const logModule = "worker"
+
 // NewWorker создает новый экземпляр воркера
-func NewWorker(id int, tickerCh *time.Ticker, accrualAddress string) *Worker {
+func NewWorker(id int, tickerCh *time.Ticker, accrual *clientaccrual.Client) *Worker {
+	ctx, cancel := context.WithCancel(logger.WithModule(context.Background(), logModule))
 	return &Worker{
-		ID:             id,
-		TickerCh:       tickerCh,
-		AccrualAddress: accrualAddress,
+		ID:       id,
+		TickerCh: tickerCh,
+		Accrual:  accrual,
+		ctx:      ctx,
+		cancel:   cancel,
+		quitCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
 	}
 }
 
-// Start запускает воркера
+// Start запускает воркера и блокируется до вызова Stop
 func (w *Worker) Start() {
-	slog.Debug("start timer")
-	for range w.TickerCh.C {
-		slog.Debug("start worker")
-		w.Execute()
+	w.status.SetRunning(true)
+	defer close(w.doneCh)
+	defer w.status.SetRunning(false)
+	slog.DebugContext(w.ctx, "start timer")
+	for {
+		select {
+		case <-w.quitCh:
+			slog.DebugContext(w.ctx, "worker stopped", slog.Int("id", w.ID))
+			return
+		case <-w.TickerCh.C:
+			slog.DebugContext(w.ctx, "start worker")
+			start := time.Now()
+			// Свой X-Request-ID на каждый проход, чтобы связать логи с запросами в Accrual System
+			ctx := logger.WithRequestID(w.ctx, uuid.NewString())
+			w.expireReservations(ctx)
+			w.expirePoints(ctx)
+			w.recalcTiers(ctx)
+			w.pruneEvents(ctx)
+			w.pruneOutbox(ctx)
+			err := w.Execute(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, err.Error(), slog.Int("id", w.ID))
+				metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerGophermart, metrics.ResultFailure).Inc()
+			} else {
+				metrics.WorkerTasksTotal.WithLabelValues(metrics.WorkerGophermart, metrics.ResultSuccess).Inc()
+			}
+			metrics.WorkerTaskDuration.WithLabelValues(metrics.WorkerGophermart).Observe(time.Since(start).Seconds())
+			w.status.Done(err)
+		}
 	}
 }
 
-// Stop останавливает воркера
-func (w *Worker) Stop() {
-	w.Storage.Close()
+// Stop останавливает тикер и ждет, пока воркер закончит текущий проход.
+// Если ctx истек раньше, текущий проход прерывается: незавершенные транзакции откатываются
+func (w *Worker) Stop(ctx context.Context) error {
 	w.TickerCh.Stop()
+	close(w.quitCh)
+
+	select {
+	case <-w.doneCh:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.doneCh
+		return ctx.Err()
+	}
+}
+
+// SetInterval меняет период опроса на лету
+func (w *Worker) SetInterval(d time.Duration) {
+	w.TickerCh.Reset(d)
+}
+
+// Status возвращает состояние воркера для readiness проверки
+func (w *Worker) Status() worker.Status {
+	return w.status.Status()
 }
 
+// SetStorage задает уже открытое хранилище. Закрывает его вызывающий
 func (w *Worker) SetStorage(storage storage.StorageGophermart) {
 	w.Storage = storage
-	ctx := context.Background()
-	if err := w.Storage.Open(ctx); err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
+}
+
+// expireReservations снимает просроченные резервы баллов. Ошибка не мешает опросу заказов
+func (w *Worker) expireReservations(ctx context.Context) {
+	count, err := w.Storage.WithdrawalsExpire(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "expire reservations error", slog.String("err", err.Error()))
+		return
+	}
+	if count != 0 {
+		slog.InfoContext(ctx, "withdrawal reservations expired", slog.Int("count", count))
+	}
+}
+
+// Сколько партий баллов сжигать за один запрос
+const expireBatchSize = 1000
+
+// expirePoints сжигает партии баллов с истекшим сроком. Ошибка не мешает опросу заказов
+func (w *Worker) expirePoints(ctx context.Context) {
+	total := 0
+	for {
+		count, err := w.Storage.PointsExpire(ctx, expireBatchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "expire points error", slog.String("err", err.Error()))
+			break
+		}
+		total += count
+		if count < expireBatchSize {
+			break
+		}
+	}
+	if total != 0 {
+		slog.InfoContext(ctx, "points lots expired", slog.Int("count", total))
+	}
+}
+
+// recalcTiers пересчитывает уровни лояльности раз в TierInterval.
+// После ошибки повторяет на следующем тике
+func (w *Worker) recalcTiers(ctx context.Context) {
+	if w.TierInterval <= 0 || time.Now().Before(w.tiersDueAt) {
+		return
+	}
+	changed, err := w.Storage.TiersRecalculate(ctx, w.TierBasis, w.TierWindow)
+	if err != nil {
+		slog.ErrorContext(ctx, "recalculate tiers error", slog.String("err", err.Error()))
+		return
+	}
+	w.tiersDueAt = time.Now().Add(w.TierInterval)
+	if changed != 0 {
+		slog.InfoContext(ctx, "user tiers changed", slog.Int("count", changed))
+	}
+}
+
+// pruneEvents удаляет события пользователей старше EventsRetention
+func (w *Worker) pruneEvents(ctx context.Context) {
+	if w.EventsRetention <= 0 {
+		return
+	}
+	count, err := w.Storage.UserEventsDeleteOlder(ctx, w.EventsRetention)
+	if err != nil {
+		slog.ErrorContext(ctx, "prune user events error", slog.String("err", err.Error()))
+		return
+	}
+	if count != 0 {
+		slog.DebugContext(ctx, "user events pruned", slog.Int64("count", count))
 	}
 }
 
-func (w *Worker) Execute() error {
-	ctx := context.Background()
+// pruneOutbox удаляет события outbox старше OutboxRetention
+func (w *Worker) pruneOutbox(ctx context.Context) {
+	if w.OutboxRetention <= 0 {
+		return
+	}
+	count, err := w.Storage.OutboxDeleteOlder(ctx, w.OutboxRetention)
+	if err != nil {
+		slog.ErrorContext(ctx, "prune outbox error", slog.String("err", err.Error()))
+		return
+	}
+	if count != 0 {
+		slog.DebugContext(ctx, "outbox events pruned", slog.Int64("count", count))
+	}
+}
+
+func (w *Worker) Execute(ctx context.Context) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "gophermart.poll")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	orderNumbers, err := w.Storage.UserOrderReadAllNumbers(ctx)
 	if err != nil {
 		return err
 	}
 
-	slog.Debug("fetch orders", slog.Any("orders", orderNumbers))
+	slog.DebugContext(ctx, "fetch orders", slog.Any("orders", orderNumbers))
+	metrics.WorkerQueueDepth.WithLabelValues(metrics.WorkerGophermart).Set(float64(len(orderNumbers)))
+	span.SetAttributes(attribute.Int("orders.pending", len(orderNumbers)))
 
 	if len(orderNumbers) == 0 {
 		return nil
 	}
 
 	var orders []storagedefault.Order
+	var fetchErr error
 
+	// Статус заказа меняется только по ответу Accrual System.
+	// Если сервис недоступен или предохранитель разомкнут, заказы не трогаем
 	for _, num := range orderNumbers {
-		err = w.Storage.UserOrderUpdateStatus(ctx, num, storagedefault.StatusProcessing)
+		orderCtx := logger.WithOrder(ctx, num)
+		order, err := w.fetchOrder(orderCtx, num)
+		if errors.Is(err, clientaccrual.ErrOrderNotFound) {
+			// Accrual System еще не знает о заказе - спросим на следующем тике
+			slog.DebugContext(orderCtx, "order not registered in accrual")
+			if err := w.Storage.UserOrderUpdateStatus(orderCtx, num, storagedefault.StatusProcessing); err != nil {
+				return err
+			}
+			continue
+		}
 		if err != nil {
-			return err
+			fetchErr = err
+			break
 		}
+		// У gophermart нет статуса REGISTERED
+		if order.Status == storagedefault.StatusRegistered {
+			order.Status = storagedefault.StatusProcessing
+		}
+		orders = append(orders, order)
+	}
 
-		address := fmt.Sprintf("%s/api/orders/%s", w.AccrualAddress, num)
-		slog.Debug("fetch data from accrual", slog.String("address", address))
-		resp, err := http.Get(address)
-		if err != nil {
+	// Сохраняем то, что успели получить до ошибки
+	if len(orders) != 0 {
+		if err := w.Storage.UserOrderUpdateAll(ctx, orders); err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusTooManyRequests {
-			// Забираем значение Retry-After из заголовка
-			retryAfterHeader := resp.Header.Get("Retry-After")
-			retryAfter, err := time.ParseDuration(retryAfterHeader + "s")
-			if err != nil {
-				slog.Error("parse retry-after header error", slog.String("err", err.Error()))
-				return err
+	}
+	if errors.Is(fetchErr, clientaccrual.ErrCircuitOpen) {
+		slog.WarnContext(ctx, "accrual circuit breaker is open, skip polling")
+		return nil
+	}
+	return fetchErr
+}
+
+// Сколько раз запрашивать заказ, если Accrual System отвечает 429
+const fetchOrderMaxAttempts = 3
+
+// fetchOrder запрашивает заказ в Accrual System.
+// При 429 ждет Retry-After и повторяет запрос, но не более fetchOrderMaxAttempts раз
+func (w *Worker) fetchOrder(ctx context.Context, num string) (storagedefault.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "gophermart.fetch_order",
+		trace.WithAttributes(attribute.String("order.number", num)),
+	)
+	defer span.End()
+
+	for attempt := 1; ; attempt++ {
+		order, err := w.Accrual.GetOrder(ctx, num)
+		var rateErr *clientaccrual.RateLimitError
+		if errors.As(err, &rateErr) && attempt < fetchOrderMaxAttempts {
+			slog.DebugContext(ctx, "retry after", slog.Duration("retryAfter", rateErr.RetryAfter))
+			span.AddEvent("rate limited")
+			timer := time.NewTimer(rateErr.RetryAfter)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return storagedefault.Order{}, ctx.Err()
+			case <-timer.C:
 			}
-			slog.Debug("retry after", slog.Duration("retryAfter", retryAfter))
-			time.Sleep(retryAfter)
-			return nil
+			continue
 		}
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		slog.Debug("response body from accrual", slog.String("respBody", string(respBody)))
-		var order storagedefault.Order
-		err = json.Unmarshal(respBody, &order)
-		if err != nil {
-			return err
+		if err != nil && !errors.Is(err, clientaccrual.ErrOrderNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if err == nil {
+			span.SetAttributes(attribute.String("order.status", string(order.Status)))
 		}
-		orders = append(orders, order)
+		return order, err
 	}
-	err = w.Storage.UserOrderUpdateAll(ctx, orders)
+}
+
+// Subscribe подписывает gophermart на вебхуки Accrual System.
+// Опрос по тикеру при этом продолжает работать как запасной вариант
+func (w *Worker) Subscribe(ctx context.Context, callbackURL, secret string) error {
+	webhook, err := w.Accrual.Subscribe(ctx, callbackURL, secret)
 	if err != nil {
 		return err
 	}
+	slog.Debug("subscribed to accrual webhooks",
+		slog.Int64("id", webhook.ID),
+		slog.String("url", webhook.URL),
+	)
 	return nil
 }
@@ -0,0 +1,207 @@
+package workermart
+
+import (
+	"context"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	clientaccrual "github.com/mi4r/gophermart/internal/client/accrual"
+	"github.com/mi4r/gophermart/internal/fakeaccrual"
+	"github.com/mi4r/gophermart/internal/storage"
+	storagedefault "github.com/mi4r/gophermart/internal/storage/default"
+	"github.com/mi4r/gophermart/lib/breaker"
+	"github.com/mi4r/gophermart/lib/ratelimit"
+	"golang.org/x/time/rate"
+)
+
+// memStorage - хранилище заказов в памяти. Нереализованные методы паникуют
+type memStorage struct {
+	storage.StorageGophermart
+
+	mu       sync.Mutex
+	orders   map[string]storagedefault.Order
+	balances map[string]float64
+}
+
+func newMemStorage(numbers ...string) *memStorage {
+	m := &memStorage{
+		orders:   make(map[string]storagedefault.Order),
+		balances: make(map[string]float64),
+	}
+	for _, num := range numbers {
+		m.orders[num] = storagedefault.Order{Number: num, Status: storagedefault.StatusNew}
+	}
+	return m
+}
+
+func (m *memStorage) UserOrderReadAllNumbers(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var numbers []string
+	for num, o := range m.orders {
+		if !o.Status.IsFinal() {
+			numbers = append(numbers, num)
+		}
+	}
+	sort.Strings(numbers)
+	return numbers, nil
+}
+
+func (m *memStorage) UserOrderUpdateStatus(ctx context.Context, number string, status storagedefault.OrderStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o := m.orders[number]
+	o.Status = status
+	m.orders[number] = o
+	return nil
+}
+
+func (m *memStorage) UserOrderUpdateAll(ctx context.Context, orders []storagedefault.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range orders {
+		if m.orders[o.Number].Status.IsFinal() {
+			continue
+		}
+		m.orders[o.Number] = o
+		m.balances[o.Number] += o.Accrual
+	}
+	return nil
+}
+
+func newTestWorker(t *testing.T, fake *fakeaccrual.Fake, st *memStorage, opts ...clientaccrual.Option) *Worker {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	limiter := ratelimit.NewBucket(rate.Inf, 1)
+	opts = append(opts,
+		clientaccrual.WithLimiter(limiter),
+		clientaccrual.WithTimeout(time.Second),
+	)
+	accrual := clientaccrual.New(srv.URL, opts...)
+	w := NewWorker(1, time.NewTicker(time.Hour), accrual)
+	w.Storage = st
+	return w
+}
+
+func TestWorker_Execute(t *testing.T) {
+	fake := fakeaccrual.New()
+	fake.Script("12345678903", fakeaccrual.Processed(500))
+	fake.Script("79927398713", fakeaccrual.TooManyRequests("1"), fakeaccrual.Processed(100))
+	fake.Script("2377225624", fakeaccrual.Invalid())
+	fake.Script("4561261212345467", fakeaccrual.Processing().WithDelay(10*time.Millisecond))
+
+	st := newMemStorage("12345678903", "79927398713", "2377225624", "4561261212345467", "49927398716")
+	w := newTestWorker(t, fake, st)
+
+	if err := w.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	tests := []struct {
+		number  string
+		status  storagedefault.OrderStatus
+		balance float64
+	}{
+		{number: "12345678903", status: storagedefault.StatusProcessed, balance: 500},
+		{number: "79927398713", status: storagedefault.StatusProcessed, balance: 100},
+		{number: "2377225624", status: storagedefault.StatusInvalid},
+		{number: "4561261212345467", status: storagedefault.StatusProcessing},
+		// Не зарегистрирован в Accrual System
+		{number: "49927398716", status: storagedefault.StatusProcessing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			if got := st.orders[tt.number].Status; got != tt.status {
+				t.Errorf("status = %s, want %s", got, tt.status)
+			}
+			if got := st.balances[tt.number]; got != tt.balance {
+				t.Errorf("balance = %v, want %v", got, tt.balance)
+			}
+		})
+	}
+
+	if got := fake.Requests("79927398713"); got != 2 {
+		t.Errorf("requests after 429 = %d, want 2", got)
+	}
+
+	// Повторный проход не начисляет баллы второй раз
+	if err := w.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := st.balances["12345678903"]; got != 500 {
+		t.Errorf("balance after second run = %v, want 500", got)
+	}
+}
+
+func TestWorker_ExecuteAccrualErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response fakeaccrual.Response
+	}{
+		{name: "server_error", response: fakeaccrual.ServerError()},
+		{name: "malformed_body", response: fakeaccrual.Malformed()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeaccrual.New()
+			fake.Script("12345678903", tt.response)
+			st := newMemStorage("12345678903")
+			w := newTestWorker(t, fake, st)
+
+			if err := w.Execute(context.Background()); err == nil {
+				t.Error("Execute() error = nil, want error")
+			}
+			if got := st.balances["12345678903"]; got != 0 {
+				t.Errorf("balance = %v, want 0", got)
+			}
+		})
+	}
+}
+
+func TestWorker_ExecuteRateLimitAttempts(t *testing.T) {
+	fake := fakeaccrual.New()
+	fake.SetDefault(fakeaccrual.TooManyRequests("0"))
+	st := newMemStorage("12345678903")
+	w := newTestWorker(t, fake, st)
+
+	if err := w.Execute(context.Background()); err == nil {
+		t.Fatal("Execute() error = nil, want rate limit error")
+	}
+	if got := fake.Requests("12345678903"); got != fetchOrderMaxAttempts {
+		t.Errorf("requests = %d, want %d", got, fetchOrderMaxAttempts)
+	}
+}
+
+func TestWorker_ExecuteBreakerOpen(t *testing.T) {
+	fake := fakeaccrual.New()
+	fake.Script("12345678903", fakeaccrual.ServerError())
+	fake.Script("79927398713", fakeaccrual.Processed(100))
+	st := newMemStorage("12345678903", "79927398713")
+	b := breaker.New(1, time.Hour)
+	w := newTestWorker(t, fake, st, clientaccrual.WithBreaker(b))
+
+	if err := w.Execute(context.Background()); err == nil {
+		t.Fatal("Execute() error = nil, want server error")
+	}
+	if got := b.State(); got != breaker.StateOpen {
+		t.Fatalf("breaker state = %s, want %s", got, breaker.StateOpen)
+	}
+
+	// Пока предохранитель разомкнут, Accrual System не вызывается и статусы не меняются
+	if err := w.Execute(context.Background()); err != nil {
+		t.Fatalf("Execute() with open breaker error = %v", err)
+	}
+	if got := fake.Requests("12345678903") + fake.Requests("79927398713"); got != 1 {
+		t.Errorf("accrual requests = %d, want 1", got)
+	}
+	for num, o := range st.orders {
+		if o.Status != storagedefault.StatusNew {
+			t.Errorf("order %s status = %s, want %s", num, o.Status, storagedefault.StatusNew)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// Status - состояние фонового воркера для readiness проверки
+type Status struct {
+	Running    bool       `json:"running"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	QueueDepth int        `json:"queue_depth"`
+	// Число воркеров в пуле, если воркер работает пулом
+	Workers int `json:"workers,omitempty"`
+}
+
+// Tracker потокобезопасно хранит состояние воркера
+type Tracker struct {
+	mu        sync.Mutex
+	running   bool
+	lastRunAt time.Time
+	lastErr   error
+}
+
+func (t *Tracker) SetRunning(running bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running = running
+}
+
+// Done фиксирует завершение очередного прохода или задачи
+func (t *Tracker) Done(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastRunAt = time.Now()
+	t.lastErr = err
+}
+
+// Status возвращает состояние. Глубину очереди воркер заполняет сам
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Status{Running: t.running}
+	if !t.lastRunAt.IsZero() {
+		lastRunAt := t.lastRunAt
+		s.LastRunAt = &lastRunAt
+	}
+	if t.lastErr != nil {
+		s.LastError = t.lastErr.Error()
+	}
+	return s
+}
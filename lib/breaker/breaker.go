@@ -0,0 +1,156 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+var (
+	ErrOpen = errors.New("circuit breaker is open")
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Snapshot - состояние предохранителя для отображения в health
+type Snapshot struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	Threshold int        `json:"threshold"`
+	Cooldown  string     `json:"cooldown"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+}
+
+// Breaker - предохранитель вызовов внешнего сервиса.
+// После threshold ошибок подряд размыкается на cooldown,
+// затем пропускает один пробный вызов (half-open):
+// успех замыкает цепь, ошибка снова размыкает.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New создает замкнутый предохранитель
+func New(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow проверяет, можно ли сейчас выполнить вызов.
+// В состоянии half-open разрешен только один пробный вызов одновременно
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Success фиксирует успешный вызов
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure фиксирует неудачный вызов
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Release отменяет пробный вызов, результат которого не известен
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State возвращает текущее состояние с учетом истекшего cooldown
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := Snapshot{
+		State:     b.currentState().String(),
+		Failures:  b.failures,
+		Threshold: b.threshold,
+		Cooldown:  b.cooldown.String(),
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
+
+// currentState вызывается под мьютексом
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
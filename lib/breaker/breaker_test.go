@@ -0,0 +1,57 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := New(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("closed breaker: Allow() = %v", err)
+	}
+	b.Failure()
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("after 1 failure state = %s, want %s", got, StateClosed)
+	}
+	b.Failure()
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("after 2 failures state = %s, want %s", got, StateOpen)
+	}
+	if err := b.Allow(); err != ErrOpen {
+		t.Fatalf("open breaker: Allow() = %v, want %v", err, ErrOpen)
+	}
+
+	// Cooldown прошел - пропускаем только один пробный вызов
+	now = now.Add(time.Minute)
+	if got := b.State(); got != StateHalfOpen {
+		t.Fatalf("after cooldown state = %s, want %s", got, StateHalfOpen)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("half-open: first Allow() = %v", err)
+	}
+	if err := b.Allow(); err != ErrOpen {
+		t.Fatalf("half-open: second Allow() = %v, want %v", err, ErrOpen)
+	}
+
+	// Пробный вызов неудачен - снова разомкнут
+	b.Failure()
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("failed probe: state = %s, want %s", got, StateOpen)
+	}
+
+	now = now.Add(time.Minute)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("half-open: Allow() = %v", err)
+	}
+	b.Success()
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("successful probe: state = %s, want %s", got, StateClosed)
+	}
+	if s := b.Snapshot(); s.Failures != 0 || s.OpenedAt != nil {
+		t.Errorf("closed snapshot = %+v", s)
+	}
+}
@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Ключи атрибутов корреляции
+const (
+	KeyRequestID = "request_id"
+	KeyLogin     = "login"
+	KeyOrder     = "order"
+)
+
+type ctxKey struct{}
+
+// WithAttrs добавляет атрибуты в контекст. ContextHandler допишет их
+// в каждую запись, залогированную с этим контекстом
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	parent := attrsFromContext(ctx)
+	merged := make([]slog.Attr, 0, len(parent)+len(attrs))
+	// Новое значение ключа заменяет старое
+	for _, a := range parent {
+		if !hasKey(attrs, a.Key) {
+			merged = append(merged, a)
+		}
+	}
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+// WithRequestID добавляет в контекст идентификатор запроса
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return WithAttrs(ctx, slog.String(KeyRequestID, id))
+}
+
+// WithLogin добавляет в контекст логин пользователя
+func WithLogin(ctx context.Context, login string) context.Context {
+	if login == "" {
+		return ctx
+	}
+	return WithAttrs(ctx, slog.String(KeyLogin, login))
+}
+
+// WithOrder добавляет в контекст номер заказа
+func WithOrder(ctx context.Context, number string) context.Context {
+	if number == "" {
+		return ctx
+	}
+	return WithAttrs(ctx, slog.String(KeyOrder, number))
+}
+
+// RequestID возвращает идентификатор запроса из контекста
+func RequestID(ctx context.Context) string {
+	for _, a := range attrsFromContext(ctx) {
+		if a.Key == KeyRequestID {
+			return a.Value.String()
+		}
+	}
+	return ""
+}
+
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ContextHandler дописывает в запись атрибуты из контекста
+type ContextHandler struct {
+	slog.Handler
+}
+
+func NewContextHandler(h slog.Handler) *ContextHandler {
+	return &ContextHandler{Handler: h}
+}
+
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := attrsFromContext(ctx); len(attrs) != 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{Handler: h.Handler.WithGroup(name)}
+}
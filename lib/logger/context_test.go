@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil)))
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = WithLogin(ctx, "user")
+	ctx = WithOrder(ctx, "12345678903")
+	// Повторный ключ заменяет старое значение
+	ctx = WithOrder(ctx, "79927398713")
+
+	log.InfoContext(ctx, "msg", slog.String("k", "v"))
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	want := map[string]string{
+		KeyRequestID: "req-1",
+		KeyLogin:     "user",
+		KeyOrder:     "79927398713",
+		"k":          "v",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if id := RequestID(ctx); id != "req-1" {
+		t.Errorf("RequestID() = %q", id)
+	}
+}
+
+func TestContextHandler_NoAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil)))
+
+	log.InfoContext(context.Background(), "msg")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := got[KeyRequestID]; ok {
+		t.Errorf("unexpected %s", KeyRequestID)
+	}
+	if id := RequestID(context.Background()); id != "" {
+		t.Errorf("RequestID() = %q", id)
+	}
+}
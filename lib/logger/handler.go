@@ -6,6 +6,8 @@ import (
 	"io"
 	"log"
 	"log/slog"
+	"maps"
+	"sync"
 
 	"github.com/fatih/color"
 )
@@ -14,29 +16,42 @@ type PrettyHandlerOptions struct {
 	SlogOpts slog.HandlerOptions
 }
 
+// PrettyHandler пишет цветной текст для локальной разработки.
+// Атрибуты логгера и группы хранятся в самом обработчике
 type PrettyHandler struct {
-	slog.Handler
-	l *log.Logger
+	opts   slog.HandlerOptions
+	l      *log.Logger
+	mu     *sync.Mutex
+	fields map[string]any // атрибуты из WithAttrs
+	groups []string       // открытые группы из WithGroup
+}
+
+func (h *PrettyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
 }
 
 func (h *PrettyHandler) Handle(ctx context.Context, r slog.Record) error {
 	level := r.Level.String() + ":"
 
-	switch r.Level {
-	case slog.LevelDebug:
+	switch {
+	case r.Level < slog.LevelInfo:
 		level = color.MagentaString(level)
-	case slog.LevelInfo:
+	case r.Level < slog.LevelWarn:
 		level = color.BlueString(level)
-	case slog.LevelWarn:
+	case r.Level < slog.LevelError:
 		level = color.YellowString(level)
-	case slog.LevelError:
+	default:
 		level = color.RedString(level)
 	}
 
-	fields := make(map[string]interface{}, r.NumAttrs())
+	fields := cloneFields(h.fields)
+	target := groupFields(fields, h.groups)
 	r.Attrs(func(a slog.Attr) bool {
-		fields[a.Key] = a.Value.Any()
-
+		addAttr(target, a)
 		return true
 	})
 
@@ -45,21 +60,105 @@ func (h *PrettyHandler) Handle(ctx context.Context, r slog.Record) error {
 		return err
 	}
 
-	timeStr := r.Time.Format("[15:05:05.000]")
+	timeStr := r.Time.Format("[15:04:05.000]")
 	msg := color.CyanString(r.Message)
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.l.Println(timeStr, level, msg, color.WhiteString(string(b)))
 
 	return nil
 }
 
+func (h *PrettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	target := groupFields(h2.fields, h2.groups)
+	for _, a := range attrs {
+		addAttr(target, a)
+	}
+	return h2
+}
+
+func (h *PrettyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	return h2
+}
+
+func (h *PrettyHandler) clone() *PrettyHandler {
+	return &PrettyHandler{
+		opts:   h.opts,
+		l:      h.l,
+		mu:     h.mu,
+		fields: cloneFields(h.fields),
+		groups: append([]string(nil), h.groups...),
+	}
+}
+
+// groupFields возвращает вложенную карту для открытых групп, создавая ее при необходимости
+func groupFields(fields map[string]any, groups []string) map[string]any {
+	for _, g := range groups {
+		sub, ok := fields[g].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			fields[g] = sub
+		}
+		fields = sub
+	}
+	return fields
+}
+
+func addAttr(fields map[string]any, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		fields[a.Key] = a.Value.Any()
+		return
+	}
+	attrs := a.Value.Group()
+	if len(attrs) == 0 {
+		return
+	}
+	// Группа без имени раскрывается на текущий уровень
+	target := fields
+	if a.Key != "" {
+		target = groupFields(fields, []string{a.Key})
+	}
+	for _, ga := range attrs {
+		addAttr(target, ga)
+	}
+}
+
+func cloneFields(fields map[string]any) map[string]any {
+	out := maps.Clone(fields)
+	if out == nil {
+		return make(map[string]any)
+	}
+	for k, v := range out {
+		if sub, ok := v.(map[string]any); ok {
+			out[k] = cloneFields(sub)
+		}
+	}
+	return out
+}
+
 func newPrettyHandler(
 	out io.Writer,
 	opts PrettyHandlerOptions,
 ) *PrettyHandler {
 	h := &PrettyHandler{
-		Handler: slog.NewJSONHandler(out, &opts.SlogOpts),
-		l:       log.New(out, "", 0),
+		opts:   opts.SlogOpts,
+		l:      log.New(out, "", 0),
+		mu:     &sync.Mutex{},
+		fields: make(map[string]any),
 	}
 
 	return h
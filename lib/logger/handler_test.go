@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrettyHandler_WithAttrsAndGroup(t *testing.T) {
+	var buf bytes.Buffer
+	h := newPrettyHandler(&buf, PrettyHandlerOptions{SlogOpts: slog.HandlerOptions{Level: slog.LevelDebug}})
+	log := slog.New(h).With(slog.String("service", "gophermart")).WithGroup("req")
+
+	log.Debug("msg", slog.Int("status", 200))
+
+	out := buf.String()
+	start := strings.Index(out, "{")
+	if start < 0 {
+		t.Fatalf("no fields in %q", out)
+	}
+	var got map[string]any
+	if err := json.Unmarshal([]byte(stripColor(out[start:])), &got); err != nil {
+		t.Fatalf("unmarshal %q: %v", out[start:], err)
+	}
+	if got["service"] != "gophermart" {
+		t.Errorf("service = %v", got["service"])
+	}
+	req, ok := got["req"].(map[string]any)
+	if !ok || req["status"] != float64(200) {
+		t.Errorf("req = %v", got["req"])
+	}
+}
+
+func TestLevelHandler_ModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := &levels{}
+	l.global.Set(slog.LevelInfo)
+	l.setModules(map[string]slog.Level{"worker": slog.LevelDebug, "http": slog.LevelError})
+	log := slog.New(NewContextHandler(newLevelHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.Level(-8)}), l)))
+
+	log.Debug("global debug")
+	log.With(slog.String(KeyModule, "worker")).Debug("worker debug")
+	log.DebugContext(WithModule(context.Background(), "worker"), "worker ctx debug")
+	log.With(slog.String(KeyModule, "http")).Warn("http warn")
+	log.Warn("global warn")
+
+	out := buf.String()
+	for _, msg := range []string{"worker debug", "worker ctx debug", "global warn"} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("missing %q", msg)
+		}
+	}
+	for _, msg := range []string{"global debug", "http warn"} {
+		if strings.Contains(out, msg) {
+			t.Errorf("unexpected %q", msg)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := newSampler(3)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	var allowed int
+	for i := 0; i < 12; i++ {
+		if s.allow("noisy") {
+			allowed++
+		}
+	}
+	// 1, 2, 3, затем 6, 9, 12
+	if allowed != 6 {
+		t.Errorf("allowed = %d, want 6", allowed)
+	}
+	if !s.allow("other") {
+		t.Error("other message must be allowed")
+	}
+
+	// Новое окно сбрасывает счетчики
+	now = now.Add(2 * samplingWindow)
+	if !s.allow("noisy") {
+		t.Error("noisy must be allowed in new window")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := NewRotatingFile(path, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.MaxSize = 10
+
+	for i := 0; i < 5; i++ {
+		if _, err := f.Write([]byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+		// Имена резервных копий различаются по времени
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	backups, err := filepath.Glob(filepath.Join(filepath.Dir(path), "app-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("backups = %v, want 2", backups)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "0123456789" {
+		t.Errorf("current file = %q", b)
+	}
+}
+
+// stripColor убирает ANSI коды цвета
+func stripColor(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b {
+			for i < len(s) && s[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// KeyModule - атрибут, по которому выбирается уровень модуля
+const KeyModule = "module"
+
+// ParseLevel разбирает уровень логирования.
+// Для совместимости info понимается и как production/prod
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug", "":
+		return slog.LevelDebug, nil
+	case "info", "production", "prod":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// ParseModuleLevels разбирает уровни модулей в формате "worker=debug,http=warn"
+func ParseModuleLevels(s string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, lvl, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(module) == "" {
+			return nil, fmt.Errorf("invalid module level %q, want module=level", item)
+		}
+		level, err := ParseLevel(lvl)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(module)] = level
+	}
+	return levels, nil
+}
+
+// WithModule добавляет в контекст имя модуля
+func WithModule(ctx context.Context, module string) context.Context {
+	return WithAttrs(ctx, slog.String(KeyModule, module))
+}
+
+// Module возвращает логгер модуля для кода без контекста
+func Module(name string) *slog.Logger {
+	return slog.Default().With(slog.String(KeyModule, name))
+}
+
+// levels - общий уровень и уровни модулей, меняются на лету
+type levels struct {
+	global  slog.LevelVar
+	modules atomic.Pointer[map[string]slog.Level]
+}
+
+func (l *levels) level(module string) slog.Level {
+	if module != "" {
+		if m := l.modules.Load(); m != nil {
+			if lvl, ok := (*m)[module]; ok {
+				return lvl
+			}
+		}
+	}
+	return l.global.Level()
+}
+
+func (l *levels) setModules(m map[string]slog.Level) {
+	l.modules.Store(&m)
+}
+
+// LevelHandler отсекает записи ниже уровня модуля.
+// Модуль берется из атрибутов логгера или из контекста
+type LevelHandler struct {
+	next   slog.Handler
+	levels *levels
+	module string
+}
+
+func newLevelHandler(next slog.Handler, l *levels) *LevelHandler {
+	return &LevelHandler{next: next, levels: l}
+}
+
+func (h *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	module := h.module
+	if module == "" {
+		module = moduleFromContext(ctx)
+	}
+	return level >= h.levels.level(module)
+}
+
+func (h *LevelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	module := h.module
+	for _, a := range attrs {
+		if a.Key == KeyModule {
+			module = a.Value.String()
+		}
+	}
+	return &LevelHandler{next: h.next.WithAttrs(attrs), levels: h.levels, module: module}
+}
+
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{next: h.next.WithGroup(name), levels: h.levels, module: h.module}
+}
+
+func moduleFromContext(ctx context.Context) string {
+	for _, a := range attrsFromContext(ctx) {
+		if a.Key == KeyModule {
+			return a.Value.String()
+		}
+	}
+	return ""
+}
@@ -1,29 +1,105 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
 )
 
+// Форматы вывода
+const (
+	FormatPretty = "pretty"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+type Options struct {
+	Level  string
+	Format string
+	// Уровни модулей в формате "worker=debug,http=warn"
+	ModuleLevels string
+	// Пропускать первые N одинаковых debug записей в секунду, дальше каждую N-ю. 0 - без прореживания
+	DebugSampling int
+	// Файл лога вместо stdout и его ротация
+	File           string
+	FileMaxSizeMB  int
+	FileMaxBackups int
+}
+
+// Текущие уровни, чтобы менять их без пересоздания логгера
+var current = &levels{}
+
+// InitLogger настраивает логгер по умолчанию: pretty формат в stdout.
+// Неизвестный уровень, как и раньше, означает debug
 func InitLogger(level string) {
-	// var logger *slog.Logger
-	var opts PrettyHandlerOptions
-
-	switch level {
-	case "info", "production", "prod":
-		opts = PrettyHandlerOptions{
-			SlogOpts: slog.HandlerOptions{
-				Level: slog.LevelInfo,
-			},
+	if _, err := Init(Options{Level: level}); err != nil {
+		Init(Options{Level: "debug"})
+		slog.Warn("logger init error", slog.String("err", err.Error()))
+	}
+}
+
+// Init настраивает логгер по умолчанию. Возвращает файл лога,
+// если он задан, чтобы закрыть его при завершении
+func Init(opts Options) (io.Closer, error) {
+	if err := SetLevel(opts.Level); err != nil {
+		return nil, err
+	}
+	if err := SetModuleLevels(opts.ModuleLevels); err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stdout
+	var closer io.Closer = nopCloser{}
+	if opts.File != "" {
+		f, err := NewRotatingFile(opts.File, opts.FileMaxSizeMB, opts.FileMaxBackups)
+		if err != nil {
+			return nil, err
 		}
+		out, closer = f, f
+	}
+
+	// Уровни проверяет LevelHandler, поэтому форматтер пропускает все
+	formatOpts := slog.HandlerOptions{Level: slog.Level(-8)}
+	var handler slog.Handler
+	switch opts.Format {
+	case FormatPretty, "":
+		handler = newPrettyHandler(out, PrettyHandlerOptions{SlogOpts: formatOpts})
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, &formatOpts)
+	case FormatLogfmt:
+		handler = slog.NewTextHandler(out, &formatOpts)
 	default:
-		opts = PrettyHandlerOptions{
-			SlogOpts: slog.HandlerOptions{
-				Level: slog.LevelDebug,
-			},
-		}
+		closer.Close()
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	handler = newSamplingHandler(handler, opts.DebugSampling)
+	handler = newLevelHandler(handler, current)
+	slog.SetDefault(slog.New(NewContextHandler(handler)))
+	return closer, nil
+}
+
+// SetLevel меняет общий уровень логирования на лету
+func SetLevel(level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
 	}
-	handler := newPrettyHandler(os.Stdout, opts)
-	logger := slog.New(handler)
-	slog.SetDefault(logger)
+	current.global.Set(lvl)
+	return nil
 }
+
+// SetModuleLevels заменяет уровни модулей на лету
+func SetModuleLevels(moduleLevels string) error {
+	m, err := ParseModuleLevels(moduleLevels)
+	if err != nil {
+		return err
+	}
+	current.setModules(m)
+	return nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile пишет лог в файл и переименовывает его, когда размер превышает MaxSize.
+// Хранится не больше MaxBackups старых файлов
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64 // байт, 0 - без ротации
+	MaxBackups int   // 0 - старые файлы не удаляются
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile открывает файл на дозапись. maxSizeMB задается в мегабайтах
+func NewRotatingFile(path string, maxSizeMB, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{
+		Path:       path,
+		MaxSize:    int64(maxSizeMB) * 1024 * 1024,
+		MaxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	backup := f.backupName(time.Now())
+	if err := os.Rename(f.Path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.removeOld()
+}
+
+// backupName: app.log -> app-20240101T120000.000.log
+func (f *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(f.Path)
+	prefix := strings.TrimSuffix(f.Path, ext)
+	return fmt.Sprintf("%s-%s%s", prefix, t.Format(backupTimeFormat), ext)
+}
+
+func (f *RotatingFile) removeOld() error {
+	if f.MaxBackups <= 0 {
+		return nil
+	}
+	ext := filepath.Ext(f.Path)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.Path, ext) + "-*" + ext)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= f.MaxBackups {
+		return nil
+	}
+	// Имена содержат время, поэтому сортировка по имени - это сортировка по времени
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-f.MaxBackups] {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
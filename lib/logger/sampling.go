@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const samplingWindow = time.Second
+
+// sampler считает debug записи по сообщению в пределах окна
+type sampler struct {
+	n   uint64
+	now func() time.Time
+
+	mu      sync.Mutex
+	resetAt time.Time
+	counts  map[string]uint64
+}
+
+func newSampler(n int) *sampler {
+	return &sampler{
+		n:      uint64(n),
+		now:    time.Now,
+		counts: make(map[string]uint64),
+	}
+}
+
+// allow пропускает первые n записей с одинаковым сообщением за окно, дальше каждую n-ю.
+// Счетчики сбрасываются каждое окно, поэтому карта не растет бесконечно
+func (s *sampler) allow(msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(s.resetAt) {
+		s.resetAt = now.Add(samplingWindow)
+		clear(s.counts)
+	}
+	s.counts[msg]++
+	count := s.counts[msg]
+	return count <= s.n || count%s.n == 0
+}
+
+// SamplingHandler прореживает шумные debug записи. Остальные уровни пишутся всегда
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+func newSamplingHandler(next slog.Handler, n int) slog.Handler {
+	if n <= 1 {
+		return next
+	}
+	return &SamplingHandler{next: next, sampler: newSampler(n)}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= slog.LevelDebug && !h.sampler.allow(r.Message) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
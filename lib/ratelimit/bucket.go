@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Bucket - клиентский token bucket, общий для всех обращений к внешнему сервису.
+// Помимо обычного ограничения скорости умеет "замораживать" все запросы
+// на время, которое сервис вернул в заголовке Retry-After.
+type Bucket struct {
+	limiter *rate.Limiter
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// NewBucket создает bucket с ограничением limit запросов в секунду и размером burst
+func NewBucket(limit rate.Limit, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		limiter: rate.NewLimiter(limit, burst),
+	}
+}
+
+// Wait блокирует вызывающего до окончания паузы и получения токена
+func (b *Bucket) Wait(ctx context.Context) error {
+	for {
+		delay := b.pauseLeft(time.Now())
+		if delay <= 0 {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return b.limiter.Wait(ctx)
+}
+
+// SetLimit меняет ограничение на лету. Уже ожидающие запросы получат новый лимит
+func (b *Bucket) SetLimit(limit rate.Limit, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	b.limiter.SetLimit(limit)
+	b.limiter.SetBurst(burst)
+}
+
+// Pause приостанавливает все запросы через bucket на время d.
+// Если уже действует более длинная пауза, она сохраняется.
+func (b *Bucket) Pause(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	until := time.Now().Add(d)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+func (b *Bucket) pauseLeft(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pausedUntil.Sub(now)
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errEmptyRetryAfter   = errors.New("empty Retry-After header")
+	errInvalidRetryAfter = errors.New("invalid Retry-After header")
+)
+
+// ParseRetryAfter разбирает значение заголовка Retry-After.
+// По RFC 9110 это либо количество секунд, либо дата в формате HTTP-date.
+// Дата в прошлом превращается в нулевую задержку.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errEmptyRetryAfter
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, errInvalidRetryAfter
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, errInvalidRetryAfter
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, nil
+	}
+	return 0, nil
+}
+
+// FormatRetryAfter возвращает значение Retry-After в секундах.
+// Дробная часть округляется вверх, чтобы клиент не пришел раньше времени.
+func FormatRetryAfter(delay time.Duration) string {
+	seconds := int64((delay + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
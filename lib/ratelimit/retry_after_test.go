@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:  "seconds",
+			value: "60",
+			want:  time.Minute,
+		},
+		{
+			name:  "seconds_with_spaces",
+			value: " 3 ",
+			want:  3 * time.Second,
+		},
+		{
+			name:  "http_date",
+			value: "Tue, 01 Oct 2024 12:00:30 GMT",
+			want:  30 * time.Second,
+		},
+		{
+			name:  "http_date_in_past",
+			value: "Tue, 01 Oct 2024 11:00:00 GMT",
+			want:  0,
+		},
+		{
+			name:    "empty",
+			value:   "",
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			value:   "-1",
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			value:   "soon",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetryAfter(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRetryAfter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		delay time.Duration
+		want  string
+	}{
+		{name: "zero", delay: 0, want: "1"},
+		{name: "fraction", delay: 1500 * time.Millisecond, want: "2"},
+		{name: "exact", delay: 12 * time.Second, want: "12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatRetryAfter(tt.delay); got != tt.want {
+				t.Errorf("FormatRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEventID   = "X-Webhook-Event-ID"
+
+	signaturePrefix = "sha256="
+	// Допустимое расхождение времени отправителя и получателя
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature = errors.New("webhook signature is missing")
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	ErrInvalidTimestamp = errors.New("webhook timestamp is invalid or expired")
+)
+
+// Sign подписывает тело запроса: HMAC-SHA256 от "timestamp.body"
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(mac(secret, timestamp.Unix(), body))
+}
+
+// SetHeaders выставляет заголовки подписи на исходящий запрос
+func SetHeaders(req *http.Request, secret, eventID string, timestamp time.Time, body []byte) {
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+	req.Header.Set(HeaderEventID, eventID)
+}
+
+// Verify проверяет подпись входящего запроса и свежесть его метки времени
+func Verify(secret string, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	signature := header.Get(HeaderSignature)
+	if signature == "" {
+		return ErrMissingSignature
+	}
+	ts, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if diff := now.Sub(time.Unix(ts, 0)); diff > tolerance || diff < -tolerance {
+		return ErrInvalidTimestamp
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(got, mac(secret, ts, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"order-12345678903-processed"}`)
+
+	signed := func(secret string, ts time.Time) http.Header {
+		req, _ := http.NewRequest(http.MethodPost, "/", nil)
+		SetHeaders(req, secret, "event", ts, body)
+		return req.Header
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			header: signed("secret", now),
+			body:   body,
+		},
+		{
+			name:    "wrong_secret",
+			header:  signed("another", now),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered_body",
+			header:  signed("secret", now),
+			body:    []byte(`{"id":"forged"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "expired",
+			header:  signed("secret", now.Add(-time.Hour)),
+			body:    body,
+			wantErr: ErrInvalidTimestamp,
+		},
+		{
+			name:    "missing",
+			header:  http.Header{},
+			body:    body,
+			wantErr: ErrMissingSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify("secret", tt.header, tt.body, now, DefaultTolerance)
+			if err != tt.wantErr {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}